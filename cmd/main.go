@@ -36,9 +36,15 @@ func main() {
 		}
 	}()
 
-	log.Info().Msg("starting initial sync")
-	a.Syncer.SyncOnce()
-	log.Info().Msg("initial sync completed")
+	// Without waiting the bot starts with the services stored by previous runs and the syncer connects the rest
+	if err := a.Syncer.LoadCatalog(); err != nil {
+		log.Warn().Err(err).Msg("failed to load stored services")
+	}
+	if config.Sync.WaitOnStartup {
+		log.Info().Msg("starting initial sync")
+		a.Syncer.SyncOnce(ctx)
+		log.Info().Msg("initial sync completed")
+	}
 
 	engine := bobrix.NewEngine()
 	log.Info().Msg("bobrix engine created")
@@ -51,7 +57,7 @@ func main() {
 	}
 	log.Info().Str("username", config.Matrix.Username).Str("homeserver", config.Matrix.HomeserverURL).Msg("bot credentials prepared")
 
-	snetBot, err := snet.NewSNETBot(botCredentials, a.MatrixClient, a.Ethereum, a.DB, a.GRPCManager, a.Syncer.FileDescriptors)
+	snetBot, err := snet.NewSNETBot(botCredentials, a.MatrixClient, a.Ethereum, a.DB, a.GRPCManager, &a.Syncer)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create snet bot")
 		panic(err)
@@ -62,6 +68,7 @@ func main() {
 	log.Info().Msg("bot connected to engine")
 
 	go a.Syncer.Start(ctx)
+	go a.Reclaimer.Start(ctx)
 	log.Info().Msg("syncer started")
 
 	// Start the Fiber server in a goroutine with error handling
@@ -95,6 +102,7 @@ func main() {
 
 	log.Info().Msg("stopping syncer")
 	a.Syncer.Stop()
+	a.Reclaimer.Stop()
 
 	cancel()
 
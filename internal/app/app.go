@@ -8,6 +8,7 @@ import (
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/internal/logger"
 	"github.com/tensved/snet-matrix-framework/internal/matrix"
+	"github.com/tensved/snet-matrix-framework/internal/reclaimer"
 	"github.com/tensved/snet-matrix-framework/internal/server"
 	"github.com/tensved/snet-matrix-framework/internal/syncer"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
@@ -22,6 +23,7 @@ type App struct {
 	MatrixClient matrix.Service
 	IPFSClient   ipfs.IPFSClient
 	Syncer       syncer.SnetSyncer
+	Reclaimer    reclaimer.Reclaimer
 	GRPCManager  *grpcmanager.GRPCClientManager
 }
 
@@ -33,12 +35,13 @@ func New() App {
 	eth := blockchain.Init()
 	ipfsClient := ipfs.Init()
 	snetSyncer := syncer.New(eth, ipfsClient, database)
+	channelReclaimer := reclaimer.New(eth, database)
 	grpcManager := grpcmanager.NewGRPCClientManager()
 	matrixClient := matrix.New(database, snetSyncer, grpcManager, eth)
 	if matrixClient == nil {
 		log.Error().Msg("failed to create Matrix client")
 	}
-	fiberServer := server.New(database)
+	fiberServer := server.New(database, &snetSyncer)
 
 	app := App{
 		DB:           database,
@@ -47,6 +50,7 @@ func New() App {
 		MatrixClient: matrixClient,
 		IPFSClient:   ipfsClient,
 		Syncer:       snetSyncer,
+		Reclaimer:    channelReclaimer,
 		GRPCManager:  grpcManager,
 	}
 
@@ -0,0 +1,253 @@
+package budget
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+const (
+	// ActionRefuse refuses calls that would exceed a limit.
+	ActionRefuse = "refuse"
+	// ActionConfirm asks the user to confirm calls that would exceed a limit.
+	ActionConfirm = "confirm"
+)
+
+// Scope is what a limit applies to.
+type Scope string
+
+const (
+	ScopeUser    Scope = "user"    // The limit applies to one Matrix user.
+	ScopeRoom    Scope = "room"    // The limit applies to one Matrix room.
+	ScopeService Scope = "service" // The limit applies to one service.
+)
+
+// Window is the period a limit is counted over.
+type Window string
+
+const (
+	WindowDaily   Window = "daily"   // The limit resets at midnight UTC.
+	WindowMonthly Window = "monthly" // The limit resets on the first day of the month UTC.
+)
+
+// Limit is a spending limit in cogs for a scope and window.
+type Limit struct {
+	Scope  Scope  // What the limit applies to.
+	Window Window // The period the limit is counted over.
+	Amount int64  // The maximum amount in cogs.
+}
+
+// Allowance is the state of one limit for a call.
+type Allowance struct {
+	Limit       // The limit the allowance is counted against.
+	Spent int64 // The amount already spent or held for running calls in the current window.
+}
+
+// Remaining returns the amount that can still be spent in the current window.
+func (a Allowance) Remaining() int64 {
+	return max(a.Amount-a.Spent, 0)
+}
+
+// ExceededError reports the limit a call would exceed.
+type ExceededError struct {
+	Allowance       // The exceeded allowance.
+	Cost      int64 // The cost of the refused call.
+}
+
+// Error implements the error interface.
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("the call costs %d cogs, but only %d of the %s %s limit of %d cogs are left", e.Cost, e.Remaining(), e.Window, e.Scope, e.Amount)
+}
+
+// Manager tracks spendings and checks them against the configured limits.
+type Manager struct {
+	database db.Service                // The database holding the spendings.
+	limits   []Limit                   // The configured limits, unlimited ones are omitted.
+	reserved map[*Reservation]struct{} // The amounts held for calls that are still running.
+	mu       sync.Mutex                // Serializes reservations, so concurrent calls cannot pass a limit together.
+}
+
+// Reservation is an amount held against the limits while a call runs.
+// It must be committed or refunded once the call is over.
+type Reservation struct {
+	manager      *Manager
+	matrixUserID string
+	roomID       string
+	serviceID    string
+	amount       int64
+}
+
+// NewManager creates and returns a new Manager with limits from the configuration.
+func NewManager(database db.Service, cfg config.BudgetsConfig) *Manager {
+	m := &Manager{
+		database: database,
+		reserved: make(map[*Reservation]struct{}),
+	}
+	for _, limit := range []Limit{
+		{ScopeUser, WindowDaily, cfg.UserDaily},
+		{ScopeUser, WindowMonthly, cfg.UserMonthly},
+		{ScopeRoom, WindowDaily, cfg.RoomDaily},
+		{ScopeRoom, WindowMonthly, cfg.RoomMonthly},
+		{ScopeService, WindowDaily, cfg.ServiceDaily},
+		{ScopeService, WindowMonthly, cfg.ServiceMonthly},
+	} {
+		if limit.Amount > 0 {
+			m.limits = append(m.limits, limit)
+		}
+	}
+	return m
+}
+
+// Check returns an *ExceededError if a call costing the given amount would exceed any limit.
+// It holds nothing, so the call must still be reserved with Reserve before it is made.
+func (m *Manager) Check(matrixUserID, roomID, serviceID string, cost int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(matrixUserID, roomID, serviceID, cost)
+}
+
+// Reserve checks the limits and holds cost against them in one step, so concurrent calls cannot exceed a limit together.
+// It returns an *ExceededError if a limit would be exceeded.
+func (m *Manager) Reserve(matrixUserID, roomID, serviceID string, cost int64) (*Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(matrixUserID, roomID, serviceID, cost); err != nil {
+		return nil, err
+	}
+	return m.hold(matrixUserID, roomID, serviceID, cost), nil
+}
+
+// Overdraw holds cost without checking the limits, e.g. for a call the user confirmed although it exceeds a limit.
+func (m *Manager) Overdraw(matrixUserID, roomID, serviceID string, cost int64) *Reservation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hold(matrixUserID, roomID, serviceID, cost)
+}
+
+// check returns an *ExceededError if cost exceeds the amount left by the spendings and the reservations. m.mu must be held.
+func (m *Manager) check(matrixUserID, roomID, serviceID string, cost int64) error {
+	if cost <= 0 {
+		return nil
+	}
+
+	allowances, err := m.allowances(matrixUserID, roomID, serviceID, true)
+	if err != nil {
+		return err
+	}
+	for _, allowance := range allowances {
+		if cost > allowance.Remaining() {
+			return &ExceededError{Allowance: allowance, Cost: cost}
+		}
+	}
+	return nil
+}
+
+// hold adds a reservation of cost. m.mu must be held.
+func (m *Manager) hold(matrixUserID, roomID, serviceID string, cost int64) *Reservation {
+	r := &Reservation{
+		manager:      m,
+		matrixUserID: matrixUserID,
+		roomID:       roomID,
+		serviceID:    serviceID,
+		amount:       max(cost, 0),
+	}
+	m.reserved[r] = struct{}{}
+	return r
+}
+
+// Commit replaces the reservation with the amount the call actually spent, which may differ from the reserved one,
+// e.g. nothing for a free call or more when the call had to fund a payment channel.
+func (r *Reservation) Commit(cost int64) {
+	m := r.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reserved[r]; !ok {
+		return
+	}
+	// The spending is stored before the reservation is dropped, so the amount is counted all along
+	m.record(r.matrixUserID, r.roomID, r.serviceID, cost)
+	delete(m.reserved, r)
+}
+
+// Refund drops the reservation of a call that spent nothing.
+func (r *Reservation) Refund() {
+	r.Commit(0)
+}
+
+// record stores the amount spent on a call.
+func (m *Manager) record(matrixUserID, roomID, serviceID string, cost int64) {
+	if cost <= 0 {
+		return
+	}
+
+	err := m.database.CreateSpending(&db.Spending{
+		MatrixUserID: matrixUserID,
+		RoomID:       roomID,
+		ServiceID:    serviceID,
+		Amount:       cost,
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("matrix_user_id", matrixUserID).
+			Str("service_id", serviceID).
+			Int64("cost", cost).
+			Msg("failed to record spending")
+	}
+}
+
+// Allowances returns the user and room limits with the amounts spent and reserved in their current windows.
+func (m *Manager) Allowances(matrixUserID, roomID string) ([]Allowance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.allowances(matrixUserID, roomID, "", false)
+}
+
+// allowances counts the spendings and reservations of every configured limit; service limits are only included on request.
+// m.mu must be held.
+func (m *Manager) allowances(matrixUserID, roomID, serviceID string, withServices bool) ([]Allowance, error) {
+	allowances := make([]Allowance, 0, len(m.limits))
+	for _, limit := range m.limits {
+		var filter db.SpendingFilter
+		switch limit.Scope {
+		case ScopeUser:
+			filter.MatrixUserID = matrixUserID
+		case ScopeRoom:
+			filter.RoomID = roomID
+		case ScopeService:
+			if !withServices {
+				continue
+			}
+			filter.ServiceID = serviceID
+		}
+
+		spent, err := m.database.GetSpentAmount(filter, m.windowStart(limit.Window))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s %s spendings: %w", limit.Window, limit.Scope, err)
+		}
+		for r := range m.reserved {
+			if (filter.MatrixUserID == "" || filter.MatrixUserID == r.matrixUserID) &&
+				(filter.RoomID == "" || filter.RoomID == r.roomID) &&
+				(filter.ServiceID == "" || filter.ServiceID == r.serviceID) {
+				spent += r.amount
+			}
+		}
+		allowances = append(allowances, Allowance{Limit: limit, Spent: spent})
+	}
+	return allowances, nil
+}
+
+// windowStart returns the beginning of the current window in UTC.
+func (m *Manager) windowStart(window Window) time.Time {
+	now := time.Now().UTC()
+	if window == WindowMonthly {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
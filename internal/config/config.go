@@ -2,6 +2,7 @@ package config
 
 import (
 	"regexp"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -15,6 +16,11 @@ var (
 	Matrix     MatrixConfig     // Configuration for Matrix (chat protocol).
 	Blockchain BlockchainConfig // Configuration for Blockchain.
 	IPFS       IPFSConfig       // Configuration for IPFS (InterPlanetary File System).
+	Payments   PaymentsConfig   // Configuration for paying for service calls.
+	Wallets    WalletsConfig    // Configuration for per-user wallets.
+	Budgets    BudgetsConfig    // Configuration for spending limits.
+	Reclaim    ReclaimConfig    // Configuration for reclaiming funds from expired channels.
+	Sync       SyncConfig       // Configuration for synchronizing organizations and services from the registry.
 )
 
 // PostgresConfig holds the configuration values for connecting to a PostgreSQL database.
@@ -32,6 +38,7 @@ type AppConfig struct {
 	Domain         string `env:"DOMAIN"`          // The domain name of the application.
 	IsProduction   bool   `env:"PRODUCTION"`      // Boolean flag indicating if the app is in production mode.
 	PaymentTimeout int    `env:"PAYMENT_TIMEOUT"` // Number of minutes during which user can pay for a service call
+	AdminToken     string `env:"API_ADMIN_TOKEN"` // Bearer token of the admin API endpoints, which are disabled when it is empty
 }
 
 // IPFSConfig holds the configuration values for connecting to an IPFS provider.
@@ -43,20 +50,77 @@ type IPFSConfig struct {
 
 // BlockchainConfig holds the configuration values for connecting to a blockchain network.
 type BlockchainConfig struct {
-	AdminPrivateKey    string `env:"ADMIN_PRIVATE_KEY"`    // The private key of the admin account.
-	AdminPublicAddress string `env:"ADMIN_PUBLIC_ADDRESS"` // The public address of the admin account.
-	EthProviderURL     string `env:"ETH_PROVIDER_URL"`     // The URL of the Ethereum provider.
-	EthProviderWSURL   string `env:"ETH_PROVIDER_WS_URL"`  // The WebSocket URL of the Ethereum provider.
-	ChainID            string `env:"CHAIN_ID"`             // The chain ID of the blockchain network.
+	AdminPrivateKey             string `env:"ADMIN_PRIVATE_KEY"`                      // The private key of the admin account.
+	AdminPublicAddress          string `env:"ADMIN_PUBLIC_ADDRESS"`                   // The public address of the admin account.
+	AdminKeystoreFile           string `env:"ADMIN_KEYSTORE_FILE"`                    // The encrypted keystore JSON file of the admin account, used instead of the private key.
+	AdminKeystorePassphraseFile string `env:"ADMIN_KEYSTORE_PASSPHRASE_FILE"`         // The file holding the passphrase of the admin keystore.
+	RemoteSignerURL             string `env:"REMOTE_SIGNER_URL"`                      // The HTTP URL or IPC path of an external signer (clef API) holding the admin account, used instead of a local key.
+	EthProviderURL              string `env:"ETH_PROVIDER_URL"`                       // The URL of the Ethereum provider.
+	EthProviderWSURL            string `env:"ETH_PROVIDER_WS_URL"`                    // The WebSocket URL of the Ethereum provider.
+	ChainID                     string `env:"CHAIN_ID"`                               // The chain ID of the blockchain network.
+	ApproveHeadroom             uint64 `env:"TOKEN_APPROVE_HEADROOM" envDefault:"10"` // Multiple of the required amount approved to the MPE contract at once, so later deposits need no new approval.
+	TopUpMultiple               uint64 `env:"CHANNEL_TOPUP_MULTIPLE" envDefault:"5"`  // Number of payments a short payment channel is funded for at once, so following calls need no transaction.
+}
+
+// PaymentsConfig holds the configuration values for paying for service calls.
+type PaymentsConfig struct {
+	PrepaidCallBatch uint64 `env:"PREPAID_CALL_BATCH" envDefault:"10"`  // Number of calls signed upfront for one prepaid token.
+	Mode             string `env:"PAYMENT_MODE" envDefault:"operator"`  // Who funds payment channels: "operator" (admin account) or "user" (through the payment gateway).
+	GatewayURL       string `env:"PAYMENT_GATEWAY_URL"`                 // The URL of the payment gateway page, defaults to https://DOMAIN.
+	ConfirmThreshold int64  `env:"CONFIRM_THRESHOLD" envDefault:"0"`    // Calls cheaper than this amount in cogs run without confirmation unless a room sets its own threshold.
+	GroupSelection   string `env:"GROUP_SELECTION" envDefault:"first"`  // How the payment group of a multi-group service is chosen: "first", "cheapest" or "latency".
+	ChannelLocking   string `env:"CHANNEL_LOCKING" envDefault:"memory"` // How signed amounts of shared channels are serialized: "memory" (this process) or "postgres" (row locks across processes).
+}
+
+// WalletsConfig holds the configuration values for the wallets of Matrix users.
+type WalletsConfig struct {
+	EncryptionKey string `env:"WALLET_ENCRYPTION_KEY"`              // The secret used to encrypt user private keys at rest. Wallets are disabled if empty.
+	Required      bool   `env:"WALLET_REQUIRED" envDefault:"false"` // Boolean flag indicating if users must pay from their own wallet instead of the admin account.
+}
+
+// BudgetsConfig holds the spending limits in cogs per Matrix user, room and service. Zero means unlimited.
+type BudgetsConfig struct {
+	UserDaily      int64  `env:"BUDGET_USER_DAILY" envDefault:"0"`           // Daily limit for one Matrix user.
+	UserMonthly    int64  `env:"BUDGET_USER_MONTHLY" envDefault:"0"`         // Monthly limit for one Matrix user.
+	RoomDaily      int64  `env:"BUDGET_ROOM_DAILY" envDefault:"0"`           // Daily limit for one Matrix room.
+	RoomMonthly    int64  `env:"BUDGET_ROOM_MONTHLY" envDefault:"0"`         // Monthly limit for one Matrix room.
+	ServiceDaily   int64  `env:"BUDGET_SERVICE_DAILY" envDefault:"0"`        // Daily limit for one service.
+	ServiceMonthly int64  `env:"BUDGET_SERVICE_MONTHLY" envDefault:"0"`      // Monthly limit for one service.
+	ExceededAction string `env:"BUDGET_EXCEEDED_ACTION" envDefault:"refuse"` // What to do when a limit would be exceeded: "refuse" or "confirm".
+}
+
+// ReclaimConfig holds the configuration values for the background job reclaiming funds from expired channels.
+type ReclaimConfig struct {
+	Enabled  bool          `env:"RECLAIM_ENABLED" envDefault:"false"`  // Boolean flag indicating if the reclaim job runs.
+	Interval time.Duration `env:"RECLAIM_INTERVAL" envDefault:"1h"`    // The interval between reclaim runs.
+	Withdraw bool          `env:"RECLAIM_WITHDRAW" envDefault:"false"` // Boolean flag indicating if reclaimed funds are withdrawn from the MPE balance.
+}
+
+// SyncConfig holds the configuration values for synchronizing organizations and services from the registry.
+type SyncConfig struct {
+	Interval           time.Duration `env:"SYNC_INTERVAL" envDefault:"24h"`          // The interval between full crawls of the registry, which reconcile whatever the event sync missed.
+	EventsInterval     time.Duration `env:"SYNC_EVENTS_INTERVAL" envDefault:"1m"`    // The interval between polls for registry events, zero disables the event sync.
+	EventsBatch        uint64        `env:"SYNC_EVENTS_BATCH" envDefault:"5000"`     // The maximum number of blocks queried for registry events at once.
+	Timeout            time.Duration `env:"SYNC_TIMEOUT" envDefault:"30m"`           // The deadline of one full sync, work not started by then is left to the next sync.
+	ChainConcurrency   int           `env:"SYNC_CHAIN_CONCURRENCY" envDefault:"4"`   // The maximum number of registry reads running at once.
+	IPFSConcurrency    int           `env:"SYNC_IPFS_CONCURRENCY" envDefault:"8"`    // The maximum number of IPFS fetches running at once.
+	CompileConcurrency int           `env:"SYNC_COMPILE_CONCURRENCY" envDefault:"2"` // The maximum number of proto compilations running at once.
+	WaitOnStartup      bool          `env:"SYNC_WAIT_ON_STARTUP" envDefault:"false"` // Boolean flag indicating if the bot starts only after the first full sync instead of alongside it.
+	Orgs               []string      `env:"SYNC_ORGS" envSeparator:","`              // The organization IDs or glob patterns to sync, all when empty.
+	Services           []string      `env:"SYNC_SERVICES" envSeparator:","`          // The service IDs or glob patterns to sync, all when empty.
+	Tags               []string      `env:"SYNC_TAGS" envSeparator:","`              // The tags a service needs at least one of to be synced, any when empty.
+	ExcludeOrgs        []string      `env:"SYNC_EXCLUDE_ORGS" envSeparator:","`      // The organization IDs or glob patterns never synced.
+	ExcludeServices    []string      `env:"SYNC_EXCLUDE_SERVICES" envSeparator:","`  // The service IDs or glob patterns never synced.
 }
 
 // MatrixConfig holds the configuration values for connecting to a Matrix homeserver.
 type MatrixConfig struct {
-	HomeserverURL string `env:"MATRIX_HOMESERVER_URL"` // The URL of the Matrix homeserver.
-	Servername    string `env:"MATRIX_SERVERNAME"`     // The server name of the Matrix homeserver.
-	Username      string `env:"MATRIX_BOT_USERNAME"`   // The username of the Matrix bot.
-	Password      string `env:"MATRIX_BOT_PASSWORD"`   // The password of the Matrix bot.
-	PickleKey     string `env:"MATRIX_PICKLE_KEY"`     // The pickle key for crypto operations.
+	HomeserverURL string   `env:"MATRIX_HOMESERVER_URL"`             // The URL of the Matrix homeserver.
+	Servername    string   `env:"MATRIX_SERVERNAME"`                 // The server name of the Matrix homeserver.
+	Username      string   `env:"MATRIX_BOT_USERNAME"`               // The username of the Matrix bot.
+	Password      string   `env:"MATRIX_BOT_PASSWORD"`               // The password of the Matrix bot.
+	PickleKey     string   `env:"MATRIX_PICKLE_KEY"`                 // The pickle key for crypto operations.
+	AdminIDs      []string `env:"MATRIX_ADMIN_IDS" envSeparator:","` // The Matrix user IDs allowed to run admin commands.
 }
 
 // Init loads environment variables and parses them into the respective configuration structs.
@@ -88,5 +152,25 @@ func Init() {
 		log.Error().Err(err)
 	}
 
+	if err := env.Parse(&Payments); err != nil {
+		log.Error().Err(err)
+	}
+
+	if err := env.Parse(&Wallets); err != nil {
+		log.Error().Err(err)
+	}
+
+	if err := env.Parse(&Budgets); err != nil {
+		log.Error().Err(err)
+	}
+
+	if err := env.Parse(&Reclaim); err != nil {
+		log.Error().Err(err)
+	}
+
+	if err := env.Parse(&Sync); err != nil {
+		log.Error().Err(err)
+	}
+
 	log.Debug().Msg("configuration loading completed")
 }
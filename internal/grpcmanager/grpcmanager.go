@@ -18,14 +18,17 @@ import (
 
 // GRPCClientManager manages a pool of gRPC service connections.
 type GRPCClientManager struct {
-	clients map[string]*GRPCService // A map to store gRPC service connections by target address.
-	mu      sync.Mutex              // A mutex to ensure thread-safe access to the clients map.
+	clients  map[string]*GRPCService   // A map to store gRPC service connections by target address.
+	mu       sync.Mutex                // A mutex to ensure thread-safe access to the clients map.
+	health   map[string]EndpointHealth // A map to store the availability of daemon endpoints by URL.
+	healthMu sync.Mutex                // A mutex to ensure thread-safe access to the health map.
 }
 
 // NewGRPCClientManager creates and returns a new GRPCClientManager.
 func NewGRPCClientManager() *GRPCClientManager {
 	return &GRPCClientManager{
-		clients: make(map[string]*GRPCService), // Initializes the clients map.
+		clients: make(map[string]*GRPCService),   // Initializes the clients map.
+		health:  make(map[string]EndpointHealth), // Initializes the health map.
 	}
 }
 
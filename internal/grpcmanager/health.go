@@ -0,0 +1,142 @@
+package grpcmanager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	healthCheckTTL     = 30 * time.Second // How long a health check result of an endpoint is reused.
+	healthCheckTimeout = 5 * time.Second  // How long a health check of an endpoint may take.
+)
+
+// EndpointHealth is what is known about the availability of a daemon endpoint.
+type EndpointHealth struct {
+	Latency     time.Duration // The duration of the last successful health check or call.
+	Failures    int           // The number of failures in a row.
+	LastError   error         // The error of the last failure, nil if the last check or call succeeded.
+	CheckedAt   time.Time     // The time of the last health check or call.
+	LastFailure time.Time     // The time of the last failure.
+}
+
+// healthy reports whether the endpoint answered its last health check or call.
+func (h EndpointHealth) healthy() bool {
+	return h.LastError == nil
+}
+
+// Health returns what is known about the availability of a daemon endpoint.
+func (manager *GRPCClientManager) Health(serviceURL string) (EndpointHealth, bool) {
+	manager.healthMu.Lock()
+	defer manager.healthMu.Unlock()
+
+	health, ok := manager.health[serviceURL]
+	return health, ok
+}
+
+// ReportResult records the outcome of a health check or call to a daemon endpoint.
+// A zero latency keeps the last measured one, so slow calls do not skew the ranking.
+func (manager *GRPCClientManager) ReportResult(serviceURL string, latency time.Duration, err error) {
+	manager.healthMu.Lock()
+	defer manager.healthMu.Unlock()
+
+	health := manager.health[serviceURL]
+	health.CheckedAt = time.Now()
+	health.LastError = err
+	if err != nil {
+		health.Failures++
+		health.LastFailure = time.Now()
+	} else {
+		health.Failures = 0
+		if latency > 0 {
+			health.Latency = latency
+		}
+	}
+	manager.health[serviceURL] = health
+}
+
+// CheckHealth reports how long the daemon at the URL takes to answer a health check.
+// Results younger than healthCheckTTL are reused instead of checking again.
+func (manager *GRPCClientManager) CheckHealth(ctx context.Context, serviceURL string) (time.Duration, error) {
+	if health, ok := manager.Health(serviceURL); ok && time.Since(health.CheckedAt) < healthCheckTTL {
+		return health.Latency, health.LastError
+	}
+
+	logger := log.With().Str("service_url", serviceURL).Logger()
+
+	var latency time.Duration
+	client, err := manager.GetClient(serviceURL)
+	if err != nil {
+		err = fmt.Errorf("failed to get gRPC client: %w", err)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+
+		start := time.Now()
+		var resp *grpc_health_v1.HealthCheckResponse
+		resp, err = grpc_health_v1.NewHealthClient(client.Conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		latency = time.Since(start)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("failed to get health status: %w", err)
+		case resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING:
+			err = fmt.Errorf("service is %s", resp.GetStatus())
+		}
+	}
+
+	logger.Debug().
+		Dur("latency", latency).
+		AnErr("health_error", err).
+		Msg("endpoint health checked")
+
+	manager.ReportResult(serviceURL, latency, err)
+	return latency, err
+}
+
+// RankEndpoints orders daemon endpoints by their known health.
+// Endpoints that answered last come first, fastest first; endpoints without history keep their order after them;
+// failing endpoints come last, those with fewer failures in a row first.
+func (manager *GRPCClientManager) RankEndpoints(serviceURLs []string) []string {
+	rank := func(serviceURL string) (int, EndpointHealth) {
+		health, ok := manager.Health(serviceURL)
+		switch {
+		case !ok:
+			return 1, health
+		case health.healthy():
+			return 0, health
+		default:
+			return 2, health
+		}
+	}
+
+	ranked := slices.Clone(serviceURLs)
+	slices.SortStableFunc(ranked, func(a, b string) int {
+		rankA, healthA := rank(a)
+		rankB, healthB := rank(b)
+		switch {
+		case rankA != rankB:
+			return rankA - rankB
+		case rankA == 0:
+			return int(healthA.Latency - healthB.Latency)
+		case rankA == 2:
+			return healthA.Failures - healthB.Failures
+		}
+		return 0
+	})
+	return ranked
+}
+
+// IsUnavailable reports whether a call failed before the daemon could process it,
+// so it is safe to send the same request to another endpoint.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return status.Code(err) == codes.Unavailable
+}
@@ -0,0 +1,103 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+const (
+	// FormatCSV exports the ledger as comma-separated values with a header row.
+	FormatCSV = "csv"
+	// FormatJSON exports the ledger as a JSON array.
+	FormatJSON = "json"
+)
+
+// csvHeader lists the columns of the CSV export.
+var csvHeader = []string{
+	"id", "created_at", "matrix_user_id", "room_id", "service_id", "method", "strategy", "endpoint",
+	"mpe_address", "channel_id", "nonce", "signed_amount", "cost", "duration_ms", "grpc_status", "error",
+}
+
+// ContentType returns the MIME type of an export format.
+func ContentType(format string) string {
+	if format == FormatJSON {
+		return "application/json"
+	}
+	return "text/csv"
+}
+
+// FileName returns the name of an export file created at the given time.
+func FileName(format string, createdAt time.Time) string {
+	return fmt.Sprintf("service-calls-%s.%s", createdAt.UTC().Format("20060102-150405"), format)
+}
+
+// Export writes the ledger entries in the given format.
+//
+// Parameters:
+//   - w: The writer receiving the export.
+//   - calls: The ledger entries, usually oldest first.
+//   - format: FormatCSV or FormatJSON.
+//
+// Returns:
+//   - error: An error if the format is unknown or writing fails.
+func Export(w io.Writer, calls []db.ServiceCall, format string) error {
+	switch format {
+	case FormatJSON:
+		if calls == nil {
+			calls = []db.ServiceCall{}
+		}
+		return json.NewEncoder(w).Encode(calls)
+	case FormatCSV:
+		return exportCSV(w, calls)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// exportCSV writes the ledger entries as CSV with amounts in cogs.
+func exportCSV(w io.Writer, calls []db.ServiceCall) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, call := range calls {
+		record := []string{
+			strconv.Itoa(call.ID),
+			call.CreatedAt.UTC().Format(time.RFC3339),
+			call.MatrixUserID,
+			call.RoomID,
+			call.ServiceID,
+			call.Method,
+			call.Strategy,
+			call.Endpoint,
+			call.MPEAddress,
+			bigIntField(call.ChannelID),
+			bigIntField(call.Nonce),
+			bigIntField(call.SignedAmount),
+			strconv.FormatInt(call.Cost, 10),
+			strconv.FormatInt(call.DurationMs, 10),
+			call.GRPCStatus,
+			call.Error,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// bigIntField formats an optional big.Int for CSV, leaving the field empty for nil.
+func bigIntField(value *big.Int) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
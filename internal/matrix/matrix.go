@@ -25,6 +25,7 @@ type Service interface {
 	Login(username, password string) (err error)
 	Auth()
 	SendMessage(roomID id.RoomID, text string) (*mautrix.RespSendEvent, error)
+	SendFile(roomID id.RoomID, fileName, contentType string, data []byte) (*mautrix.RespSendEvent, error)
 	GetRepliedEvent(evt *event.Event) (*event.Event, error)
 	IsPrivateRoom(roomID id.RoomID) (bool, error)
 }
@@ -256,3 +257,45 @@ func (s *service) SendMessage(roomID id.RoomID, text string) (*mautrix.RespSendE
 
 	return resp, nil
 }
+
+// SendFile uploads a file to the media repository and sends it to the specified room on the Matrix server.
+func (s *service) SendFile(roomID id.RoomID, fileName, contentType string, data []byte) (*mautrix.RespSendEvent, error) {
+	logger := log.With().
+		Str("room_id", string(roomID)).
+		Str("file_name", fileName).
+		Int("file_size", len(data)).
+		Logger()
+
+	upload, err := s.Client.UploadBytesWithName(s.Context, data, contentType, fileName)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("failed to upload Matrix file")
+		return nil, err
+	}
+
+	content := event.MessageEventContent{
+		MsgType:  event.MsgFile,
+		Body:     fileName,
+		FileName: fileName,
+		URL:      upload.ContentURI.CUString(),
+		Info: &event.FileInfo{
+			MimeType: contentType,
+			Size:     len(data),
+		},
+	}
+
+	resp, err := s.Client.SendMessageEvent(s.Context, roomID, event.EventMessage, content)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("failed to send Matrix file")
+		return nil, err
+	}
+
+	logger.Debug().
+		Str("event_id", string(resp.EventID)).
+		Msg("Matrix file sent successfully")
+
+	return resp, nil
+}
@@ -0,0 +1,201 @@
+package reclaimer
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/snet"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+const (
+	// ActionClaimTimeout is logged when the value of an expired channel is returned to the MPE balance.
+	ActionClaimTimeout = "claim_timeout"
+	// ActionWithdraw is logged when reclaimed funds are withdrawn from the MPE balance.
+	ActionWithdraw = "withdraw"
+
+	statusSuccess = "success"
+	statusFailed  = "failed"
+)
+
+// Reclaimer periodically reclaims the funds locked in expired channels of the admin account.
+type Reclaimer struct {
+	Ethereum   blockchain.Ethereum
+	DB         db.Service
+	signer     signer.Signer
+	cancelFunc context.CancelFunc
+}
+
+// New creates a new Reclaimer paying for transactions with the admin signer.
+func New(eth blockchain.Ethereum, database db.Service) Reclaimer {
+	adminSigner, err := signer.Admin()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load admin signer, channel reclaiming is disabled")
+	}
+
+	return Reclaimer{
+		Ethereum: eth,
+		DB:       database,
+		signer:   adminSigner,
+	}
+}
+
+// ReclaimOnce claims the timeout of every expired channel of the admin account
+// and optionally withdraws the reclaimed funds from the MPE balance.
+func (r *Reclaimer) ReclaimOnce(ctx context.Context) {
+	if r.signer == nil {
+		return
+	}
+
+	sender := r.signer.Address()
+	logger := log.With().
+		Str("sender", sender.Hex()).
+		Logger()
+
+	currentBlockNumber, err := r.Ethereum.Client.BlockNumber(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get current block")
+		return
+	}
+	currentBlock := new(big.Int).SetUint64(currentBlockNumber)
+
+	channelIDs, err := r.Ethereum.SenderChannels(sender, util.GetFilterOpts(currentBlock))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get sender channels")
+		return
+	}
+
+	logger.Info().
+		Int("channels_count", len(channelIDs)).
+		Msg("checking channels for expiration")
+
+	reclaimed := new(big.Int)
+	for _, channelID := range channelIDs {
+		channel, err := r.Ethereum.GetChannel(channelID, util.GetCallOpts(sender, currentBlock))
+		if err != nil {
+			// Claimed channels are removed from the contract
+			continue
+		}
+		if channel.Amount.Sign() == 0 || channel.Expiration.Cmp(currentBlock) > 0 {
+			continue
+		}
+
+		// Calls must not keep signing amounts for a channel whose value returns to the sender
+		var receipt *types.Receipt
+		err = snet.ClaimChannel(r.DB, r.Ethereum.MPEAddress, channelID, func() error {
+			receipt, err = r.Ethereum.ClaimChannelTimeout(ctx, channelID, util.GetTransactOpts(r.signer))
+			return err
+		})
+		r.logAction(ActionClaimTimeout, channelID, channel.Amount, receipt, err)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("channel_id", channelID.String()).
+				Msg("failed to claim channel timeout")
+			continue
+		}
+
+		if err := r.DB.DeletePaymentChannel(r.Ethereum.MPEAddress.Hex(), channelID); err != nil {
+			logger.Warn().Err(err).Str("channel_id", channelID.String()).Msg("failed to delete reclaimed payment channel")
+		}
+
+		reclaimed.Add(reclaimed, channel.Amount)
+		logger.Info().
+			Str("channel_id", channelID.String()).
+			Str("amount", channel.Amount.String()).
+			Msg("expired channel reclaimed")
+	}
+
+	if !config.Reclaim.Withdraw || reclaimed.Sign() == 0 {
+		return
+	}
+
+	balance, err := r.Ethereum.GetMPEBalance(sender)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get MPE balance")
+		return
+	}
+	if balance.Cmp(reclaimed) < 0 {
+		reclaimed = balance
+	}
+
+	receipt, err := r.Ethereum.WithdrawFromMPE(ctx, reclaimed, util.GetTransactOpts(r.signer))
+	r.logAction(ActionWithdraw, nil, reclaimed, receipt, err)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to withdraw reclaimed funds")
+		return
+	}
+
+	logger.Info().
+		Str("amount", reclaimed.String()).
+		Msg("reclaimed funds withdrawn")
+}
+
+// logAction stores the outcome of an on-chain action in the database.
+func (r *Reclaimer) logAction(action string, channelID, amount *big.Int, receipt *types.Receipt, actionErr error) {
+	channelAction := &db.ChannelAction{
+		MPEAddress: r.Ethereum.MPEAddress.Hex(),
+		ChannelID:  channelID,
+		Action:     action,
+		Amount:     amount,
+		Status:     statusSuccess,
+	}
+	if receipt != nil {
+		txHash := receipt.TxHash.Hex()
+		channelAction.TxHash = &txHash
+	}
+	if actionErr != nil {
+		message := actionErr.Error()
+		channelAction.Status = statusFailed
+		channelAction.Error = &message
+	}
+
+	if err := r.DB.CreateChannelAction(channelAction); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("failed to log channel action")
+	}
+}
+
+// Start runs ReclaimOnce at the configured interval until the context is cancelled or Stop is called.
+func (r *Reclaimer) Start(ctx context.Context) {
+	if !config.Reclaim.Enabled {
+		log.Info().Msg("channel reclaimer is disabled")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.cancelFunc = cancel
+
+	ticker := time.NewTicker(config.Reclaim.Interval)
+	defer ticker.Stop()
+
+	log.Info().
+		Dur("interval", config.Reclaim.Interval).
+		Msg("channel reclaimer started successfully")
+
+	r.ReclaimOnce(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			log.Debug().Msg("reclaim interval triggered, checking expired channels")
+			r.ReclaimOnce(ctx)
+		case <-ctx.Done():
+			log.Info().Msg("channel reclaimer received shutdown signal, stopping")
+			return
+		}
+	}
+}
+
+// Stop stops the reclaim loop.
+func (r *Reclaimer) Stop() {
+	if r.cancelFunc != nil {
+		r.cancelFunc()
+	}
+	log.Debug().Msg("channel reclaimer stopped successfully")
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/ledger"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// adminOnly rejects requests without the admin bearer token. Admin endpoints are disabled when no token is configured.
+//
+// Parameters:
+//   - c: The Fiber context which provides the request headers.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (s *FiberServer) adminOnly(c *fiber.Ctx) error {
+	if config.App.AdminToken == "" {
+		return c.Status(fiber.StatusNotFound).SendString("admin API is disabled")
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.App.AdminToken)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).SendString("invalid admin token")
+	}
+	return c.Next()
+}
+
+// GetServiceCalls exports the call ledger as CSV or JSON.
+// The format query parameter selects the format (csv by default); user, room and service filter the calls,
+// since and until limit the period and accept RFC 3339 timestamps or dates.
+//
+// Parameters:
+//   - c: The Fiber context which provides query parameters and methods to interact with the request and response.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (s *FiberServer) GetServiceCalls(c *fiber.Ctx) error {
+	format := c.Query("format", ledger.FormatCSV)
+	if format != ledger.FormatCSV && format != ledger.FormatJSON {
+		return c.Status(fiber.StatusBadRequest).SendString("format must be csv or json")
+	}
+
+	filter := db.ServiceCallFilter{
+		MatrixUserID: c.Query("user"),
+		RoomID:       c.Query("room"),
+		ServiceID:    c.Query("service"),
+	}
+	var err error
+	if filter.Since, err = parseQueryTime(c.Query("since")); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid since: " + err.Error())
+	}
+	if filter.Until, err = parseQueryTime(c.Query("until")); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid until: " + err.Error())
+	}
+
+	calls, err := s.db.GetServiceCalls(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get service calls")
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get service calls")
+	}
+
+	var buf bytes.Buffer
+	if err := ledger.Export(&buf, calls, format); err != nil {
+		log.Error().Err(err).Msg("failed to export service calls")
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to export service calls")
+	}
+
+	c.Set(fiber.HeaderContentType, ledger.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", ledger.FileName(format, time.Now())))
+	return c.Send(buf.Bytes())
+}
+
+// parseQueryTime parses an RFC 3339 timestamp or a YYYY-MM-DD date; an empty value is the zero time.
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
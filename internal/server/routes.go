@@ -26,4 +26,10 @@ func (s *FiberServer) RegisterFiberRoutes() {
 	api.Get("/health", s.healthHandler)            // Checks the health of the server.
 	api.Get("/payment", s.GetPaymentState)         // Retrieves a payment state.
 	api.Put("/payment", s.PatchUpdatePaymentState) // Updates a payment state based on provided fields.
+
+	// Register the admin route handlers.
+	api.Get("/calls", s.adminOnly, s.GetServiceCalls)         // Exports the call ledger as CSV or JSON.
+	api.Get("/sync/scope", s.adminOnly, s.GetSyncScope)       // Retrieves the organizations and services synced.
+	api.Put("/sync/scope", s.adminOnly, s.PutSyncScope)       // Changes the organizations and services synced and resyncs them.
+	api.Delete("/sync/scope", s.adminOnly, s.DeleteSyncScope) // Restores the configured organizations and services synced and resyncs them.
 }
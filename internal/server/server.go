@@ -2,13 +2,15 @@ package server
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
 )
 
 // FiberServer represents the server that uses the Fiber web framework.
 type FiberServer struct {
-	App *fiber.App // Embeds the Fiber application instance.
-	db  db.Service // Database service for the server.
+	App    *fiber.App         // Embeds the Fiber application instance.
+	db     db.Service         // Database service for the server.
+	syncer *syncer.SnetSyncer // Syncer whose scope the admin API changes.
 }
 
 // New creates and returns a new instance of FiberServer.
@@ -16,13 +18,15 @@ type FiberServer struct {
 //
 // Parameters:
 //   - db: An instance of db.Service which provides database-related functionalities.
+//   - snetSyncer: The syncer whose scope the admin API changes.
 //
 // Returns:
 //   - A pointer to the initialized FiberServer instance.
-func New(db db.Service) *FiberServer {
+func New(db db.Service, snetSyncer *syncer.SnetSyncer) *FiberServer {
 	server := &FiberServer{
-		App: fiber.New(), // Initializes the Fiber application.
-		db:  db,          // Sets the provided database service.
+		App:    fiber.New(), // Initializes the Fiber application.
+		db:     db,          // Sets the provided database service.
+		syncer: snetSyncer,  // Sets the syncer.
 	}
 
 	return server
@@ -7,6 +7,7 @@ import (
 
 // GetServices handles the endpoint for retrieving a list of services.
 // It fetches the services from the database and returns them as a JSON response.
+// Services removed from the registry are included only with the deleted=true query parameter.
 //
 // Parameters:
 //   - c: The Fiber context which provides methods to interact with the request and response.
@@ -14,7 +15,7 @@ import (
 // Returns:
 //   - error: An error if the operation fails or nil if the operation is successful.
 func (s *FiberServer) GetServices(c *fiber.Ctx) error {
-	services, err := s.db.GetSnetServices()
+	services, err := s.db.GetSnetServices(c.QueryBool("deleted"))
 	if err != nil {
 		log.Error().Err(err).Msg("cannot get services")
 		return c.Status(fiber.StatusInternalServerError).SendString("failed to retrieve services")
@@ -24,6 +25,7 @@ func (s *FiberServer) GetServices(c *fiber.Ctx) error {
 
 // GetOrgs handles the endpoint for retrieving a list of organizations.
 // It fetches the organizations from the database and returns them as a JSON response.
+// Organizations removed from the registry are included only with the deleted=true query parameter.
 //
 // Parameters:
 //   - c: The Fiber context which provides methods to interact with the request and response.
@@ -31,7 +33,7 @@ func (s *FiberServer) GetServices(c *fiber.Ctx) error {
 // Returns:
 //   - error: An error if the operation fails or nil if the operation is successful.
 func (s *FiberServer) GetOrgs(c *fiber.Ctx) error {
-	orgs, err := s.db.GetSnetOrgs()
+	orgs, err := s.db.GetSnetOrgs(c.QueryBool("deleted"))
 	if err != nil {
 		log.Error().Err(err).Msg("cannot get orgs")
 		return c.Status(fiber.StatusInternalServerError).SendString("failed to retrieve organizations")
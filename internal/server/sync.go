@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
+)
+
+// GetSyncScope returns the organizations and services the syncer syncs.
+//
+// Parameters:
+//   - c: The Fiber context which provides methods to interact with the request and response.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (s *FiberServer) GetSyncScope(c *fiber.Ctx) error {
+	return c.JSON(s.syncer.Scope())
+}
+
+// PutSyncScope replaces the organizations and services the syncer syncs with the scope in the request body,
+// stores it so it applies after restarts, and brings the synced services in line with it in the background.
+//
+// Parameters:
+//   - c: The Fiber context which provides methods to interact with the request and response.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (s *FiberServer) PutSyncScope(c *fiber.Ctx) error {
+	var scope syncer.Scope
+	if err := c.BodyParser(&scope); err != nil {
+		log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).SendString("invalid input")
+	}
+	if err := scope.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := s.syncer.SetScope(scope); err != nil {
+		log.Error().Err(err).Msg("failed to change sync scope")
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to change sync scope")
+	}
+
+	s.resyncScope()
+	return c.Status(fiber.StatusAccepted).JSON(scope)
+}
+
+// DeleteSyncScope drops the scope changed through PutSyncScope, restoring the configured one,
+// and brings the synced services in line with it in the background.
+//
+// Parameters:
+//   - c: The Fiber context which provides methods to interact with the request and response.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (s *FiberServer) DeleteSyncScope(c *fiber.Ctx) error {
+	scope, err := s.syncer.ResetScope()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to reset sync scope")
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to reset sync scope")
+	}
+
+	s.resyncScope()
+	return c.Status(fiber.StatusAccepted).JSON(scope)
+}
+
+// resyncScope applies a changed sync scope in the background.
+func (s *FiberServer) resyncScope() {
+	go func() {
+		if err := s.syncer.ResyncScope(context.Background()); err != nil {
+			log.Error().Err(err).Msg("failed to resync after sync scope change")
+		}
+	}()
+}
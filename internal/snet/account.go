@@ -0,0 +1,204 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/wallet"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+// errWalletRequired is returned when the admin account may not pay for a user without a wallet
+var errWalletRequired = errors.New("you have no wallet yet, create one with !account create and fund it")
+
+// accountUsage describes the !account command and who pays for the calls of users without a wallet
+const accountUsage = "Usage: !account [balance|create|link <address>|deposit <AGIX>]\n" +
+	"Calls are paid from the MPE balance of your wallet once you created one; until then they are paid by the server account unless the server requires a wallet."
+
+// resolveSigner returns the signer used to pay for calls of a Matrix user.
+// Users without a wallet fall back to the admin signer unless wallets are required.
+func resolveSigner(wallets *wallet.Manager, matrixUserID string) (signer.Signer, error) {
+	if wallets.Enabled() && matrixUserID != "" {
+		privateKey, err := wallets.PrivateKey(matrixUserID)
+		if err == nil {
+			return signer.NewLocal(privateKey), nil
+		}
+		if !errors.Is(err, wallet.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	if config.Wallets.Required {
+		return nil, errWalletRequired
+	}
+
+	return signer.Admin()
+}
+
+// commandArgs returns the words following the command name in a bot command message
+func commandArgs(c mxbot.CommandCtx) []string {
+	fields := strings.Fields(c.Event().Content.AsMessage().Body)
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[1:]
+}
+
+// accountCommand handles the !account command letting users create, link and inspect their wallet
+func accountCommand(eth blockchain.Ethereum, wallets *wallet.Manager) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "account").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", string(c.Event().RoomID)).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("account command received")
+
+		var answer string
+		switch {
+		case !wallets.Enabled():
+			answer = "User wallets are disabled on this server."
+		case len(args) > 0 && args[0] == "create":
+			w, err := wallets.Create(sender)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to create wallet")
+				answer = "Failed to create wallet."
+				break
+			}
+			answer = fmt.Sprintf("Your wallet address is %s. Send ETH for gas and AGIX to it, then move the AGIX to your MPE balance with !account deposit <AGIX> to pay for service calls.", w.Address)
+		case len(args) > 1 && args[0] == "link":
+			w, err := wallets.Link(sender, args[1])
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to link address")
+				answer = fmt.Sprintf("Failed to link address: %v", err)
+				break
+			}
+			answer = fmt.Sprintf("Address %s is linked to your wallet %s. Channels you open from it through the payment gateway pay for your calls.", *w.LinkedAddress, w.Address)
+		case len(args) == 2 && args[0] == "deposit":
+			amount, err := parseAgix(args[1])
+			if err != nil {
+				answer = fmt.Sprintf("Invalid amount: %v", err)
+				break
+			}
+			answer = depositWalletFunds(eth, wallets, sender, amount)
+		case len(args) == 0 || args[0] == "balance":
+			answer = accountSummary(eth, wallets, sender)
+		default:
+			answer = accountUsage
+		}
+
+		err := c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send account answer")
+		}
+		return err
+	}
+}
+
+// depositWalletFunds deposits AGIX held by the wallet of a Matrix user to its MPE balance, so channels can be opened from it
+func depositWalletFunds(eth blockchain.Ethereum, wallets *wallet.Manager, matrixUserID string, amount *big.Int) string {
+	logger := log.With().
+		Str("amount", amount.String()).
+		Str("sender", matrixUserID).
+		Logger()
+
+	privateKey, err := wallets.PrivateKey(matrixUserID)
+	if errors.Is(err, wallet.ErrNotFound) {
+		return "You have no wallet yet. Create one with !account create."
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get wallet key")
+		return "Failed to get wallet."
+	}
+	walletSigner := signer.NewLocal(privateKey)
+	address := walletSigner.Address()
+
+	ctx, cancel := context.WithTimeout(context.Background(), walletTxTimeout)
+	defer cancel()
+
+	opts := &blockchain.BindOpts{
+		Call:     util.GetCallOpts(address, nil),
+		Transact: util.GetTransactOpts(walletSigner),
+	}
+	r, err := eth.DepositToMPE(ctx, amount, opts)
+	var shortfall *blockchain.TokenShortfallError
+	if errors.As(err, &shortfall) {
+		return fmt.Sprintf("Your wallet holds only %s AGIX. Send AGIX to %s first.", util.CogToAgix(shortfall.Balance), address.Hex())
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to deposit to MPE")
+		return fmt.Sprintf("Deposit failed: %v", err)
+	}
+
+	logger.Info().
+		Str("tx_hash", r.TxHash.Hex()).
+		Msg("wallet MPE balance changed")
+
+	answer := fmt.Sprintf("Deposit of %s AGIX confirmed in transaction %s.", util.CogToAgix(amount), r.TxHash.Hex())
+	if balance, err := eth.GetMPEBalance(address); err == nil {
+		answer += fmt.Sprintf("\nMPE balance: %s AGIX", util.CogToAgix(balance))
+	}
+	return answer
+}
+
+// accountSummary describes the wallet of a Matrix user with its on-chain balances
+func accountSummary(eth blockchain.Ethereum, wallets *wallet.Manager, matrixUserID string) string {
+	w, err := wallets.Get(matrixUserID)
+	if errors.Is(err, wallet.ErrNotFound) {
+		return "You have no wallet yet. Create one with !account create."
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get wallet")
+		return "Failed to get wallet."
+	}
+
+	address := common.HexToAddress(w.Address)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Address: %s\n", w.Address)
+	if w.LinkedAddress != nil {
+		fmt.Fprintf(&b, "Linked address: %s\n", *w.LinkedAddress)
+	}
+
+	ethBalance, err := eth.Client.BalanceAt(context.Background(), address, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get ETH balance")
+		b.WriteString("ETH balance: unavailable\n")
+	} else {
+		fmt.Fprintf(&b, "ETH balance: %s wei\n", ethBalance)
+	}
+
+	if eth.Token != nil {
+		tokenBalance, err := eth.Token.BalanceOf(nil, address)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get token balance")
+			b.WriteString("Token balance: unavailable\n")
+		} else {
+			fmt.Fprintf(&b, "Token balance: %s AGIX\n", util.CogToAgix(tokenBalance))
+		}
+	}
+
+	mpeBalance, err := eth.GetMPEBalance(address)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get MPE balance")
+		b.WriteString("MPE balance: unavailable")
+	} else {
+		fmt.Fprintf(&b, "MPE balance: %s cogs", mpeBalance)
+	}
+	return b.String()
+}
@@ -0,0 +1,349 @@
+package snet
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+// walletTxTimeout limits how long the !wallet command waits for a deposit or withdrawal to be mined
+const walletTxTimeout = 2 * time.Minute
+
+// isAdmin reports whether a Matrix user is one of the configured admins
+func isAdmin(matrixUserID string) bool {
+	return slices.Contains(config.Matrix.AdminIDs, matrixUserID)
+}
+
+// parseAgix converts a positive AGIX amount with at most 8 decimal places to cogs
+func parseAgix(amount string) (*big.Int, error) {
+	value, err := decimal.NewFromString(amount)
+	if err != nil || !value.IsPositive() {
+		return nil, fmt.Errorf("%q is not a positive AGIX amount", amount)
+	}
+	if value.Exponent() < -8 {
+		return nil, fmt.Errorf("%q has more than 8 decimal places", amount)
+	}
+	return util.AgixToCog(amount)
+}
+
+// walletCommand handles the admin-only !wallet command showing and moving the MPE balance of the admin account
+func walletCommand(eth blockchain.Ethereum) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "wallet").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", string(c.Event().RoomID)).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("wallet command received")
+
+		if !isAdmin(sender) {
+			return c.TextAnswer("This command is available to admins only.")
+		}
+
+		var answer string
+		switch {
+		case len(args) == 0 || (len(args) == 1 && args[0] == "balance"):
+			answer = adminWalletSummary(eth)
+		case len(args) == 2 && (args[0] == "deposit" || args[0] == "withdraw"):
+			amount, err := parseAgix(args[1])
+			if err != nil {
+				answer = fmt.Sprintf("Invalid amount: %v", err)
+				break
+			}
+			answer = moveAdminFunds(eth, args[0], amount, sender)
+		default:
+			answer = "Usage: !wallet [balance|deposit <AGIX>|withdraw <AGIX>]"
+		}
+
+		err := c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send wallet answer")
+		}
+		return err
+	}
+}
+
+// adminWalletSummary describes the token and MPE balances of the admin account
+func adminWalletSummary(eth blockchain.Ethereum) string {
+	adminSigner, err := signer.Admin()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get admin signer")
+		return "Failed to get the admin account."
+	}
+	address := adminSigner.Address()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Address: %s\n", address.Hex())
+
+	if eth.Token != nil {
+		tokenBalance, err := eth.Token.BalanceOf(nil, address)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get token balance")
+			b.WriteString("Token balance: unavailable\n")
+		} else {
+			fmt.Fprintf(&b, "Token balance: %s AGIX\n", util.CogToAgix(tokenBalance))
+		}
+	}
+
+	mpeBalance, err := eth.GetMPEBalance(address)
+	if err != nil {
+		b.WriteString("MPE balance: unavailable")
+	} else {
+		fmt.Fprintf(&b, "MPE balance: %s AGIX", util.CogToAgix(mpeBalance))
+	}
+	return b.String()
+}
+
+// moveAdminFunds deposits tokens of the admin account to its MPE balance or withdraws them from it
+func moveAdminFunds(eth blockchain.Ethereum, action string, amount *big.Int, matrixUserID string) string {
+	logger := log.With().
+		Str("action", action).
+		Str("amount", amount.String()).
+		Str("sender", matrixUserID).
+		Logger()
+
+	adminSigner, err := signer.Admin()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get admin signer")
+		return "Failed to get the admin account."
+	}
+	address := adminSigner.Address()
+
+	ctx, cancel := context.WithTimeout(context.Background(), walletTxTimeout)
+	defer cancel()
+
+	var txHash common.Hash
+	switch action {
+	case "deposit":
+		opts := &blockchain.BindOpts{
+			Call:     util.GetCallOpts(address, nil),
+			Transact: util.GetTransactOpts(adminSigner),
+		}
+		r, err := eth.DepositToMPE(ctx, amount, opts)
+		var shortfall *blockchain.TokenShortfallError
+		if errors.As(err, &shortfall) {
+			return fmt.Sprintf("The admin account holds only %s AGIX.", util.CogToAgix(shortfall.Balance))
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to deposit to MPE")
+			return fmt.Sprintf("Deposit failed: %v", err)
+		}
+		txHash = r.TxHash
+	default:
+		balance, err := eth.GetMPEBalance(address)
+		if err != nil {
+			return "Failed to get the MPE balance."
+		}
+		if balance.Cmp(amount) < 0 {
+			return fmt.Sprintf("The MPE balance is only %s AGIX.", util.CogToAgix(balance))
+		}
+		r, err := eth.WithdrawFromMPE(ctx, amount, util.GetTransactOpts(adminSigner))
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to withdraw from MPE")
+			return fmt.Sprintf("Withdrawal failed: %v", err)
+		}
+		txHash = r.TxHash
+	}
+
+	logger.Info().
+		Str("tx_hash", txHash.Hex()).
+		Msg("admin MPE balance changed")
+
+	answer := fmt.Sprintf("%s of %s AGIX confirmed in transaction %s.", strings.ToUpper(action[:1])+action[1:], util.CogToAgix(amount), txHash.Hex())
+	if balance, err := eth.GetMPEBalance(address); err == nil {
+		answer += fmt.Sprintf("\nMPE balance: %s AGIX", util.CogToAgix(balance))
+	}
+	return answer
+}
+
+// channelsCommand handles the admin-only !channels command listing the open payment channels of the admin account
+func channelsCommand(eth blockchain.Ethereum, database db.Service) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "channels").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+
+		logger.Debug().
+			Str("room", string(c.Event().RoomID)).
+			Str("sender", sender).
+			Msg("channels command received")
+
+		if !isAdmin(sender) {
+			return c.TextAnswer("This command is available to admins only.")
+		}
+
+		answer, err := adminChannelsSummary(eth, database)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to list channels")
+			answer = "Failed to list payment channels."
+		}
+
+		err = c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send channels answer")
+		}
+		return err
+	}
+}
+
+// adminChannelsSummary describes every payment channel of the admin account still held by the MPE contract
+func adminChannelsSummary(eth blockchain.Ethereum, database db.Service) (string, error) {
+	adminSigner, err := signer.Admin()
+	if err != nil {
+		return "", err
+	}
+	address := adminSigner.Address()
+
+	currentBlockNumber, err := eth.Client.BlockNumber(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to get current block: %w", err)
+	}
+	currentBlock := new(big.Int).SetUint64(currentBlockNumber)
+
+	channelIDs, err := eth.SenderChannels(address, util.GetFilterOpts(currentBlock))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	total := new(big.Int)
+	count := 0
+	for _, channelID := range channelIDs {
+		channel, err := eth.GetChannel(channelID, util.GetCallOpts(address, currentBlock))
+		if err != nil {
+			// Claimed channels are removed from the contract
+			continue
+		}
+		count++
+		total.Add(total, channel.Amount)
+
+		state := "open"
+		if channel.Expiration.Cmp(currentBlock) <= 0 {
+			state = "expired"
+		}
+		groupID := base64.StdEncoding.EncodeToString(channel.GroupId[:])
+		fmt.Fprintf(&b, "#%s group %s: %s AGIX, nonce %s, expires at block %s (%s)",
+			channelID, groupID, util.CogToAgix(channel.Amount), channel.Nonce, channel.Expiration, state)
+
+		stored, err := database.GetPaymentChannel(eth.MPEAddress.Hex(), address.Hex(), channel.Recipient.Hex(), groupID)
+		if err == nil && stored != nil && stored.ChannelID != nil && stored.ChannelID.Cmp(channelID) == 0 && stored.SignedAmount != nil {
+			fmt.Fprintf(&b, ", signed %s AGIX", util.CogToAgix(stored.SignedAmount))
+		}
+		b.WriteString("\n")
+	}
+
+	if count == 0 {
+		return "The admin account has no payment channels.", nil
+	}
+	fmt.Fprintf(&b, "%d channels holding %s AGIX in total.", count, util.CogToAgix(total))
+	return b.String(), nil
+}
+
+// scopeUsage explains the !scope command
+const scopeUsage = "Usage: !scope [reset|orgs|services|tags|exclude-orgs|exclude-services [<id or pattern>,...]]"
+
+// scopeCommand handles the admin-only !scope command showing and changing the organizations and services synced.
+// A changed scope is stored and applied right away by a resync of the services it adds or drops.
+func scopeCommand(snetSyncer *syncer.SnetSyncer) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "scope").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", string(c.Event().RoomID)).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("scope command received")
+
+		if !isAdmin(sender) {
+			return c.TextAnswer("This command is available to admins only.")
+		}
+
+		var answer string
+		if len(args) == 0 {
+			answer = "Sync scope:\n" + snetSyncer.Scope().String()
+		} else if scope, ok := changeScope(snetSyncer.Scope(), args); !ok {
+			answer = scopeUsage
+		} else if scope, err := storeScope(snetSyncer, scope, args[0] == "reset"); err != nil {
+			answer = fmt.Sprintf("Failed to change the sync scope: %v", err)
+		} else {
+			logger.Info().
+				Str("sender", sender).
+				Interface("scope", scope).
+				Msg("sync scope changed")
+			go func() {
+				if err := snetSyncer.ResyncScope(context.Background()); err != nil {
+					logger.Error().Err(err).Msg("failed to resync after sync scope change")
+				}
+			}()
+			answer = "Sync scope changed, services are being resynced:\n" + scope.String()
+		}
+
+		err := c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send scope answer")
+		}
+		return err
+	}
+}
+
+// storeScope makes the changed scope the one synced, or drops the changes on reset so the configured scope applies again.
+func storeScope(snetSyncer *syncer.SnetSyncer, scope syncer.Scope, reset bool) (syncer.Scope, error) {
+	if reset {
+		return snetSyncer.ResetScope()
+	}
+	return scope, snetSyncer.SetScope(scope)
+}
+
+// changeScope returns the scope with the list named by the first argument replaced by the IDs or patterns following it,
+// separated by commas or spaces. Without values the list is cleared; reset restores the configured scope.
+func changeScope(scope syncer.Scope, args []string) (syncer.Scope, bool) {
+	if len(args) == 1 && args[0] == "reset" {
+		return syncer.ConfiguredScope(), true
+	}
+
+	values := strings.FieldsFunc(strings.Join(args[1:], " "), func(r rune) bool { return r == ',' || r == ' ' })
+	switch args[0] {
+	case "orgs":
+		scope.Orgs = values
+	case "services":
+		scope.Services = values
+	case "tags":
+		scope.Tags = values
+	case "exclude-orgs":
+		scope.ExcludeOrgs = values
+	case "exclude-services":
+		scope.ExcludeServices = values
+	default:
+		return scope, false
+	}
+	return scope, true
+}
@@ -1,19 +1,25 @@
 package snet
 
 import (
+	"sync"
+
 	"github.com/rs/zerolog/log"
 	"github.com/tensved/bobrix"
 	"github.com/tensved/bobrix/contracts"
 	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/budget"
+	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/internal/matrix"
 	"github.com/tensved/snet-matrix-framework/internal/syncer"
+	"github.com/tensved/snet-matrix-framework/internal/wallet"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"maunium.net/go/mautrix/event"
 )
 
-func NewSNETBot(credentials *mxbot.BotCredentials, matrix matrix.Service, eth blockchain.Ethereum, database db.Service, grpc *grpcmanager.GRPCClientManager, fileDescriptors map[string][]protoreflect.FileDescriptor) (*bobrix.Bobrix, error) {
+func NewSNETBot(credentials *mxbot.BotCredentials, matrix matrix.Service, eth blockchain.Ethereum, database db.Service, grpc *grpcmanager.GRPCClientManager, snetSyncer *syncer.SnetSyncer) (*bobrix.Bobrix, error) {
 	logger := log.With().
 		Str("bot_name", "snet").
 		Str("username", credentials.Username).
@@ -35,7 +41,7 @@ func NewSNETBot(credentials *mxbot.BotCredentials, matrix matrix.Service, eth bl
 				Str("sender", c.Event().Sender.String()).
 				Msg("info command received")
 
-			info := syncer.GetSnetServicesInfo(fileDescriptors)
+			info := syncer.GetSnetServicesInfo(snetSyncer.FileDescriptors())
 			logger.Debug().
 				Str("info", info).
 				Msg("snet services info generated")
@@ -107,31 +113,169 @@ func NewSNETBot(credentials *mxbot.BotCredentials, matrix matrix.Service, eth bl
 		}),
 	)
 
+	wallets := wallet.NewManager(database, config.Wallets.EncryptionKey)
+	bot.AddCommand(mxbot.NewCommand(
+		"account",
+		accountCommand(eth, wallets),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Your wallet for paying for snet services: !account [balance|create|link <address>|deposit <AGIX>]",
+				"ru": "Ваш кошелёк для оплаты сервисов SNET: !account [balance|create|link <address>|deposit <AGIX>]",
+			},
+		}),
+	)
+
+	budgets := budget.NewManager(database, config.Budgets)
+	pending := newPendingCalls()
+	bot.AddCommand(mxbot.NewCommand(
+		"budget",
+		budgetCommand(budgets, pending),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Your remaining spending allowance: !budget [confirm]",
+				"ru": "Оставшийся лимит расходов: !budget [confirm]",
+			},
+		}),
+	)
+
+	bot.AddEventHandler(
+		mxbot.NewEventHandler(event.EventReaction, quoteReactionHandler(matrix, pending)),
+	)
+	bot.AddCommand(mxbot.NewCommand(
+		"quote",
+		quoteCommand(database),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Price below which calls in this room run without confirmation: !quote [threshold <AGIX>|default]",
+				"ru": "Цена, ниже которой вызовы в этой комнате выполняются без подтверждения: !quote [threshold <AGIX>|default]",
+			},
+		}),
+	)
+	bot.AddCommand(mxbot.NewCommand(
+		"group",
+		groupCommand(database),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Payment groups of a service and the one your calls use: !group <service_id> [<group_name>|auto]",
+				"ru": "Платёжные группы сервиса и группа для ваших вызовов: !group <service_id> [<group_name>|auto]",
+			},
+		}),
+	)
+
+	bot.AddCommand(mxbot.NewCommand(
+		"calls",
+		callsCommand(database, matrix),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Export your service calls with their costs: !calls [csv|json] [days]",
+				"ru": "Выгрузка ваших вызовов сервисов с их стоимостью: !calls [csv|json] [days]",
+			},
+		}),
+	)
+
+	bot.AddCommand(mxbot.NewCommand(
+		"wallet",
+		walletCommand(eth),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Admin only: MPE balance of the admin account: !wallet [balance|deposit <AGIX>|withdraw <AGIX>]",
+				"ru": "Только для администраторов: баланс MPE аккаунта администратора: !wallet [balance|deposit <AGIX>|withdraw <AGIX>]",
+			},
+		}),
+	)
+	bot.AddCommand(mxbot.NewCommand(
+		"channels",
+		channelsCommand(eth, database),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Admin only: payment channels of the admin account",
+				"ru": "Только для администраторов: платёжные каналы аккаунта администратора",
+			},
+		}),
+	)
+
+	bot.AddCommand(mxbot.NewCommand(
+		"scope",
+		scopeCommand(snetSyncer),
+		mxbot.CommandConfig{
+			Prefix: "!",
+			Description: map[string]string{
+				"en": "Admin only: organizations and services synced: !scope [reset|orgs|services|tags|exclude-orgs|exclude-services [<id or pattern>,...]]",
+				"ru": "Только для администраторов: синхронизируемые организации и сервисы: !scope [reset|orgs|services|tags|exclude-orgs|exclude-services [<id или шаблон>,...]]",
+			},
+		}),
+	)
+
 	callStates := make(map[string]*CallState)
 
 	bobr := bobrix.NewBobrix(bot)
-	bobr.SetContractParser(Parser(matrix, eth, database, callStates, bobr, grpc))
+	descriptorCache := NewDescriptorCache(database)
+	bobr.SetContractParser(Parser(matrix, eth, database, callStates, bobr, grpc, wallets, budgets, pending, descriptorCache, snetSyncer))
 
-	// Connect services to the bot from file descriptors.
-	if len(fileDescriptors) > 0 && bobr != nil && database != nil && grpc != nil {
+	// Connect services to the bot from file descriptors, those synced in the background are connected once they are synced.
+	var connectMu sync.Mutex           // A mutex to ensure thread-safe access to connected.
+	connected := make(map[string]bool) // The Snet IDs of the services connected to bobrix, true while they are synced.
+	connect := func(fileDescriptors map[string][]protoreflect.FileDescriptor) {
+		connectMu.Lock()
+		defer connectMu.Unlock()
+		removeServices(fileDescriptors, connected)
+		if len(fileDescriptors) == 0 || bobr == nil || database == nil || grpc == nil {
+			logger.Warn().Msg("no services to connect or missing dependencies")
+			return
+		}
 		logger.Info().
 			Int("services_count", len(fileDescriptors)).
 			Msg("connecting services to bot")
-		createServices(bobr, fileDescriptors, eth, database, grpc)
-	} else {
-		logger.Warn().Msg("no services to connect or missing dependencies")
+		createServices(bobr, fileDescriptors, connected, eth, database, grpc, descriptorCache)
 	}
+	snetSyncer.OnUpdate(connect)
+	connect(snetSyncer.FileDescriptors())
 
 	logger.Info().Msg("SNET bot initialization completed")
 	return bobr, nil
 }
 
-func createServices(bobr *bobrix.Bobrix, fileDescriptors map[string][]protoreflect.FileDescriptor, eth blockchain.Ethereum, database db.Service, grpc *grpcmanager.GRPCClientManager) {
+// removeServices marks the connected services that are no longer synced, e.g. those deleted from the registry.
+// Bobrix offers no way to disconnect a service, so they stay connected and their calls are refused by the parser,
+// which accepts synced services only. A service that returns is served again without connecting it a second time.
+func removeServices(fileDescriptors map[string][]protoreflect.FileDescriptor, connected map[string]bool) {
+	for snetIDOfService, synced := range connected {
+		if _, ok := fileDescriptors[snetIDOfService]; ok || !synced {
+			continue
+		}
+		connected[snetIDOfService] = false
+		log.Info().
+			Str("snet_id", snetIDOfService).
+			Msg("service no longer synced, its calls are refused")
+	}
+}
+
+// createServices connects the services of the file descriptors to the bot, skipping those in connected,
+// and adds the Snet IDs of the connected ones to it. Services connected before are marked synced again.
+func createServices(bobr *bobrix.Bobrix, fileDescriptors map[string][]protoreflect.FileDescriptor, connected map[string]bool, eth blockchain.Ethereum, database db.Service, grpc *grpcmanager.GRPCClientManager, descriptorCache *DescriptorCache) {
 	logger := log.With().
 		Int("total_services", len(fileDescriptors)).
 		Logger()
 
 	for snetIDOfService, descriptors := range fileDescriptors {
+		if synced, ok := connected[snetIDOfService]; ok {
+			if !synced {
+				connected[snetIDOfService] = true
+				logger.Info().
+					Str("snet_id", snetIDOfService).
+					Msg("service synced again, its calls are accepted")
+			}
+			continue
+		}
+		connected[snetIDOfService] = true
+
 		logger.Debug().
 			Str("snet_id", snetIDOfService).
 			Int("descriptors_count", len(descriptors)).
@@ -171,7 +315,7 @@ func createServices(bobr *bobrix.Bobrix, fileDescriptors map[string][]protorefle
 					Str("descriptor", string(descriptor.FullName())).
 					Msg("connecting service")
 
-				bobr.ConnectService(NewService(serviceDescriptor, string(descriptor.FullName()), snetIDOfService, string(serviceName), eth, database, grpc), func(ctx mxbot.Ctx, r *contracts.MethodResponse, _ any) {
+				bobr.ConnectService(NewService(serviceDescriptor, string(descriptor.FullName()), snetIDOfService, string(serviceName), eth, database, grpc, descriptorCache), func(ctx mxbot.Ctx, r *contracts.MethodResponse, _ any) {
 					if r == nil {
 						logger.Error().Msg("service returned nil response")
 						_ = ctx.TextAnswer("Unexpected error")
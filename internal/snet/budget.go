@@ -0,0 +1,144 @@
+package snet
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/budget"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// pendingCallTTL limits how long a call waits for the user's confirmation
+const pendingCallTTL = 5 * time.Minute
+
+// pendingCall is a call waiting for the user's confirmation
+type pendingCall struct {
+	run       func()
+	expiresAt time.Time
+}
+
+// pendingCalls stores calls waiting for confirmation per user and room
+type pendingCalls struct {
+	calls map[string]pendingCall // A map to store calls by user and room.
+	mu    sync.Mutex             // A mutex to ensure thread-safe access to the calls map.
+}
+
+// newPendingCalls creates an empty pending call store
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{
+		calls: make(map[string]pendingCall),
+	}
+}
+
+// pendingCallKey builds the key of the pending call of a user in a room
+func pendingCallKey(matrixUserID, roomID string) string {
+	return matrixUserID + " " + roomID
+}
+
+// put stores a call until it is confirmed, replacing the previous one
+func (p *pendingCalls) put(key string, run func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls[key] = pendingCall{
+		run:       run,
+		expiresAt: time.Now().Add(pendingCallTTL),
+	}
+}
+
+// take removes and returns a call that has not expired yet
+func (p *pendingCalls) take(key string) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	call, ok := p.calls[key]
+	delete(p.calls, key)
+	if !ok || time.Now().After(call.expiresAt) {
+		return nil
+	}
+	return call.run
+}
+
+// callPrice returns the amount a successful call was paid with; free calls cost nothing
+func callPrice(result interface{}, snetService *db.SnetService) int64 {
+	if resultMap, ok := result.(map[string]interface{}); ok && resultMap["strategy"] == "free-call" {
+		return 0
+	}
+	return int64(snetService.Price)
+}
+
+// callCost returns the amount a call is charged to the budgets: its price, or the value the call added to payment channels
+// on-chain when that is larger, since funding channels is what takes tokens from the account paying for the calls.
+// Failed calls are charged their funding only.
+func callCost(result interface{}, snetService *db.SnetService, funding *big.Int) int64 {
+	var price int64
+	if result != nil {
+		price = callPrice(result, snetService)
+	}
+	if !funding.IsInt64() {
+		return math.MaxInt64
+	}
+	return max(price, funding.Int64())
+}
+
+// budgetCommand handles the !budget command showing the remaining allowance and confirming calls over a limit
+func budgetCommand(budgets *budget.Manager, pending *pendingCalls) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "budget").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		roomID := string(c.Event().RoomID)
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", roomID).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("budget command received")
+
+		if len(args) > 0 && args[0] == "confirm" {
+			run := pending.take(pendingCallKey(sender, roomID))
+			if run == nil {
+				return c.TextAnswer("There is no call waiting for confirmation.")
+			}
+			go run()
+			return c.TextAnswer("Call confirmed.")
+		}
+
+		allowances, err := budgets.Allowances(sender, roomID)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to get allowances")
+			return c.TextAnswer("Failed to get budget.")
+		}
+		if len(allowances) == 0 {
+			return c.TextAnswer("No spending limits are configured.")
+		}
+
+		var b strings.Builder
+		for _, allowance := range allowances {
+			window := "Daily"
+			if allowance.Window == budget.WindowMonthly {
+				window = "Monthly"
+			}
+			scope := "you"
+			if allowance.Scope == budget.ScopeRoom {
+				scope = "this room"
+			}
+			fmt.Fprintf(&b, "%s limit for %s: %d of %d cogs left\n", window, scope, allowance.Remaining(), allowance.Amount)
+		}
+
+		err = c.TextAnswer(strings.TrimSuffix(b.String(), "\n"))
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send budget answer")
+		}
+		return err
+	}
+}
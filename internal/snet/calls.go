@@ -0,0 +1,76 @@
+package snet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/ledger"
+	"github.com/tensved/snet-matrix-framework/internal/matrix"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// defaultCallsDays is how many days back the !calls command exports without an explicit period
+const defaultCallsDays = 30
+
+// callsCommand handles the !calls command sending users the ledger of their own service calls as a file
+func callsCommand(database db.Service, mx matrix.Service) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "calls").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		roomID := c.Event().RoomID
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", string(roomID)).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("calls command received")
+
+		format := ledger.FormatCSV
+		days := defaultCallsDays
+		for _, arg := range args {
+			switch arg {
+			case ledger.FormatCSV, ledger.FormatJSON:
+				format = arg
+			default:
+				n, err := strconv.Atoi(arg)
+				if err != nil || n <= 0 {
+					return c.TextAnswer("Usage: !calls [csv|json] [days]")
+				}
+				days = n
+			}
+		}
+
+		now := time.Now()
+		calls, err := database.GetServiceCalls(db.ServiceCallFilter{
+			MatrixUserID: sender,
+			Since:        now.AddDate(0, 0, -days),
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to get service calls")
+			return c.TextAnswer("Failed to get your calls.")
+		}
+		if len(calls) == 0 {
+			return c.TextAnswer(fmt.Sprintf("You made no service calls in the last %d days.", days))
+		}
+
+		var buf bytes.Buffer
+		if err := ledger.Export(&buf, calls, format); err != nil {
+			logger.Error().Err(err).Msg("failed to export service calls")
+			return c.TextAnswer("Failed to export your calls.")
+		}
+
+		_, err = mx.SendFile(roomID, ledger.FileName(format, now), ledger.ContentType(format), buf.Bytes())
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send calls export")
+		}
+		return err
+	}
+}
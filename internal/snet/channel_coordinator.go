@@ -0,0 +1,231 @@
+package snet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// Channel locking modes
+const (
+	ChannelLockingMemory   = "memory"   // Amounts are serialized within this process only.
+	ChannelLockingPostgres = "postgres" // Amounts are also serialized with row locks for processes sharing the database.
+)
+
+// channelAmount is the last amount handed out for a payment channel
+type channelAmount struct {
+	mu           sync.Mutex // Held from reserving an amount until the reservation is released.
+	nonce        *big.Int   // The nonce the amount was signed for.
+	signedAmount *big.Int   // The highest amount kept for the nonce.
+	claiming     bool       // Whether the channel is being claimed on-chain, no amounts are reserved meanwhile.
+}
+
+// errChannelClaiming is returned when an amount is reserved for a channel that is being claimed
+var errChannelClaiming = errors.New("payment channel is being claimed")
+
+// channelCoordinator serializes signed-amount increments per payment channel.
+// Calls of several Matrix users may pay from the same channel; without coordination each of them
+// adds its price to the same amount read from the daemon and all but one are rejected.
+type channelCoordinator struct {
+	channels map[string]*channelAmount // A map to store the amounts by MPE address and channel ID.
+	mu       sync.Mutex                // A mutex to ensure thread-safe access to the channels map.
+}
+
+// channelAmounts is shared by all payment handlers of the process
+var channelAmounts = &channelCoordinator{
+	channels: make(map[string]*channelAmount),
+}
+
+// channelReservation is an amount handed out for a channel; the channel stays locked until it is released
+type channelReservation struct {
+	database     db.Service
+	mpeAddress   common.Address
+	channelID    *big.Int
+	state        *channelAmount
+	lock         db.PaymentChannelLock
+	nonce        *big.Int
+	signedAmount *big.Int // The amount to sign.
+}
+
+// channelKey builds the key of a payment channel
+func channelKey(mpeAddress common.Address, channelID *big.Int) string {
+	return mpeAddress.Hex() + "/" + channelID.String()
+}
+
+// reserve locks the channel and returns the amount to sign for a payment of increment cogs.
+// The amount builds on the highest of the amount known to the daemon and the amounts handed out before,
+// so concurrent calls sign strictly increasing amounts. The reservation must be released.
+func (c *channelCoordinator) reserve(database db.Service, mpeAddress common.Address, channelID, nonce, daemonAmount, increment *big.Int) (*channelReservation, error) {
+	state := c.channel(mpeAddress, channelID)
+	state.mu.Lock()
+	if state.claiming {
+		state.mu.Unlock()
+		return nil, errChannelClaiming
+	}
+
+	reservation := &channelReservation{
+		database:   database,
+		mpeAddress: mpeAddress,
+		channelID:  channelID,
+		state:      state,
+		nonce:      nonce,
+	}
+
+	base := daemonAmount
+	if state.nonce != nil && state.nonce.Cmp(nonce) == 0 && state.signedAmount.Cmp(base) > 0 {
+		base = state.signedAmount
+	}
+
+	if config.Payments.ChannelLocking == ChannelLockingPostgres && database != nil {
+		lock, err := database.LockPaymentChannel(mpeAddress.Hex(), channelID)
+		if err != nil {
+			state.mu.Unlock()
+			return nil, err
+		}
+		reservation.lock = lock
+		if stored := lock.Channel(); stored != nil && stored.Nonce != nil && stored.Nonce.Cmp(nonce) == 0 &&
+			stored.SignedAmount != nil && stored.SignedAmount.Cmp(base) > 0 {
+			base = stored.SignedAmount
+		}
+	}
+
+	reservation.signedAmount = new(big.Int).Add(base, increment)
+
+	log.Debug().
+		Str("channel_id", channelID.String()).
+		Str("nonce", nonce.String()).
+		Str("daemon_amount", daemonAmount.String()).
+		Str("signed_amount", reservation.signedAmount.String()).
+		Msg("signed amount reserved")
+	return reservation, nil
+}
+
+// channel returns the amount last handed out for a channel, creating it on first use
+func (c *channelCoordinator) channel(mpeAddress common.Address, channelID *big.Int) *channelAmount {
+	key := channelKey(mpeAddress, channelID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.channels[key]
+	if !ok {
+		state = &channelAmount{}
+		c.channels[key] = state
+	}
+	return state
+}
+
+// rollback lowers the amount kept for a channel to signedAmount once the daemon refused a payment that was kept before the call.
+// Amounts signed after it built on the refused one and are refused as well, so the lowest rolled back amount wins.
+func (c *channelCoordinator) rollback(database db.Service, mpeAddress common.Address, channelID, nonce, signedAmount *big.Int) {
+	state := c.channel(mpeAddress, channelID)
+	state.mu.Lock()
+	if state.nonce != nil && state.nonce.Cmp(nonce) == 0 && state.signedAmount.Cmp(signedAmount) > 0 {
+		state.signedAmount = signedAmount
+	}
+	state.mu.Unlock()
+
+	log.Debug().
+		Str("channel_id", channelID.String()).
+		Str("nonce", nonce.String()).
+		Str("signed_amount", signedAmount.String()).
+		Msg("signed amount rolled back")
+
+	if database == nil {
+		return
+	}
+	if err := database.RevertPaymentChannelSignedAmount(mpeAddress.Hex(), channelID, nonce, signedAmount); err != nil {
+		log.Warn().
+			Str("channel_id", channelID.String()).
+			Err(err).
+			Msg("failed to roll back signed amount")
+	}
+}
+
+// ClaimChannel runs claim for a payment channel and drops the prepaid sessions paying from it once the claim succeeded.
+// The channel is only locked to wait for the reservations in progress and to mark it as claimed: no call reserves an amount
+// for it until the claim is over, while the on-chain claim itself runs without holding the lock.
+//
+// Parameters:
+//   - database: The database holding the channel row locks of other processes.
+//   - mpeAddress: The address of the MPE contract.
+//   - channelID: The ID of the channel in the MPE contract.
+//   - claim: The on-chain claim of the channel.
+//
+// Returns:
+//   - error: An error if the channel cannot be locked or the claim fails.
+func ClaimChannel(database db.Service, mpeAddress common.Address, channelID *big.Int, claim func() error) error {
+	state := channelAmounts.channel(mpeAddress, channelID)
+	if err := markClaiming(database, state, mpeAddress, channelID); err != nil {
+		return err
+	}
+
+	err := claim()
+
+	state.mu.Lock()
+	state.claiming = false
+	if err == nil {
+		// The claim removes the channel from the contract, amounts signed for it no longer apply
+		state.nonce = nil
+		state.signedAmount = nil
+	}
+	state.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	// The sessions are dropped once the channel is unlocked, the cache must never be waited for while holding a channel
+	prepaidSessions.invalidateChannel(mpeAddress, channelID)
+	return nil
+}
+
+// markClaiming waits for the reservations of a channel in progress, in other processes too, and marks the channel as claimed
+func markClaiming(database db.Service, state *channelAmount, mpeAddress common.Address, channelID *big.Int) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if config.Payments.ChannelLocking == ChannelLockingPostgres && database != nil {
+		lock, err := database.LockPaymentChannel(mpeAddress.Hex(), channelID)
+		if err != nil {
+			return fmt.Errorf("failed to lock payment channel: %w", err)
+		}
+		if err := lock.Release(nil, nil, false); err != nil {
+			log.Warn().
+				Str("channel_id", channelID.String()).
+				Err(err).
+				Msg("failed to release payment channel lock")
+		}
+	}
+
+	state.claiming = true
+	return nil
+}
+
+// release unlocks the channel. A kept amount becomes the base of the following reservations;
+// an amount the daemon never accepted is dropped so the next call signs it again.
+func (r *channelReservation) release(keep bool) {
+	defer r.state.mu.Unlock()
+
+	if keep {
+		r.state.nonce = r.nonce
+		r.state.signedAmount = r.signedAmount
+	}
+
+	if r.lock != nil {
+		if err := r.lock.Release(r.nonce, r.signedAmount, keep); err != nil {
+			log.Warn().
+				Str("channel_id", r.channelID.String()).
+				Err(err).
+				Msg("failed to release payment channel lock")
+		}
+		return
+	}
+	if keep {
+		recordSignedAmount(r.database, r.mpeAddress, r.channelID, r.nonce, r.signedAmount)
+	}
+}
@@ -0,0 +1,90 @@
+package snet
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// lookupStoredChannel returns the channel remembered in the database for the sender, recipient and group.
+// The stored channel is verified on-chain; channels that no longer exist are marked as deleted.
+// A nil result means the caller should fall back to scanning the chain for ChannelOpen events.
+func lookupStoredChannel(evm blockchain.Ethereum, database db.Service, mpeAddress, sender, recipient common.Address, groupID string, callOpts *bind.CallOpts) *blockchain.MultiPartyEscrowChannelOpen {
+	logger := log.With().
+		Str("sender", sender.Hex()).
+		Str("recipient", recipient.Hex()).
+		Str("group_id", groupID).
+		Logger()
+
+	stored, err := database.GetPaymentChannel(mpeAddress.Hex(), sender.Hex(), recipient.Hex(), groupID)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to get stored payment channel")
+		return nil
+	}
+	if stored == nil || stored.ChannelID == nil {
+		return nil
+	}
+
+	channel, err := evm.GetChannel(stored.ChannelID, callOpts)
+	if err != nil || channel.Sender != sender || channel.Recipient != recipient {
+		logger.Info().
+			Str("channel_id", stored.ChannelID.String()).
+			Err(err).
+			Msg("stored payment channel is no longer valid on-chain")
+		if err := database.DeletePaymentChannel(mpeAddress.Hex(), stored.ChannelID); err != nil {
+			logger.Warn().Err(err).Msg("failed to delete stale payment channel")
+		}
+		return nil
+	}
+
+	logger.Debug().
+		Str("channel_id", channel.ChannelId.String()).
+		Msg("using stored payment channel")
+	return channel
+}
+
+// saveChannel stores the on-chain state of a channel together with the nonce and amount signed so far.
+// Failures are logged only: the registry is a cache and the chain stays the source of truth.
+func saveChannel(evm blockchain.Ethereum, database db.Service, mpeAddress, sender, recipient common.Address, groupID string, channelID, nonce, signedAmount *big.Int, callOpts *bind.CallOpts) {
+	logger := log.With().
+		Str("channel_id", channelID.String()).
+		Logger()
+
+	channel, err := evm.GetChannel(channelID, callOpts)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to read channel state for the registry")
+		return
+	}
+
+	err = database.SavePaymentChannel(&db.PaymentChannel{
+		ChannelID:    channelID,
+		MPEAddress:   mpeAddress.Hex(),
+		Sender:       sender.Hex(),
+		Recipient:    recipient.Hex(),
+		GroupID:      groupID,
+		Amount:       channel.Amount,
+		Expiration:   channel.Expiration,
+		Nonce:        nonce,
+		SignedAmount: signedAmount,
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to save payment channel")
+	}
+}
+
+// recordSignedAmount remembers the last amount signed for a channel
+func recordSignedAmount(database db.Service, mpeAddress common.Address, channelID, nonce, signedAmount *big.Int) {
+	if database == nil {
+		return
+	}
+	if err := database.UpdatePaymentChannelSignedAmount(mpeAddress.Hex(), channelID, nonce, signedAmount); err != nil {
+		log.Warn().
+			Str("channel_id", channelID.String()).
+			Err(err).
+			Msg("failed to record signed amount")
+	}
+}
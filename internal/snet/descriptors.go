@@ -0,0 +1,70 @@
+package snet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// errNoDescriptors is returned when the proto descriptors of a service have not been synced yet
+var errNoDescriptors = errors.New("proto descriptors of the service are not synced yet")
+
+// DescriptorCache provides the proto descriptors of services for their calls.
+// Descriptors are read from the database the first time a content hash is asked for and kept in memory afterwards,
+// so calls depend neither on IPFS nor on compiling the proto sources.
+type DescriptorCache struct {
+	database db.Service
+
+	mu          sync.RWMutex                             // A mutex to ensure thread-safe access to descriptors.
+	descriptors map[string][]protoreflect.FileDescriptor // The file descriptors by content hash of their proto sources.
+}
+
+// NewDescriptorCache creates an empty descriptor cache reading from the database.
+func NewDescriptorCache(database db.Service) *DescriptorCache {
+	return &DescriptorCache{
+		database:    database,
+		descriptors: make(map[string][]protoreflect.FileDescriptor),
+	}
+}
+
+// Get returns the file descriptors of the proto sources the service is called with.
+//
+// Parameters:
+//   - snetService: The service to get the descriptors of.
+//
+// Returns:
+//   - []protoreflect.FileDescriptor: The file descriptors of the service.
+//   - error: An error if the service has no stored descriptors or they cannot be restored.
+func (c *DescriptorCache) Get(snetService *db.SnetService) ([]protoreflect.FileDescriptor, error) {
+	if snetService.ProtoHash == "" {
+		return nil, fmt.Errorf("%w: %s", errNoDescriptors, snetService.SnetID)
+	}
+
+	c.mu.RLock()
+	descriptors, ok := c.descriptors[snetService.ProtoHash]
+	c.mu.RUnlock()
+	if ok {
+		return descriptors, nil
+	}
+
+	protos, err := c.database.GetServiceProtos(snetService.ProtoHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proto descriptors: %w", err)
+	}
+	if protos == nil {
+		return nil, fmt.Errorf("%w: %s", errNoDescriptors, snetService.SnetID)
+	}
+	descriptors, err = syncer.ServiceDescriptors(protos)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.descriptors[snetService.ProtoHash] = descriptors
+	c.mu.Unlock()
+	return descriptors, nil
+}
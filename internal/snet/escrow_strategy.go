@@ -0,0 +1,137 @@
+package snet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// EscrowPaymentType is the value of the snet-payment-type header for classic pay-per-call payments.
+	EscrowPaymentType = "escrow"
+	// PrepaidPaymentType is the value of the snet-payment-type header for prepaid token payments.
+	PrepaidPaymentType = "prepaid-call"
+	// paymentTypeProbeTimeout is the deadline of the TokenService request probing the payment type of a daemon.
+	paymentTypeProbeTimeout = 10 * time.Second
+)
+
+// EscrowStrategy implements the classic escrow strategy: every call carries a fresh claim signature
+// for the incremented signed amount instead of a prepaid token
+type EscrowStrategy struct {
+	*PaymentChannelHandler
+	claimSignature []byte
+	charged        *big.Int // The price added to the signed amount for the call, nil until a claim is signed.
+}
+
+// NewEscrowStrategy creates a new escrow call strategy
+func NewEscrowStrategy(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, accountSigner signer.Signer, database db.Service) (Strategy, error) {
+	handler, err := newPaymentChannelHandler(evm, grpc, serviceMetadata, accountSigner, 1, database)
+	if err != nil {
+		return nil, err
+	}
+	return &EscrowStrategy{PaymentChannelHandler: handler}, nil
+}
+
+// UpdateTokenState signs the claim for the current nonce and the signed amount of the channel grown by price.
+// The amount is kept right away so concurrent calls build on it without waiting for the daemon; settleCall rolls it back
+// if the daemon refuses the payment.
+func (s *EscrowStrategy) UpdateTokenState(ctx context.Context, price *big.Int) error {
+	reservation, err := channelAmounts.reserve(s.database, s.mpeAddress, s.channelID, s.nonce, s.daemonAmount, price)
+	if err != nil {
+		return fmt.Errorf("failed to reserve signed amount: %w", err)
+	}
+	if err := s.coverSignedAmount(ctx, reservation.signedAmount, price); err != nil {
+		reservation.release(false)
+		return err
+	}
+	s.signedAmount = reservation.signedAmount
+	s.claimSignature, err = s.generatePaymentClaimSignature()
+	if err != nil {
+		reservation.release(false)
+		return err
+	}
+	reservation.release(true)
+	s.charged = price
+
+	log.Debug().
+		Str("service_id", s.serviceMetadata.SnetID).
+		Str("channel_id", s.channelID.String()).
+		Str("nonce", s.nonce.String()).
+		Str("signed_amount", s.signedAmount.String()).
+		Msg("escrow claim signature generated")
+	return nil
+}
+
+// settleCall rolls the signed amount of the call back if the daemon did not accept the payment
+func (s *EscrowStrategy) settleCall(paid bool) {
+	if paid || s.charged == nil {
+		return
+	}
+	channelAmounts.rollback(s.database, s.mpeAddress, s.channelID, s.nonce, new(big.Int).Sub(s.signedAmount, s.charged))
+	s.charged = nil
+}
+
+// BuildRequestMetadata constructs gRPC metadata for escrow calls
+func (s *EscrowStrategy) BuildRequestMetadata(ctx context.Context) context.Context {
+	md := metadata.New(map[string]string{
+		blockchain.PaymentTypeHeader:             EscrowPaymentType,
+		blockchain.PaymentChannelIDHeader:        s.channelID.String(),
+		blockchain.PaymentChannelNonceHeader:     s.nonce.String(),
+		blockchain.PaymentChannelAmountHeader:    s.signedAmount.String(),
+		blockchain.PaymentChannelSignatureHeader: string(s.claimSignature),
+	})
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// daemonPaymentTypes caches the payment type supported by each daemon URL
+var daemonPaymentTypes sync.Map
+
+// detectPaymentType reports whether the daemon supports prepaid tokens or only classic escrow.
+// The daemon is probed with an empty TokenService request: daemons without the token service answer with
+// codes.Unimplemented, any other answer means prepaid tokens are supported. Only such answers are cached;
+// when the daemon cannot be reached prepaid payments are assumed for this call and the daemon is probed again next time.
+func detectPaymentType(ctx context.Context, grpc *grpcmanager.GRPCClientManager, daemonURL string) string {
+	if paymentType, ok := daemonPaymentTypes.Load(daemonURL); ok {
+		return paymentType.(string)
+	}
+
+	logger := log.With().Str("service_url", daemonURL).Logger()
+
+	grpcClient, err := grpc.GetClient(daemonURL)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to get gRPC client, assuming prepaid payments")
+		return PrepaidPaymentType
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, paymentTypeProbeTimeout)
+	defer cancel()
+	_, err = NewTokenServiceClient(grpcClient.Conn).GetToken(probeCtx, &TokenRequest{})
+
+	paymentType := PrepaidPaymentType
+	st, isStatus := status.FromError(err)
+	switch {
+	case !isStatus || st.Code() == codes.Unavailable || st.Code() == codes.DeadlineExceeded || st.Code() == codes.Canceled:
+		logger.Warn().Err(err).Msg("failed to probe daemon payment type, assuming prepaid payments")
+		return PrepaidPaymentType
+	case st.Code() == codes.Unimplemented:
+		paymentType = EscrowPaymentType
+	}
+
+	logger.Debug().
+		Str("payment_type", paymentType).
+		Msg("detected daemon payment type")
+
+	daemonPaymentTypes.Store(daemonURL, paymentType)
+	return paymentType
+}
@@ -0,0 +1,191 @@
+package snet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// FreeCallPaymentType is the value of the snet-payment-type header for free calls.
+	FreeCallPaymentType = "free-call"
+	// freeCallTokenLifetimeInBlocks is the requested lifetime of a free call token (~1 day on Ethereum).
+	freeCallTokenLifetimeInBlocks = uint64(7200)
+	// freeCallStateTimeout is the deadline of a request to the daemon's FreeCallStateService.
+	freeCallStateTimeout = 15 * time.Second
+)
+
+// FreeCallStrategy implements free call strategy using the daemon's FreeCallStateService
+type FreeCallStrategy struct {
+	ethClient            blockchain.Ethereum
+	serviceMetadata      *db.SnetService
+	accountSigner        signer.Signer
+	signerAddress        common.Address
+	userID               string
+	freeCallClient       FreeCallStateServiceClient
+	token                []byte
+	tokenExpirationBlock uint64
+	currentBlock         uint64
+	signature            []byte // The signature of the token for the current block, sent with the call.
+}
+
+// NewFreeCallStrategy creates a new free call strategy for the given service.
+// Free calls are counted per userID, the Matrix user making the calls; without one they are counted for the signer.
+func NewFreeCallStrategy(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, accountSigner signer.Signer, userID string) (*FreeCallStrategy, error) {
+	signerAddress := accountSigner.Address()
+	if userID == "" {
+		userID = signerAddress.Hex()
+	}
+
+	grpcClient, err := grpc.GetClient(serviceMetadata.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gRPC client: %w", err)
+	}
+
+	return &FreeCallStrategy{
+		ethClient:       evm,
+		serviceMetadata: serviceMetadata,
+		accountSigner:   accountSigner,
+		signerAddress:   signerAddress,
+		userID:          userID,
+		freeCallClient:  NewFreeCallStateServiceClient(grpcClient.Conn),
+	}, nil
+}
+
+// UpdateTokenState obtains a free call token from the daemon if there is no valid one yet. Free calls have no price.
+func (s *FreeCallStrategy) UpdateTokenState(ctx context.Context, _ *big.Int) error {
+	logger := log.With().
+		Str("service_id", s.serviceMetadata.SnetID).
+		Str("user_id", s.userID).
+		Logger()
+
+	currentBlockNumber, err := s.ethClient.Client.BlockNumber(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get current block number")
+		return fmt.Errorf("failed to get current block: %w", err)
+	}
+	s.currentBlock = currentBlockNumber
+
+	if len(s.token) > 0 && s.tokenExpirationBlock > currentBlockNumber {
+		logger.Debug().
+			Uint64("token_expiration_block", s.tokenExpirationBlock).
+			Msg("free call token is still valid")
+		return s.signToken()
+	}
+
+	tokenLifetime := freeCallTokenLifetimeInBlocks
+	signature, err := util.GetSignature(s.freeCallMessage(currentBlockNumber, nil), s.accountSigner)
+	if err != nil {
+		return err
+	}
+
+	tokenCtx, cancel := context.WithTimeout(ctx, freeCallStateTimeout)
+	defer cancel()
+	reply, err := s.freeCallClient.GetFreeCallToken(tokenCtx, &GetFreeCallTokenRequest{
+		Address:               s.signerAddress.Hex(),
+		Signature:             signature,
+		CurrentBlock:          currentBlockNumber,
+		UserId:                &s.userID,
+		TokenLifetimeInBlocks: &tokenLifetime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get free call token: %w", err)
+	}
+
+	s.token = reply.GetToken()
+	if len(s.token) == 0 && reply.GetTokenHex() != "" {
+		s.token, err = hex.DecodeString(strings.TrimPrefix(reply.GetTokenHex(), "0x"))
+		if err != nil {
+			return fmt.Errorf("failed to decode free call token: %w", err)
+		}
+	}
+	s.tokenExpirationBlock = reply.GetTokenExpirationBlock()
+
+	logger.Debug().
+		Uint64("token_expiration_block", s.tokenExpirationBlock).
+		Msg("free call token state updated successfully")
+	return s.signToken()
+}
+
+// signToken signs the free call token for the current block
+func (s *FreeCallStrategy) signToken() error {
+	signature, err := util.GetSignature(s.freeCallMessage(s.currentBlock, s.token), s.accountSigner)
+	if err != nil {
+		return err
+	}
+	s.signature = signature
+	return nil
+}
+
+// BuildRequestMetadata constructs gRPC metadata for free calls
+func (s *FreeCallStrategy) BuildRequestMetadata(ctx context.Context) context.Context {
+	logger := log.With().
+		Str("service_id", s.serviceMetadata.SnetID).
+		Str("user_id", s.userID).
+		Logger()
+
+	logger.Debug().Msg("building free call gRPC request metadata")
+
+	md := metadata.New(map[string]string{
+		blockchain.PaymentTypeHeader:                        FreeCallPaymentType,
+		blockchain.FreeCallUserIdHeader:                     s.userID,
+		blockchain.UserInfoHeader:                           s.signerAddress.Hex(),
+		blockchain.CurrentBlockNumberHeader:                 strconv.FormatUint(s.currentBlock, 10),
+		blockchain.FreeCallAuthTokenHeader:                  string(s.token),
+		blockchain.FreeCallAuthTokenExpiryBlockNumberHeader: strconv.FormatUint(s.tokenExpirationBlock, 10),
+		blockchain.PaymentChannelSignatureHeader:            string(s.signature),
+	})
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// AvailableFreeCallCount returns the number of free calls the daemon still grants to the user
+func (s *FreeCallStrategy) AvailableFreeCallCount() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), freeCallStateTimeout)
+	defer cancel()
+
+	if err := s.UpdateTokenState(ctx, nil); err != nil {
+		return 0, err
+	}
+
+	reply, err := s.freeCallClient.GetFreeCallsAvailable(ctx, &FreeCallStateRequest{
+		Address:       s.signerAddress.Hex(),
+		UserId:        &s.userID,
+		FreeCallToken: s.token,
+		Signature:     s.signature,
+		CurrentBlock:  s.currentBlock,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get available free calls: %w", err)
+	}
+
+	return reply.GetFreeCallsAvailable(), nil
+}
+
+// freeCallMessage builds the message signed for free call requests; the token is appended when present
+func (s *FreeCallStrategy) freeCallMessage(currentBlockNumber uint64, token []byte) []byte {
+	return bytes.Join([][]byte{
+		[]byte(blockchain.FreeCallPrefixSignature),
+		[]byte(s.signerAddress.Hex()),
+		[]byte(s.userID),
+		[]byte(s.serviceMetadata.SnetOrgID),
+		[]byte(s.serviceMetadata.SnetID),
+		[]byte(s.serviceMetadata.GroupID),
+		math.U256Bytes(new(big.Int).SetUint64(currentBlockNumber)),
+		token,
+	}, nil)
+}
@@ -0,0 +1,370 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
+	"github.com/tensved/snet-matrix-framework/internal/matrix"
+	"github.com/tensved/snet-matrix-framework/internal/wallet"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+	"maunium.net/go/mautrix/event"
+)
+
+const (
+	// PaymentModeOperator pays for calls from the admin account.
+	PaymentModeOperator = "operator"
+	// PaymentModeUser asks users to fund their own payment channel through the payment gateway.
+	PaymentModeUser = "user"
+)
+
+var (
+	// errNoUserChannel is returned when the user has no channel the bot can sign claims for
+	errNoUserChannel = errors.New("no payment channel funded by the user")
+	// errInsufficientChannelFunds is returned when the user's channel cannot pay for another call
+	errInsufficientChannelFunds = errors.New("not enough funds left in the payment channel")
+)
+
+// gatewayCall holds everything needed to execute a call funded by the user's own payment channel
+type gatewayCall struct {
+	evt           *event.Event
+	mx            matrix.Service
+	eth           blockchain.Ethereum
+	database      db.Service
+	grpc          *grpcmanager.GRPCClientManager
+	wallets       *wallet.Manager
+	accountSigner signer.Signer
+	descriptors   *DescriptorCache
+	snetService   *db.SnetService
+	methodName    string
+	params        map[string]interface{}
+}
+
+// payThroughGateway executes a call paid from the user's own channel. If the user has no channel with enough funds,
+// it creates a payment state, sends the gateway URL and waits until the user's depositAndOpenChannel or channelAddFunds
+// transaction is confirmed.
+func payThroughGateway(call gatewayCall) (interface{}, error) {
+	logger := log.With().
+		Str("service_id", call.snetService.SnetID).
+		Str("method", call.methodName).
+		Str("sender", call.evt.Sender.String()).
+		Logger()
+
+	ctx := context.Background()
+	pm := NewPaymentManager(call.eth, call.database, call.grpc, call.accountSigner, call.descriptors)
+	pm.SetCaller(call.evt.Sender.String(), string(call.evt.RoomID))
+
+	if freeCallStrategy := pm.getFreeCallStrategy(call.snetService); freeCallStrategy != nil {
+		logger.Debug().Msg("paying with a free call")
+		return pm.ExecuteCallWithStrategy(ctx, call.snetService, call.methodName, call.params, freeCallStrategy)
+	}
+
+	orgGroup, err := call.database.GetSnetOrgGroup(call.snetService.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get org group: %w", err)
+	}
+	recipient := common.HexToAddress(orgGroup.PaymentAddress)
+	signer := call.accountSigner.Address()
+
+	var channelID *big.Int
+	sender := call.channelSender()
+	if sender != nil {
+		strategy, err := call.userChannelStrategy(*sender, recipient, signer)
+		switch {
+		case err == nil:
+			logger.Debug().Msg("paying from the user's existing channel")
+			return pm.ExecuteCallWithStrategy(ctx, call.snetService, call.methodName, call.params, strategy)
+		case errors.Is(err, errInsufficientChannelFunds):
+			channelID = strategy.(*PaymentChannelHandler).channelID
+		case !errors.Is(err, errNoUserChannel):
+			return nil, err
+		}
+	}
+
+	paymentState, err := call.createPaymentState(orgGroup, recipient, signer, channelID, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	var channel *blockchain.MultiPartyEscrowChannelOpen
+	_, err = waitForPayment(call.evt, paymentState.ID, call.mx, call.eth, call.database, func(receipt *types.Receipt) error {
+		channel, err = call.fundedChannel(receipt, paymentState, recipient, signer)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	call.rememberChannelSender(channel.Sender)
+
+	strategy, err := call.newUserChannelStrategy(channel)
+	if err != nil {
+		return nil, err
+	}
+	return pm.ExecuteCallWithStrategy(ctx, call.snetService, call.methodName, call.params, strategy)
+}
+
+// channelSender returns the address the user funds channels from: the address linked to their wallet,
+// otherwise the sender of the channel they funded through the gateway before, nil if neither is known
+func (call gatewayCall) channelSender() *common.Address {
+	if userWallet, _ := call.wallets.Get(call.evt.Sender.String()); userWallet != nil && userWallet.LinkedAddress != nil {
+		sender := common.HexToAddress(*userWallet.LinkedAddress)
+		return &sender
+	}
+
+	stored, err := call.database.GetUserChannelSender(call.evt.Sender.String())
+	if err != nil {
+		log.Warn().Err(err).Str("sender", call.evt.Sender.String()).Msg("failed to get the channel sender of the user")
+	}
+	if stored == "" {
+		return nil
+	}
+	sender := common.HexToAddress(stored)
+	return &sender
+}
+
+// rememberChannelSender stores the sender of the channel the user funded, so their next calls are paid from it,
+// and links it to the user wallet unless an address is linked already
+func (call gatewayCall) rememberChannelSender(sender common.Address) {
+	logger := log.With().
+		Str("sender", call.evt.Sender.String()).
+		Str("channel_sender", sender.Hex()).
+		Logger()
+
+	if err := call.database.SaveUserChannelSender(call.evt.Sender.String(), sender.Hex()); err != nil {
+		logger.Warn().Err(err).Msg("failed to save the channel sender of the user")
+	}
+	if userWallet, _ := call.wallets.Get(call.evt.Sender.String()); userWallet != nil && userWallet.LinkedAddress == nil {
+		if _, err := call.wallets.Link(call.evt.Sender.String(), sender.Hex()); err != nil {
+			logger.Warn().Err(err).Msg("failed to link the channel sender to the user wallet")
+		}
+	}
+}
+
+// fundedChannel returns the channel opened or funded by the transaction reported for the payment state.
+// The channel has to be the one the payment state asked for: signed by the bot for the service group,
+// funded by the expected sender if one is known, and either the channel to top up or a new channel
+// opened with the expiration of the payment state. Transactions of other users are refused that way.
+func (call gatewayCall) fundedChannel(receipt *types.Receipt, paymentState *db.PaymentState, recipient, signer common.Address) (*blockchain.MultiPartyEscrowChannelOpen, error) {
+	channel, err := call.eth.ChannelFromReceipt(receipt, util.GetCallOpts(signer, nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the funded channel: %w", err)
+	}
+	groupID, err := blockchain.DecodePaymentGroupID(call.snetService.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if channel.Signer != signer || channel.Recipient != recipient || channel.GroupId != groupID {
+		return nil, errors.New("the funded channel does not belong to this service or cannot be signed by the bot")
+	}
+	if paymentState.Sender != nil && channel.Sender != common.HexToAddress(*paymentState.Sender) {
+		return nil, fmt.Errorf("the funded channel belongs to %s, not to %s", channel.Sender.Hex(), *paymentState.Sender)
+	}
+
+	if paymentState.ChannelID != nil {
+		if channel.ChannelId.String() != *paymentState.ChannelID {
+			return nil, fmt.Errorf("the transaction funded channel %s instead of channel %s", channel.ChannelId, *paymentState.ChannelID)
+		}
+		return channel, nil
+	}
+	if channel.Expiration == nil || channel.Expiration.Cmp(big.NewInt(paymentState.Expiration)) != 0 {
+		return nil, errors.New("the funded channel was not opened for this payment")
+	}
+	return channel, nil
+}
+
+// userChannelStrategy returns a strategy paying from the channel the user funded earlier.
+// On errInsufficientChannelFunds the returned strategy is a *PaymentChannelHandler describing the channel to top up.
+func (call gatewayCall) userChannelStrategy(sender, recipient, signer common.Address) (Strategy, error) {
+	if paymentHandler := prepaidSessions.get(prepaidSessionKey(sender, call.snetService)); paymentHandler != nil && paymentHandler.canPay(big.NewInt(int64(call.snetService.Price))) {
+		return paymentHandler, nil
+	}
+
+	channel := lookupStoredChannel(call.eth, call.database, common.HexToAddress(call.snetService.MPEAddress), sender, recipient, call.snetService.GroupID, util.GetCallOpts(signer, nil))
+	if channel == nil || channel.Signer != signer {
+		return nil, errNoUserChannel
+	}
+	return call.newUserChannelStrategy(channel)
+}
+
+// newUserChannelStrategy creates a strategy signing claims for a channel funded by the user
+func (call gatewayCall) newUserChannelStrategy(channel *blockchain.MultiPartyEscrowChannelOpen) (Strategy, error) {
+	paymentType := detectPaymentType(context.Background(), call.grpc, call.snetService.URL)
+
+	callCount := max(config.Payments.PrepaidCallBatch, 1)
+	if paymentType == EscrowPaymentType {
+		callCount = 1
+	}
+
+	paymentHandler, err := newUserChannelHandler(call.eth, call.grpc, call.snetService, call.accountSigner, channel, callCount, call.database)
+	if err != nil {
+		if errors.Is(err, errInsufficientChannelFunds) {
+			return paymentHandler, err
+		}
+		return nil, err
+	}
+
+	if paymentType == EscrowPaymentType {
+		return &EscrowStrategy{PaymentChannelHandler: paymentHandler}, nil
+	}
+	prepaidSessions.put(prepaidSessionKey(channel.Sender, call.snetService), paymentHandler)
+	return paymentHandler, nil
+}
+
+// createPaymentState stores the parameters of the channel the user has to fund and sends them the gateway URL.
+// The sender is the address expected to fund the channel, nil if the user has not funded a channel before.
+func (call gatewayCall) createPaymentState(orgGroup db.SnetOrgGroup, recipient, signer common.Address, channelID *big.Int, sender *common.Address) (*db.PaymentState, error) {
+	currentBlockNumber, err := call.eth.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current block: %w", err)
+	}
+
+	tokenAddress, err := call.eth.MPE.Token(util.GetCallOpts(signer, nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token address: %w", err)
+	}
+
+	callCount := max(config.Payments.PrepaidCallBatch, 1)
+	amount := call.snetService.Price * int(callCount)
+	expiration := util.GetNewExpiration(new(big.Int).SetUint64(currentBlockNumber), orgGroup.PaymentExpirationThreshold)
+
+	paymentState := &db.PaymentState{
+		ID:           uuid.New(),
+		Key:          fmt.Sprintf("%s %s %s %s", call.evt.RoomID, call.evt.Sender, call.snetService.SnetID, call.methodName),
+		TokenAddress: tokenAddress.Hex(),
+		ToAddress:    call.eth.MPEAddress.Hex(),
+		Amount:       amount,
+		Signer:       signer.Hex(),
+		Recipient:    recipient.Hex(),
+		GroupID:      call.snetService.GroupID,
+		Expiration:   expiration.Int64(),
+		ExpiresAt:    time.Now().Add(time.Duration(config.App.PaymentTimeout) * time.Minute),
+	}
+	if channelID != nil {
+		id := channelID.String()
+		paymentState.ChannelID = &id
+	}
+	if sender != nil {
+		address := sender.Hex()
+		paymentState.Sender = &address
+	}
+	paymentState.URL = gatewayURL(paymentState.ID)
+
+	paymentID, err := call.database.CreatePaymentState(paymentState)
+	if err != nil {
+		return nil, err
+	}
+	paymentState.ID = paymentID
+
+	text := fmt.Sprintf("This call is paid from your own payment channel. Fund it with %d cogs (%d calls) at %s within %d minutes.",
+		amount, callCount, paymentState.URL, config.App.PaymentTimeout)
+	if _, err := call.mx.SendMessage(call.evt.RoomID, text); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("payment_id", paymentID.String()).
+		Str("service_id", call.snetService.SnetID).
+		Int("amount", amount).
+		Msg("waiting for the user to fund the payment channel")
+	return paymentState, nil
+}
+
+// gatewayURL returns the payment gateway page of a payment state
+func gatewayURL(paymentID uuid.UUID) string {
+	base := config.Payments.GatewayURL
+	if base == "" {
+		base = fmt.Sprintf("https://%s", config.App.Domain)
+	}
+	return fmt.Sprintf("%s?id=%s", strings.TrimRight(base, "/"), paymentID)
+}
+
+// newUserChannelHandler creates a payment channel handler for a channel funded by the user.
+// Unlike newPaymentChannelHandler it never deposits, opens or extends channels on behalf of the user.
+func newUserChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, accountSigner signer.Signer, channel *blockchain.MultiPartyEscrowChannelOpen, callCount uint64, database db.Service) (*PaymentChannelHandler, error) {
+	logger := log.With().
+		Str("service_id", serviceMetadata.SnetID).
+		Str("channel_id", channel.ChannelId.String()).
+		Str("sender", channel.Sender.Hex()).
+		Logger()
+
+	signer := accountSigner.Address()
+	mpeAddress := common.HexToAddress(serviceMetadata.MPEAddress)
+
+	currentBlockNumber, err := evm.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current block: %w", err)
+	}
+
+	channelState, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, channel.ChannelId, currentBlockNumber, accountSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel state: %w", err)
+	}
+
+	nonce := new(big.Int).SetBytes(channelState.GetCurrentNonce())
+	currentSignedAmount := new(big.Int).SetBytes(channelState.GetCurrentSignedAmount())
+	priceInCogs := big.NewInt(int64(serviceMetadata.Price))
+
+	// Sign for as many calls of the batch as the remaining channel value covers
+	if priceInCogs.Sign() > 0 {
+		remaining := new(big.Int).Sub(channel.Amount, currentSignedAmount)
+		affordable := new(big.Int).Div(remaining, priceInCogs)
+		if affordable.IsUint64() && affordable.Uint64() < callCount {
+			callCount = affordable.Uint64()
+		}
+	}
+
+	grpcClient, err := grpc.GetClient(serviceMetadata.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gRPC client: %w", err)
+	}
+
+	saveChannel(evm, database, mpeAddress, channel.Sender, channel.Recipient, serviceMetadata.GroupID, channel.ChannelId, nonce, currentSignedAmount, util.GetCallOpts(signer, nil))
+
+	increment := new(big.Int).Mul(priceInCogs, new(big.Int).SetUint64(callCount))
+	paymentHandler := &PaymentChannelHandler{
+		ethClient:       evm,
+		grpcManager:     grpc,
+		database:        database,
+		serviceMetadata: serviceMetadata,
+		accountSigner:   accountSigner,
+		signerAddress:   signer,
+		sender:          channel.Sender,
+		tokenClient:     NewTokenServiceClient(grpcClient.Conn),
+		channelID:       channel.ChannelId,
+		nonce:           nonce,
+		signedAmount:    new(big.Int).Add(currentSignedAmount, increment),
+		daemonAmount:    currentSignedAmount,
+		increment:       increment,
+		callCount:       callCount,
+		channelValue:    channel.Amount,
+		mpeAddress:      mpeAddress,
+		price:           priceInCogs,
+	}
+
+	if callCount == 0 {
+		logger.Info().
+			Str("channel_value", channel.Amount.String()).
+			Str("signed_amount", currentSignedAmount.String()).
+			Msg("user channel has no funds left")
+		return paymentHandler, errInsufficientChannelFunds
+	}
+
+	logger.Info().
+		Uint64("call_count", callCount).
+		Str("signed_amount", paymentHandler.signedAmount.String()).
+		Msg("payment channel handler created with user channel")
+	return paymentHandler, nil
+}
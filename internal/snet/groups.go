@@ -0,0 +1,248 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// Policies choosing the payment group of a service published in several groups
+const (
+	GroupSelectionFirst    = "first"    // The first reachable group in metadata order.
+	GroupSelectionCheapest = "cheapest" // The reachable group with the lowest price of the called method.
+	GroupSelectionLatency  = "latency"  // The reachable group answering health checks fastest.
+)
+
+// errNoReachableGroup is returned when none of the payment groups of a service answers health checks
+var errNoReachableGroup = errors.New("no payment group of the service is reachable")
+
+// reachableEndpoint checks the endpoints of a service best first and returns the service bound to the first one answering.
+// Endpoints keeps the alternatives in ranked order so that calls can fail over within the group.
+func reachableEndpoint(ctx context.Context, grpc *grpcmanager.GRPCClientManager, snetService *db.SnetService) (*db.SnetService, time.Duration, error) {
+	var lastErr error
+	ranked := grpc.RankEndpoints(serviceEndpoints(snetService))
+	for i, endpoint := range ranked {
+		latency, err := grpc.CheckHealth(ctx, endpoint)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reachable := *snetService
+		reachable.URL = endpoint
+		reachable.Endpoints = append([]string{endpoint}, slices.Delete(slices.Clone(ranked), i, i+1)...)
+		return &reachable, latency, nil
+	}
+	return nil, 0, lastErr
+}
+
+// serviceEndpoints returns every daemon endpoint of a service, falling back to its URL for services synced without them
+func serviceEndpoints(snetService *db.SnetService) []string {
+	if len(snetService.Endpoints) > 0 {
+		return snetService.Endpoints
+	}
+	return []string{snetService.URL}
+}
+
+// groupCandidate is a payment group of a service considered for a call
+type groupCandidate struct {
+	service *db.SnetService // The service as published in the group.
+	name    string          // The name of the group.
+	price   int             // The price of the called method in the group.
+	latency time.Duration   // The health check latency of the best group endpoint.
+	err     error           // The health check error of the group endpoints.
+	checked bool            // Whether the group endpoints were checked already.
+}
+
+// check binds the candidate to its best reachable endpoint once and returns the health check error of the group
+func (c *groupCandidate) check(ctx context.Context, grpc *grpcmanager.GRPCClientManager) error {
+	if c.checked {
+		return c.err
+	}
+	c.checked = true
+
+	service, latency, err := reachableEndpoint(ctx, grpc, c.service)
+	if err != nil {
+		c.err = err
+		return err
+	}
+	c.service, c.latency = service, latency
+	return nil
+}
+
+// serviceInGroup returns a copy of the service with the endpoint, price and free calls of a payment group
+func serviceInGroup(snetService *db.SnetService, group db.SnetServiceGroup) *db.SnetService {
+	inGroup := *snetService
+	inGroup.GroupID = group.GroupID
+	inGroup.Price = group.Price
+	inGroup.FreeCalls = group.FreeCalls
+	inGroup.FreeCallSignerAddress = group.FreeCallSignerAddress
+	if len(group.Endpoints) > 0 {
+		inGroup.URL = group.Endpoints[0]
+		inGroup.Endpoints = group.Endpoints
+	}
+	return &inGroup
+}
+
+// selectServiceGroup chooses the payment group a call is paid and sent through.
+// The preferred group comes first, the others follow the configured policy; the first reachable group wins,
+// so services published in several regions stay reachable when one of them is down.
+func selectServiceGroup(ctx context.Context, database db.Service, grpc *grpcmanager.GRPCClientManager, snetService *db.SnetService, methodName, preferred string) (*db.SnetService, error) {
+	logger := log.With().
+		Str("service_id", snetService.SnetID).
+		Str("policy", config.Payments.GroupSelection).
+		Str("preferred_group", preferred).
+		Logger()
+
+	groups, err := database.GetSnetServiceGroups(snetService.ID)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to get service groups, using the default group")
+	}
+
+	var candidates []*groupCandidate
+	if len(groups) == 0 {
+		candidates = append(candidates, &groupCandidate{service: snetService, price: snetService.Price})
+	} else {
+		prices, err := database.GetSnetServicePrices(snetService.ID)
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to get pricing table, comparing default prices")
+		}
+		for _, group := range groups {
+			candidates = append(candidates, &groupCandidate{
+				service: serviceInGroup(snetService, group),
+				name:    group.GroupName,
+				price:   methodPrice(prices, group.GroupID, "", "", methodName, group.Price),
+			})
+		}
+	}
+
+	switch config.Payments.GroupSelection {
+	case GroupSelectionCheapest:
+		slices.SortStableFunc(candidates, func(a, b *groupCandidate) int {
+			return a.price - b.price
+		})
+	case GroupSelectionLatency:
+		for _, candidate := range candidates {
+			candidate.check(ctx, grpc)
+		}
+		slices.SortStableFunc(candidates, func(a, b *groupCandidate) int {
+			if (a.err == nil) != (b.err == nil) {
+				if a.err == nil {
+					return -1
+				}
+				return 1
+			}
+			return int(a.latency - b.latency)
+		})
+	}
+
+	if preferred != "" {
+		index := slices.IndexFunc(candidates, func(c *groupCandidate) bool { return c.name == preferred })
+		if index > 0 {
+			candidates = append([]*groupCandidate{candidates[index]}, slices.Delete(candidates, index, index+1)...)
+		}
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		if lastErr = candidate.check(ctx, grpc); lastErr != nil {
+			logger.Info().
+				Err(lastErr).
+				Str("group", candidate.name).
+				Strs("endpoints", serviceEndpoints(candidate.service)).
+				Msg("payment group is unreachable, trying the next one")
+			continue
+		}
+
+		logger.Debug().
+			Str("group", candidate.name).
+			Str("group_id", candidate.service.GroupID).
+			Str("url", candidate.service.URL).
+			Int("price", candidate.price).
+			Msg("payment group selected")
+		return candidate.service, nil
+	}
+	return nil, fmt.Errorf("%w: %w", errNoReachableGroup, lastErr)
+}
+
+// groupCommand handles the !group command listing the payment groups of a service and storing the user's choice
+func groupCommand(database db.Service) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "group").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		sender := c.Event().Sender.String()
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", string(c.Event().RoomID)).
+			Str("sender", sender).
+			Strs("args", args).
+			Msg("group command received")
+
+		if len(args) == 0 || len(args) > 2 {
+			return c.TextAnswer("Usage: !group <service_id> [<group_name>|auto]")
+		}
+
+		snetService, err := database.GetSnetService(args[0])
+		if err != nil || snetService == nil {
+			return c.TextAnswer("Service not found.")
+		}
+		groups, err := database.GetSnetServiceGroups(snetService.ID)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to get service groups")
+			return c.TextAnswer("Failed to get payment groups.")
+		}
+
+		var answer string
+		switch {
+		case len(args) == 2 && args[1] == "auto":
+			if err := database.SavePreferredGroup(sender, snetService.SnetID, ""); err != nil {
+				return c.TextAnswer("Failed to save your choice.")
+			}
+			answer = fmt.Sprintf("Payment groups of %s are chosen by the %s policy now.", snetService.SnetID, config.Payments.GroupSelection)
+		case len(args) == 2:
+			if !slices.ContainsFunc(groups, func(g db.SnetServiceGroup) bool { return g.GroupName == args[1] }) {
+				return c.TextAnswer("Unknown payment group. Send !group " + snetService.SnetID + " to list them.")
+			}
+			if err := database.SavePreferredGroup(sender, snetService.SnetID, args[1]); err != nil {
+				return c.TextAnswer("Failed to save your choice.")
+			}
+			answer = fmt.Sprintf("Calls to %s go through the %s group now while it is reachable.", snetService.SnetID, args[1])
+		default:
+			preferred, err := database.GetPreferredGroup(sender, snetService.SnetID)
+			if err != nil {
+				logger.Warn().Err(err).Msg("failed to get preferred group")
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "Payment groups of %s (policy: %s):\n", snetService.SnetID, config.Payments.GroupSelection)
+			for _, group := range groups {
+				marker := ""
+				if group.GroupName == preferred {
+					marker = " (your choice)"
+				}
+				fmt.Fprintf(&b, "%s: %s AGIX per call%s\n", group.GroupName, util.CogToAgix(group.Price), marker)
+			}
+			if len(groups) == 0 {
+				b.WriteString("The service is published in one group only.\n")
+			}
+			answer = strings.TrimSuffix(b.String(), "\n")
+		}
+
+		err = c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send group answer")
+		}
+		return err
+	}
+}
@@ -2,9 +2,9 @@ package snet
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 
@@ -12,18 +12,18 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/tensved/bobrix"
 	"github.com/tensved/bobrix/contracts"
+	"github.com/tensved/snet-matrix-framework/internal/budget"
 	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/internal/matrix"
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
+	"github.com/tensved/snet-matrix-framework/internal/wallet"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
-	ipfsutils "github.com/tensved/snet-matrix-framework/pkg/ipfs"
-	"google.golang.org/grpc/health/grpc_health_v1"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
@@ -58,13 +58,19 @@ func NewCallState(serviceName string, method *contracts.Method, eventID id.Event
 	}
 }
 
-func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, callStates map[string]*CallState, bobr *bobrix.Bobrix, grpc *grpcmanager.GRPCClientManager) func(evt *event.Event) *bobrix.ServiceRequest {
+func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, callStates map[string]*CallState, bobr *bobrix.Bobrix, grpc *grpcmanager.GRPCClientManager, wallets *wallet.Manager, budgets *budget.Manager, pending *pendingCalls, descriptors *DescriptorCache, snetSyncer *syncer.SnetSyncer) func(evt *event.Event) *bobrix.ServiceRequest {
 	return func(evt *event.Event) *bobrix.ServiceRequest {
 		// Skip if message starts with ! (bot commands)
 		if strings.HasPrefix(strings.TrimSpace(evt.Content.AsMessage().Body), "!") {
 			return nil
 		}
 
+		// Replies to a quote confirm or cancel the quoted call
+		message := evt.Content.AsMessage()
+		if answerQuote(mx, pending, evt.RoomID, evt.Sender.String(), message.RelatesTo.GetReplyTo(), replyText(message)) {
+			return nil
+		}
+
 		names, err := parseCommand(evt.Content.AsMessage().Body, evt.RoomID, mx)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to parse command")
@@ -95,10 +101,9 @@ func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, cal
 
 		log.Info().Str("snet_id", names.SnetID).Str("url", snetService.URL).Msg("found service in database")
 
-		log.Info().Str("url", snetService.URL).Msg("attempting to get gRPC client")
-		client, err := grpc.GetClient(snetService.URL)
-		if err != nil {
-			log.Error().Err(err).Str("url", snetService.URL).Msg("failed to get gRPC client")
+		// Bobrix keeps services once connected, so services dropped from the catalog are refused here
+		if _, ok := snetSyncer.FileDescriptors()[names.SnetID]; !ok {
+			log.Error().Str("snet_id", names.SnetID).Msg("service is not synced or out of sync scope")
 			_, err = mx.SendMessage(evt.RoomID, "Service unavailable.")
 			if err != nil {
 				log.Error().Err(err)
@@ -106,27 +111,16 @@ func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, cal
 			}
 			return nil
 		}
-		log.Info().Str("url", snetService.URL).Msg("successfully got gRPC client")
-
-		log.Info().Str("url", snetService.URL).Msg("checking service health")
-		healthClient := grpc_health_v1.NewHealthClient(client.Conn)
-		hReq := grpc_health_v1.HealthCheckRequest{}
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		hResp, err := healthClient.Check(ctx, &hReq)
+
+		preferredGroup, err := database.GetPreferredGroup(evt.Sender.String(), snetService.SnetID)
 		if err != nil {
-			log.Error().Err(err).Str("url", snetService.URL).Msg("failed to get health status")
-			_, err = mx.SendMessage(evt.RoomID, "Service unavailable.")
-			if err != nil {
-				log.Error().Err(err)
-				return nil
-			}
-			return nil
+			log.Warn().Err(err).Str("snet_id", names.SnetID).Msg("failed to get preferred payment group")
 		}
 
-		log.Info().Str("url", snetService.URL).Str("status", hResp.GetStatus().String()).Msg("health check response")
-		if hResp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
-			log.Error().Str("url", snetService.URL).Str("status", hResp.GetStatus().String()).Msg("service is offline")
+		log.Info().Str("snet_id", names.SnetID).Msg("selecting payment group")
+		snetService, err = selectServiceGroup(context.Background(), database, grpc, snetService, names.Method, preferredGroup)
+		if err != nil {
+			log.Error().Err(err).Str("snet_id", names.SnetID).Msg("failed to select payment group")
 			_, err = mx.SendMessage(evt.RoomID, "Service unavailable.")
 			if err != nil {
 				log.Error().Err(err)
@@ -134,7 +128,9 @@ func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, cal
 			}
 			return nil
 		}
-		log.Info().Str("url", snetService.URL).Msg("service is online")
+		log.Info().Str("url", snetService.URL).Str("group_id", snetService.GroupID).Msg("service is online")
+
+		snetService = pricedService(database, snetService, names.Descriptor, names.Service, names.Method)
 
 		log.Info().Str("snet_id", names.SnetID).Msg("checking service in bobrix")
 		service, found := bobr.GetService(names.SnetID)
@@ -165,21 +161,25 @@ func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, cal
 			Str("method", names.Method).
 			Msg("using new payment system")
 
-		privateKey, err := crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
+		accountSigner, err := resolveSigner(wallets, evt.Sender.String())
 		if err != nil {
-			log.Error().Err(err).Msg("failed to parse private key")
-			_, err = mx.SendMessage(evt.RoomID, "Internal error.")
+			log.Error().Err(err).Str("sender", evt.Sender.String()).Msg("failed to resolve signer")
+			answer := "Internal error."
+			if errors.Is(err, errWalletRequired) {
+				answer = "You have no wallet yet. Create one with !account create and fund it."
+			}
+			_, err = mx.SendMessage(evt.RoomID, answer)
 			if err != nil {
 				log.Error().Err(err)
 				return nil
 			}
 			return nil
 		}
-		log.Info().Msg("private key parsed successfully")
+		log.Info().Str("sender", evt.Sender.String()).Msg("signer resolved successfully")
 
-		protoFiles, err := getProtoFilesForService(snetService)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to get proto files")
+		// A user-paid call waits for the payment before it is made, so missing descriptors are reported right away
+		if _, err = descriptors.Get(snetService); err != nil {
+			log.Error().Err(err).Msg("failed to get proto descriptors")
 			_, err = mx.SendMessage(evt.RoomID, "Internal error.")
 			if err != nil {
 				log.Error().Err(err)
@@ -187,36 +187,154 @@ func Parser(mx matrix.Service, eth blockchain.Ethereum, database db.Service, cal
 			}
 			return nil
 		}
-		log.Info().Msg("proto files obtained successfully")
+		log.Info().Msg("proto descriptors obtained successfully")
+
+		sender := evt.Sender.String()
+		roomID := string(evt.RoomID)
+
+		// call reserves the price against the budgets and makes the call; a call the user confirmed over a limit overdraws them
+		call := func(overdraw bool) {
+			var reservation *budget.Reservation
+			var err error
+			if overdraw {
+				reservation = budgets.Overdraw(sender, roomID, snetService.SnetID, int64(snetService.Price))
+			} else if reservation, err = budgets.Reserve(sender, roomID, snetService.SnetID, int64(snetService.Price)); err != nil {
+				// Concurrent calls may have used up the budget since it was checked
+				answer := "Internal error."
+				var exceeded *budget.ExceededError
+				if errors.As(err, &exceeded) {
+					answer = fmt.Sprintf("Budget exceeded: %v.", exceeded)
+				}
+				log.Info().Err(err).Str("sender", sender).Msg("call refused by budget")
+				if _, err := mx.SendMessage(evt.RoomID, answer); err != nil {
+					log.Error().Err(err)
+				}
+				return
+			}
+
+			if config.Payments.Mode == PaymentModeUser {
+				userCall := gatewayCall{
+					evt:           evt,
+					mx:            mx,
+					eth:           eth,
+					database:      database,
+					grpc:          grpc,
+					wallets:       wallets,
+					accountSigner: accountSigner,
+					descriptors:   descriptors,
+					snetService:   snetService,
+					methodName:    names.Method,
+					params:        names.Params,
+				}
+				// Waiting for the user's transaction may take minutes, so the call runs in the background
+				go func() {
+					result, err := payThroughGateway(userCall)
+					reservation.Commit(callCost(result, snetService, new(big.Int)))
+					if err != nil {
+						log.Error().Err(err).Msg("failed to execute user-paid call")
+						result = callErrorAnswer(err)
+					}
+					if _, err := mx.SendMessage(evt.RoomID, fmt.Sprintf("%v", result)); err != nil {
+						log.Error().Err(err)
+					}
+				}()
+				return
+			}
 
-		paymentManager := NewPaymentManager(eth, database, grpc, privateKey, protoFiles)
-		log.Info().Msg("payment manager created successfully")
+			paymentManager := NewPaymentManager(eth, database, grpc, accountSigner, descriptors)
+			paymentManager.SetCaller(sender, roomID)
+			log.Info().Msg("payment manager created successfully")
 
-		log.Info().Msg("calling PaymentManager.ExecuteCall")
-		result, err := paymentManager.ExecuteCall(context.Background(), snetService, names.Method, names.Params)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to execute call")
-			_, err = mx.SendMessage(evt.RoomID, fmt.Sprintf("Error: %v", err))
+			log.Info().Msg("calling PaymentManager.ExecuteCall")
+			result, err := paymentManager.ExecuteCall(context.Background(), snetService, names.Method, names.Params)
+			reservation.Commit(callCost(result, snetService, paymentManager.Funding()))
+			if err != nil {
+				log.Error().Err(err).Msg("failed to execute call")
+				_, err = mx.SendMessage(evt.RoomID, callErrorAnswer(err))
+				if err != nil {
+					log.Error().Err(err)
+				}
+				return
+			}
+			log.Info().Msg("PaymentManager.ExecuteCall completed successfully")
+
+			resultStr := fmt.Sprintf("%v", result)
+			_, err = mx.SendMessage(evt.RoomID, resultStr)
 			if err != nil {
 				log.Error().Err(err)
-				return nil
+				return
 			}
-			return nil
+			log.Info().Msg("result sent to Matrix successfully")
 		}
-		log.Info().Msg("PaymentManager.ExecuteCall completed successfully")
 
-		resultStr := fmt.Sprintf("%v", result)
-		_, err = mx.SendMessage(evt.RoomID, resultStr)
+		// quoteAndRun shows the price of the call and waits for confirmation unless the call is cheap enough for the room
+		quoteAndRun := func(run func()) {
+			if snetService.Price == 0 || int64(snetService.Price) < confirmThreshold(database, roomID) {
+				run()
+				return
+			}
+
+			// Free calls cost the user nothing, so there is nothing to confirm
+			paymentManager := NewPaymentManager(eth, database, grpc, accountSigner, descriptors)
+			paymentManager.SetCaller(sender, roomID)
+			if paymentManager.hasFreeCall(snetService) {
+				run()
+				return
+			}
+
+			quote, err := quoteCall(eth, database, snetService, accountSigner)
+			if err != nil {
+				log.Warn().Err(err).Str("snet_id", snetService.SnetID).Msg("failed to estimate channel transactions for the quote")
+				quote = &callQuote{price: big.NewInt(int64(snetService.Price)), funding: new(big.Int), fee: new(big.Int)}
+			}
+
+			answer := fmt.Sprintf("%s Reply \"yes\" or react with 👍 within %d minutes to confirm, or reply \"no\" to cancel.", quote, int(pendingCallTTL.Minutes()))
+			resp, err := mx.SendMessage(evt.RoomID, answer)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to send quote")
+				return
+			}
+			pending.put(quoteConfirmationKey(sender, resp.EventID), run)
+		}
+
+		err = budgets.Check(sender, roomID, snetService.SnetID, int64(snetService.Price))
 		if err != nil {
-			log.Error().Err(err)
+			var exceeded *budget.ExceededError
+			answer := "Internal error."
+			switch {
+			case errors.As(err, &exceeded) && config.Budgets.ExceededAction == budget.ActionConfirm:
+				pending.put(pendingCallKey(sender, roomID), func() { quoteAndRun(func() { call(true) }) })
+				answer = fmt.Sprintf("Budget exceeded: %v. Send !budget confirm within %d minutes to call the service anyway.", exceeded, int(pendingCallTTL.Minutes()))
+			case errors.As(err, &exceeded):
+				answer = fmt.Sprintf("Budget exceeded: %v.", exceeded)
+			}
+			log.Info().Err(err).Str("sender", sender).Msg("call refused by budget")
+			_, err = mx.SendMessage(evt.RoomID, answer)
+			if err != nil {
+				log.Error().Err(err)
+			}
 			return nil
 		}
-		log.Info().Msg("result sent to Matrix successfully")
 
+		quoteAndRun(func() { call(false) })
 		return nil
 	}
 }
 
+// callErrorAnswer builds the message sent to the Matrix user when a paid call fails
+func callErrorAnswer(err error) string {
+	var shortfall *blockchain.TokenShortfallError
+	if errors.As(err, &shortfall) {
+		return fmt.Sprintf("Not enough tokens to fund the payment channel: account %s holds %s cogs, but %s cogs are required. Please top up the account with at least %s cogs and try again.",
+			shortfall.Address.Hex(), shortfall.Balance, shortfall.Required, shortfall.Missing())
+	}
+	var short *channelValueError
+	if errors.As(err, &short) || errors.Is(err, errInsufficientChannelFunds) {
+		return "The payment channel does not hold enough funds for this call and could not be topped up. Please try again later."
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
 // parseCommand parses the command message and extracts relevant information.
 func parseCommand(msg string, roomID id.RoomID, mx matrix.Service) (ParsedNames, error) {
 	logger := log.With().
@@ -294,57 +412,15 @@ func parseCommand(msg string, roomID id.RoomID, mx matrix.Service) (ParsedNames,
 	}, nil
 }
 
-// getProtoFilesForService retrieves proto files for the service from IPFS
-func getProtoFilesForService(snetService *db.SnetService) (map[string]string, error) {
-	ipfsClient := ipfsutils.Init()
-
-	var protoHashes []string
-
-	if snetService.ServiceApiSource != "" {
-		protoHashes = append(protoHashes, snetService.ServiceApiSource)
-	}
-
-	if snetService.ModelIpfsHash != "" {
-		protoHashes = append(protoHashes, snetService.ModelIpfsHash)
-	}
-
-	if len(protoHashes) == 0 {
-		return nil, fmt.Errorf("both ModelIpfsHash and ServiceApiSource are empty")
-	}
-
-	var content []byte
-	var protoErr error
-
-	for _, protoHash := range protoHashes {
-		log.Info().Str("hash", protoHash).Msg("trying to get proto files from IPFS")
-		content, protoErr = ipfsClient.GetIpfsFile(protoHash)
-		if protoErr == nil {
-			log.Info().Str("successful_hash", protoHash).Msg("successfully got proto files from IPFS")
-			break
-		}
-		log.Error().Err(protoErr).Str("hash", protoHash).Msg("failed to get proto files from IPFS, trying next hash")
-	}
-
-	if protoErr != nil {
-		return nil, fmt.Errorf("failed to get proto files from all IPFS hashes: %w", protoErr)
-	}
-
-	protoFiles, err := ipfsutils.ReadFilesCompressed(string(content))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read compressed proto files: %w", err)
-	}
-
-	protoFilesMap := make(map[string]string)
-	for fileName, fileContent := range protoFiles {
-		protoFilesMap[fileName] = string(fileContent)
-	}
-
-	log.Info().Int("files_count", len(protoFilesMap)).Msg("extracted proto files count")
-	return protoFilesMap, nil
-}
+// waitForPayment waits until the transaction reported for a payment state is confirmed and accepted by accept,
+// which checks that the transaction pays for this payment state. A transaction that already paid another payment state is refused.
+// It returns the receipt of the successful transaction, or an error once the payment failed or timed out.
+func waitForPayment(event *event.Event, paymentID uuid.UUID, mx matrix.Service, eth blockchain.Ethereum, database db.Service, accept func(receipt *types.Receipt) error) (*types.Receipt, error) {
+	logger := log.With().
+		Str("payment_id", paymentID.String()).
+		Str("room", string(event.RoomID)).
+		Logger()
 
-// Deprecated: waitForPayment waits for payment confirmation.
-func waitForPayment(event *event.Event, paymentID uuid.UUID, mx matrix.Service, eth blockchain.Ethereum, database db.Service) error {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 	timeout := time.After(time.Duration(config.App.PaymentTimeout) * time.Minute)
@@ -354,54 +430,85 @@ func waitForPayment(event *event.Event, paymentID uuid.UUID, mx matrix.Service,
 		case <-ticker.C:
 			paymentState, err := database.GetPaymentState(paymentID)
 			if err != nil {
-				log.Error().Err(err)
+				logger.Error().Err(err).Msg("failed to get payment state")
 				continue
 			}
 
 			txHash := paymentState.TxHash
 			if txHash == nil {
-				log.Debug().Msg("tx hash not found in payment state")
+				logger.Debug().Msg("tx hash not found in payment state")
 				continue
 			}
 
 			receipt, err := eth.Client.TransactionReceipt(context.Background(), common.HexToHash(*txHash))
 			if err != nil {
-				log.Error().Err(err)
+				logger.Debug().Err(err).Str("tx_hash", *txHash).Msg("transaction is not confirmed yet")
 				continue
 			}
 
-			if receipt.Status == types.ReceiptStatusSuccessful {
-				paymentState.Status = "paid"
-				err = database.PatchUpdatePaymentState(paymentState)
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				logger.Warn().Str("tx_hash", *txHash).Msg("payment transaction failed")
+				err = database.PatchUpdatePaymentState(&db.PaymentState{ID: paymentID, Status: "failed"})
 				if err != nil {
-					return err
+					logger.Error().Err(err).Msg("failed to update payment state")
 				}
 
-				text := "Payment has been received. Now you can reply to the bot messages to complete the input fields."
-				_, err = mx.SendMessage(event.RoomID, text)
+				_, err = mx.SendMessage(event.RoomID, "Payment transaction failed. Please, try again.")
 				if err != nil {
-					return err
+					logger.Error().Err(err).Msg("failed to send message")
 				}
-				return nil
+				return nil, errors.New("payment transaction failed")
+			}
+
+			if err = accept(receipt); err != nil {
+				logger.Warn().Err(err).Str("tx_hash", *txHash).Msg("payment transaction refused")
+				return nil, rejectPayment(event, paymentID, mx, database, "Payment transaction does not fund the requested payment channel. Please, try again.", err)
+			}
+
+			paymentState.Status = "paid"
+			err = database.PatchUpdatePaymentState(paymentState)
+			if errors.Is(err, db.ErrTxHashConsumed) {
+				logger.Warn().Str("tx_hash", *txHash).Msg("payment transaction already paid another payment")
+				return nil, rejectPayment(event, paymentID, mx, database, "Payment transaction has already been used for another payment. Please, try again.", err)
 			}
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = mx.SendMessage(event.RoomID, "Payment has been received. Calling the service.")
+			if err != nil {
+				return nil, err
+			}
+			return receipt, nil
 		case <-timeout:
-			log.Debug().Msg("payment timeout reached")
+			logger.Debug().Msg("payment timeout reached")
 
-			err := database.PatchUpdatePaymentState(&db.PaymentState{Status: "expired"})
+			err := database.PatchUpdatePaymentState(&db.PaymentState{ID: paymentID, Status: "expired"})
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			_, err = mx.SendMessage(event.RoomID, "Waiting time for payment has expired. Please, try again.")
 			if err != nil {
-				return err
+				return nil, err
 			}
 
-			return errors.New("waiting time for payment has expired")
+			return nil, errors.New("waiting time for payment has expired")
 		}
 	}
 }
 
+// rejectPayment marks a payment state as failed, tells the user why and returns the reason
+func rejectPayment(event *event.Event, paymentID uuid.UUID, mx matrix.Service, database db.Service, text string, reason error) error {
+	if err := database.PatchUpdatePaymentState(&db.PaymentState{ID: paymentID, Status: "failed"}); err != nil {
+		log.Error().Err(err).Str("payment_id", paymentID.String()).Msg("failed to update payment state")
+	}
+	if _, err := mx.SendMessage(event.RoomID, text); err != nil {
+		log.Error().Err(err).Str("payment_id", paymentID.String()).Msg("failed to send message")
+	}
+	return fmt.Errorf("payment refused: %w", reason)
+}
+
 // Deprecated: processCallState processes the call state for sequential input filling.
 func processCallState(event *event.Event, mx matrix.Service, callState *CallState) error {
 	repliedEvt, err := mx.GetRepliedEvent(event)
@@ -448,13 +555,3 @@ func processCallState(event *event.Event, mx matrix.Service, callState *CallStat
 
 	return nil
 }
-
-// Deprecated: getPrivateKey retrieves the private key from configuration
-func getPrivateKey() *ecdsa.PrivateKey {
-	privateKeyECDSA, err := crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to parse private key")
-		return nil
-	}
-	return privateKeyECDSA
-}
@@ -3,23 +3,21 @@ package snet
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"time"
 
-	"maps"
-	"slices"
-
-	"github.com/bufbuild/protocompile"
-	"github.com/bufbuild/protocompile/linker"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
@@ -28,32 +26,45 @@ import (
 // Strategy interface for payment strategies
 type Strategy interface {
 	BuildRequestMetadata(ctx context.Context) context.Context
-	UpdateTokenState(ctx context.Context) error
+	UpdateTokenState(ctx context.Context, price *big.Int) error
 	AvailableFreeCallCount() (uint64, error)
 }
 
+// callSettler is implemented by strategies that settle the signed amount of a call once it is answered
+type callSettler interface {
+	settleCall(paid bool)
+}
+
+// fundingSource is implemented by strategies that may add value to their payment channel on-chain
+type fundingSource interface {
+	takeFunding() *big.Int
+}
+
 // PaymentManager manages payments and strategies
 type PaymentManager struct {
 	ethClient       blockchain.Ethereum
 	database        db.Service
 	grpcManager     *grpcmanager.GRPCClientManager
-	privateKey      *ecdsa.PrivateKey
-	protoFiles      map[string]string // Add proto files
+	accountSigner   signer.Signer
+	descriptors     *DescriptorCache // The proto descriptors the calls are encoded with.
 	currentStrategy Strategy
+	matrixUserID    string   // The Matrix user the calls are made for, recorded in the call ledger.
+	roomID          string   // The Matrix room the calls are made in, recorded in the call ledger.
+	funded          *big.Int // The value added to payment channels on-chain for the calls of the manager.
 }
 
 // NewPaymentManager creates a new PaymentManager instance
-func NewPaymentManager(ethClient blockchain.Ethereum, database db.Service, grpcManager *grpcmanager.GRPCClientManager, privateKey *ecdsa.PrivateKey, protoFiles map[string]string) *PaymentManager {
+func NewPaymentManager(ethClient blockchain.Ethereum, database db.Service, grpcManager *grpcmanager.GRPCClientManager, accountSigner signer.Signer, descriptors *DescriptorCache) *PaymentManager {
 	return &PaymentManager{
-		ethClient:   ethClient,
-		database:    database,
-		grpcManager: grpcManager,
-		privateKey:  privateKey,
-		protoFiles:  protoFiles,
+		ethClient:     ethClient,
+		database:      database,
+		grpcManager:   grpcManager,
+		accountSigner: accountSigner,
+		descriptors:   descriptors,
 	}
 }
 
-// GetStrategy selects the appropriate strategy (prepaid)
+// GetStrategy selects the appropriate strategy (free call, escrow or prepaid)
 func (pm *PaymentManager) GetStrategy(snetService *db.SnetService) (Strategy, error) {
 	logger := log.With().
 		Str("service_id", snetService.SnetID).
@@ -62,26 +73,138 @@ func (pm *PaymentManager) GetStrategy(snetService *db.SnetService) (Strategy, er
 
 	logger.Debug().Msg("selecting payment strategy")
 
+	if freeCallStrategy := pm.getFreeCallStrategy(snetService); freeCallStrategy != nil {
+		logger.Debug().Msg("using free call strategy")
+		return freeCallStrategy, nil
+	}
+
+	if detectPaymentType(context.Background(), pm.grpcManager, snetService.URL) == EscrowPaymentType {
+		logger.Debug().Msg("daemon does not support prepaid calls, using escrow strategy")
+		return pm.getEscrowStrategy(snetService)
+	}
+
 	logger.Debug().Msg("using payment channel strategy")
 	return pm.getPaymentChannelHandler(snetService)
 }
 
+// getEscrowStrategy creates a classic escrow strategy
+func (pm *PaymentManager) getEscrowStrategy(snetService *db.SnetService) (Strategy, error) {
+	logger := log.With().
+		Str("service_id", snetService.SnetID).
+		Logger()
+
+	logger.Debug().Msg("creating escrow strategy")
+	escrowStrategy, err := NewEscrowStrategy(pm.ethClient, pm.grpcManager, snetService, pm.accountSigner, pm.database)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create escrow strategy")
+		return nil, fmt.Errorf("failed to create escrow strategy: %w", err)
+	}
+	logger.Debug().Msg("escrow strategy created successfully")
+	return escrowStrategy, nil
+}
+
+// getFreeCallStrategy returns a free call strategy if the service offers free calls and some remain for the caller
+func (pm *PaymentManager) getFreeCallStrategy(snetService *db.SnetService) Strategy {
+	logger := log.With().
+		Str("service_id", snetService.SnetID).
+		Int("free_calls", snetService.FreeCalls).
+		Logger()
+
+	if snetService.FreeCalls <= 0 || snetService.FreeCallSignerAddress == "" {
+		logger.Debug().Msg("service does not offer free calls")
+		return nil
+	}
+
+	freeCallStrategy, err := NewFreeCallStrategy(pm.ethClient, pm.grpcManager, snetService, pm.accountSigner, pm.matrixUserID)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to create free call strategy")
+		return nil
+	}
+
+	available, err := freeCallStrategy.AvailableFreeCallCount()
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to get available free calls")
+		return nil
+	}
+
+	logger.Debug().
+		Uint64("free_calls_available", available).
+		Msg("free calls available for caller")
+
+	if available == 0 {
+		return nil
+	}
+	return freeCallStrategy
+}
+
+// hasFreeCall reports whether the next call of the service is made as a free call for the caller
+func (pm *PaymentManager) hasFreeCall(snetService *db.SnetService) bool {
+	return pm.getFreeCallStrategy(snetService) != nil
+}
+
 // getPaymentChannelHandler creates a payment channel handler
 func (pm *PaymentManager) getPaymentChannelHandler(snetService *db.SnetService) (Strategy, error) {
 	logger := log.With().
 		Str("service_id", snetService.SnetID).
 		Logger()
 
-	logger.Debug().Msg("creating payment channel handler")
-	paymentHandler, err := NewPaymentChannelHandler(pm.ethClient, pm.grpcManager, snetService, pm.privateKey, 1, pm.database) // callCount = 1
+	sessionKey := prepaidSessionKey(pm.accountSigner.Address(), snetService)
+	if paymentHandler := prepaidSessions.get(sessionKey); paymentHandler != nil && paymentHandler.canPay(big.NewInt(int64(snetService.Price))) {
+		logger.Debug().
+			Str("channel_id", paymentHandler.channelID.String()).
+			Msg("reusing prepaid session")
+		return paymentHandler, nil
+	}
+
+	callCount := max(config.Payments.PrepaidCallBatch, 1)
+
+	logger.Debug().
+		Uint64("call_count", callCount).
+		Msg("creating payment channel handler")
+	paymentHandler, err := newPaymentChannelHandler(pm.ethClient, pm.grpcManager, snetService, pm.accountSigner, callCount, pm.database)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to create payment channel handler")
 		return nil, fmt.Errorf("failed to create payment channel handler: %w", err)
 	}
+	prepaidSessions.put(sessionKey, paymentHandler)
 	logger.Debug().Msg("payment channel handler created successfully")
 	return paymentHandler, nil
 }
 
+// invalidateSession drops the cached prepaid session of a strategy after a failed call
+func (pm *PaymentManager) invalidateSession(snetService *db.SnetService, strategy Strategy) {
+	paymentHandler, ok := strategy.(*PaymentChannelHandler)
+	if !ok {
+		return
+	}
+	prepaidSessions.invalidate(prepaidSessionKey(paymentHandler.sender, snetService))
+}
+
+// SetCaller sets the Matrix user and room the calls are recorded for in the call ledger
+func (pm *PaymentManager) SetCaller(matrixUserID, roomID string) {
+	pm.matrixUserID = matrixUserID
+	pm.roomID = roomID
+}
+
+// Funding returns the value the calls of the manager added to payment channels on-chain, zero if they were paid from funded channels
+func (pm *PaymentManager) Funding() *big.Int {
+	if pm.funded == nil {
+		return new(big.Int)
+	}
+	return pm.funded
+}
+
+// collectFunding adds the value a strategy added to its payment channel to the funding of the manager
+func (pm *PaymentManager) collectFunding(strategy Strategy) {
+	source, ok := strategy.(fundingSource)
+	if !ok {
+		return
+	}
+	if funded := source.takeFunding(); funded != nil && funded.Sign() > 0 {
+		pm.funded = new(big.Int).Add(pm.Funding(), funded)
+	}
+}
+
 // ExecuteCall executes a service call with automatic strategy selection
 func (pm *PaymentManager) ExecuteCall(ctx context.Context, snetService *db.SnetService, methodName string, inputData map[string]interface{}) (interface{}, error) {
 	logger := log.With().
@@ -91,21 +214,47 @@ func (pm *PaymentManager) ExecuteCall(ctx context.Context, snetService *db.SnetS
 
 	logger.Info().Msg("executing service call")
 
+	snetService = pm.priceForMethod(snetService, methodName)
+
 	strategy, err := pm.GetStrategy(snetService)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to get payment strategy")
-		return nil, fmt.Errorf("failed to get strategy: %w", err)
+		err = fmt.Errorf("failed to get strategy: %w", err)
+		pm.recordCall(snetService, methodName, nil, nil, err, 0)
+		return nil, err
 	}
 
-	err = strategy.UpdateTokenState(ctx)
+	return pm.ExecuteCallWithStrategy(ctx, snetService, methodName, inputData, strategy)
+}
+
+// ExecuteCallWithStrategy executes a service call paid with the given strategy
+func (pm *PaymentManager) ExecuteCallWithStrategy(ctx context.Context, snetService *db.SnetService, methodName string, inputData map[string]interface{}, strategy Strategy) (result interface{}, err error) {
+	logger := log.With().
+		Str("service_id", snetService.SnetID).
+		Str("method", methodName).
+		Str("strategy", strategyName(strategy)).
+		Logger()
+
+	start := time.Now()
+	defer func() {
+		pm.collectFunding(strategy)
+		pm.recordCall(snetService, methodName, strategy, result, err, time.Since(start))
+	}()
+
+	err = strategy.UpdateTokenState(ctx, big.NewInt(int64(snetService.Price)))
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to update payment handler token state")
+		pm.invalidateSession(snetService, strategy)
 		return nil, fmt.Errorf("failed to update strategy token state: %w", err)
 	}
 
-	result, err := pm.callService(ctx, snetService, methodName, inputData, strategy)
+	result, err = pm.callService(ctx, snetService, methodName, inputData, strategy)
+	if settler, ok := strategy.(callSettler); ok {
+		settler.settleCall(err == nil)
+	}
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to call service")
+		pm.invalidateSession(snetService, strategy)
 		return nil, fmt.Errorf("failed to call service: %w", err)
 	}
 
@@ -122,12 +271,6 @@ func (pm *PaymentManager) callService(ctx context.Context, snetService *db.SnetS
 
 	logger.Debug().Msg("preparing gRPC call")
 
-	grpcClient, err := pm.grpcManager.GetClient(snetService.URL)
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to get gRPC client")
-		return nil, fmt.Errorf("failed to get gRPC client: %w", err)
-	}
-
 	ctxWithMetadata := strategy.BuildRequestMetadata(ctx)
 	if ctxWithMetadata == nil {
 		logger.Error().Msg("failed to get gRPC metadata")
@@ -144,13 +287,13 @@ func (pm *PaymentManager) callService(ctx context.Context, snetService *db.SnetS
 		Str("input_json", string(inputJSON)).
 		Msg("input data prepared")
 
-	protoFiles, err := pm.getProtoDescriptors()
+	files, err := pm.descriptors.Get(snetService)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to get proto descriptors")
 		return nil, fmt.Errorf("failed to get proto descriptors: %w", err)
 	}
 
-	fileDesc, methodDesc, err := pm.findMethod(protoFiles, methodName)
+	fileDesc, methodDesc, err := pm.findMethod(files, methodName)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to find gRPC method")
 		return nil, fmt.Errorf("failed to find method: %w", err)
@@ -174,10 +317,10 @@ func (pm *PaymentManager) callService(ctx context.Context, snetService *db.SnetS
 		Str("method", fullMethodName).
 		Msg("executing gRPC call")
 
-	err = grpcClient.Conn.Invoke(ctxWithMetadata, fullMethodName, in, out)
+	endpoint, err := pm.invokeWithFailover(ctxWithMetadata, snetService, fullMethodName, in, out)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to invoke gRPC method")
-		return nil, fmt.Errorf("failed to invoke gRPC method: %w", err)
+		return nil, err
 	}
 
 	jsonBytes, err := protojson.MarshalOptions{
@@ -199,10 +342,10 @@ func (pm *PaymentManager) callService(ctx context.Context, snetService *db.SnetS
 		"service":    snetService.SnetID,
 		"method":     methodName,
 		"input":      inputData,
-		"url":        snetService.URL,
+		"url":        endpoint,
 		"free_calls": snetService.FreeCalls,
 		"price":      snetService.Price,
-		"strategy":   "prepaid", // TODO: determine strategy dynamically
+		"strategy":   strategyName(strategy),
 		"response":   responseData,
 	}
 
@@ -213,24 +356,123 @@ func (pm *PaymentManager) callService(ctx context.Context, snetService *db.SnetS
 	return result, nil
 }
 
-// getProtoDescriptors compiles proto files into descriptors
-func (pm *PaymentManager) getProtoDescriptors() (linker.Files, error) {
-	accessor := protocompile.SourceAccessorFromMap(pm.protoFiles)
-	r := protocompile.WithStandardImports(&protocompile.SourceResolver{Accessor: accessor})
-	compiler := protocompile.Compiler{
-		Resolver:       r,
-		SourceInfoMode: protocompile.SourceInfoStandard,
+// invokeWithFailover sends the request to the endpoints of the service best first and returns the endpoint that answered.
+// The payment channel is bound to the payment group, so a request no daemon received can go to another endpoint of the group.
+func (pm *PaymentManager) invokeWithFailover(ctx context.Context, snetService *db.SnetService, fullMethodName string, in, out *dynamicpb.Message) (string, error) {
+	logger := log.With().
+		Str("service_id", snetService.SnetID).
+		Str("method", fullMethodName).
+		Logger()
+
+	var lastErr error
+	for _, endpoint := range pm.grpcManager.RankEndpoints(serviceEndpoints(snetService)) {
+		grpcClient, err := pm.grpcManager.GetClient(endpoint)
+		if err != nil {
+			pm.grpcManager.ReportResult(endpoint, 0, err)
+			lastErr = fmt.Errorf("failed to get gRPC client: %w", err)
+			logger.Warn().Err(err).Str("url", endpoint).Msg("failed to get gRPC client, trying the next endpoint")
+			continue
+		}
+
+		err = grpcClient.Conn.Invoke(ctx, fullMethodName, in, out)
+		if grpcmanager.IsUnavailable(err) {
+			pm.grpcManager.ReportResult(endpoint, 0, err)
+			lastErr = fmt.Errorf("failed to invoke gRPC method: %w", err)
+			logger.Warn().Err(err).Str("url", endpoint).Msg("endpoint is unavailable, trying the next endpoint")
+			continue
+		}
+
+		// The daemon answered, so the endpoint is up even if the call itself failed
+		pm.grpcManager.ReportResult(endpoint, 0, nil)
+		if err != nil {
+			return endpoint, fmt.Errorf("failed to invoke gRPC method: %w", err)
+		}
+		return endpoint, nil
+	}
+	return "", lastErr
+}
+
+// priceForMethod returns the service priced for the invoked method, resolving its package and gRPC service from the proto files
+func (pm *PaymentManager) priceForMethod(snetService *db.SnetService, methodName string) *db.SnetService {
+	var packageName, serviceName string
+	if files, err := pm.descriptors.Get(snetService); err == nil {
+		if fileDesc, methodDesc, err := pm.findMethod(files, methodName); err == nil {
+			packageName = string(fileDesc.Package())
+			serviceName = string(methodDesc.Parent().Name())
+		}
+	}
+	return pricedService(pm.database, snetService, packageName, serviceName, methodName)
+}
+
+// recordCall writes a call to the call ledger. Failures are logged only, the call result is not affected.
+func (pm *PaymentManager) recordCall(snetService *db.SnetService, methodName string, strategy Strategy, result interface{}, callErr error, duration time.Duration) {
+	if pm.database == nil {
+		return
+	}
+
+	call := &db.ServiceCall{
+		MatrixUserID: pm.matrixUserID,
+		RoomID:       pm.roomID,
+		ServiceID:    snetService.SnetID,
+		Method:       methodName,
+		Strategy:     strategyName(strategy),
+		Endpoint:     snetService.URL,
+		MPEAddress:   snetService.MPEAddress,
+		DurationMs:   duration.Milliseconds(),
+		GRPCStatus:   status.Code(callErr).String(),
+	}
+
+	var handler *PaymentChannelHandler
+	switch s := strategy.(type) {
+	case *EscrowStrategy:
+		handler = s.PaymentChannelHandler
+	case *PaymentChannelHandler:
+		handler = s
+	}
+	if handler != nil {
+		handler.mu.Lock()
+		call.ChannelID = handler.channelID
+		call.Nonce = handler.nonce
+		call.SignedAmount = handler.signedAmount
+		handler.mu.Unlock()
+	}
+
+	if callErr != nil {
+		call.Error = callErr.Error()
+	} else {
+		call.Cost = callPrice(result, snetService)
+		if resultMap, ok := result.(map[string]interface{}); ok {
+			if endpoint, ok := resultMap["url"].(string); ok && endpoint != "" {
+				call.Endpoint = endpoint
+			}
+		}
 	}
-	fds, err := compiler.Compile(context.Background(), slices.Collect(maps.Keys(pm.protoFiles))...)
-	if err != nil || fds == nil {
-		log.Error().Err(err).Msg("failed to compile proto files")
-		return nil, fmt.Errorf("failed to compile proto files: %v", err)
+
+	if err := pm.database.CreateServiceCall(call); err != nil {
+		log.Warn().
+			Err(err).
+			Str("service_id", snetService.SnetID).
+			Str("method", methodName).
+			Msg("failed to record service call")
+	}
+}
+
+// strategyName returns a short name of the payment strategy for call results
+func strategyName(strategy Strategy) string {
+	switch strategy.(type) {
+	case *FreeCallStrategy:
+		return "free-call"
+	case *EscrowStrategy:
+		return "escrow"
+	case *PaymentChannelHandler:
+		return "prepaid"
+	default:
+		return "unknown"
 	}
-	return fds, nil
 }
 
 // findMethod finds the method in proto files
-func (pm *PaymentManager) findMethod(files linker.Files, methodName string) (protoreflect.FileDescriptor, protoreflect.MethodDescriptor, error) {
+func (pm *PaymentManager) findMethod(files []protoreflect.FileDescriptor, methodName string) (protoreflect.FileDescriptor, protoreflect.MethodDescriptor, error) {
 	for _, file := range files {
 		for i := 0; i < file.Services().Len(); i++ {
 			service := file.Services().Get(i)
@@ -244,7 +486,7 @@ func (pm *PaymentManager) findMethod(files linker.Files, methodName string) (pro
 }
 
 // GetChannelInfoFromService retrieves channel state information from the service daemon.
-func GetChannelInfoFromService(grpcManager *grpcmanager.GRPCClientManager, ctx context.Context, daemonURL string, mpeAddress common.Address, channelID *big.Int, currentBlockNumber uint64, privateKey *ecdsa.PrivateKey) (*ChannelStateReply, error) {
+func GetChannelInfoFromService(grpcManager *grpcmanager.GRPCClientManager, ctx context.Context, daemonURL string, mpeAddress common.Address, channelID *big.Int, currentBlockNumber uint64, accountSigner signer.Signer) (*ChannelStateReply, error) {
 	grpcClient, err := grpcManager.GetClient(daemonURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gRPC client: %w", err)
@@ -256,11 +498,15 @@ func GetChannelInfoFromService(grpcManager *grpcmanager.GRPCClientManager, ctx c
 		util.BigIntToBytes(channelID),
 		math.U256Bytes(big.NewInt(int64(currentBlockNumber))),
 	}, nil)
+	signature, err := util.GetSignature(message, accountSigner)
+	if err != nil {
+		return nil, err
+	}
 
 	stateClient := NewPaymentChannelStateServiceClient(grpcClient.Conn)
 	stateReply, err := stateClient.GetChannelState(ctx, &ChannelStateRequest{
 		ChannelId:    util.BigIntToBytes(channelID),
-		Signature:    util.GetSignature(message, privateKey),
+		Signature:    signature,
 		CurrentBlock: currentBlockNumber,
 	})
 	if err != nil {
@@ -0,0 +1,208 @@
+package snet_test
+
+import (
+	"context"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
+	"github.com/tensved/snet-matrix-framework/internal/snet"
+	"github.com/tensved/snet-matrix-framework/internal/snet/snettest"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/blockchaintest"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+const price = 10
+
+var (
+	recipient = common.HexToAddress("0x94d04332C4f5273feF69c4a52D24f42a3aF1F207")
+	groupID   = base64.StdEncoding.EncodeToString(make([]byte, 32))
+)
+
+// fixture is a service sold by a fake daemon on a simulated chain, called through a PaymentManager
+type fixture struct {
+	daemon   *snettest.Daemon
+	database *snettest.Database
+	service  *db.SnetService
+	manager  *snet.PaymentManager
+}
+
+// newFixture starts a chain and a daemon selling the calculator service and funds a caller account
+func newFixture(t *testing.T, freeCalls uint64, escrowOnly bool) *fixture {
+	t.Helper()
+
+	chain := blockchaintest.New(t)
+	account := chain.NewAccount(t, big.NewInt(1000*price))
+
+	daemon := snettest.NewDaemon(t, snettest.DaemonConfig{
+		ETH:        chain.ETH,
+		OrgID:      "example-org",
+		ServiceID:  "example-service",
+		GroupID:    groupID,
+		Price:      big.NewInt(price),
+		FreeCalls:  freeCalls,
+		EscrowOnly: escrowOnly,
+	})
+
+	database := snettest.NewDatabase()
+	protos, err := snettest.CalculatorServiceProtos()
+	if err != nil {
+		t.Fatalf("failed to compile calculator protos: %v", err)
+	}
+	if err = database.SaveServiceProtos(protos); err != nil {
+		t.Fatalf("failed to save calculator protos: %v", err)
+	}
+	database.AddOrgGroup(db.SnetOrgGroup{
+		GroupID:                    groupID,
+		GroupName:                  "default_group",
+		PaymentAddress:             recipient.Hex(),
+		PaymentExpirationThreshold: big.NewInt(100),
+	})
+
+	service := &db.SnetService{
+		SnetID:     "example-service",
+		SnetOrgID:  "example-org",
+		GroupID:    groupID,
+		URL:        daemon.URL,
+		MPEAddress: chain.ETH.MPEAddress.Hex(),
+		Price:      price,
+		ProtoHash:  protos.ContentHash,
+	}
+	if freeCalls > 0 {
+		service.FreeCalls = int(freeCalls)
+		service.FreeCallSignerAddress = account.Address().Hex()
+	}
+
+	return &fixture{
+		daemon:   daemon,
+		database: database,
+		service:  service,
+		manager:  newPaymentManager(chain, database, account),
+	}
+}
+
+// newPaymentManager creates a payment manager paying from the account for calls of the calculator service
+func newPaymentManager(chain *blockchaintest.Chain, database db.Service, account signer.Signer) *snet.PaymentManager {
+	return snet.NewPaymentManager(chain.ETH, database, grpcmanager.NewGRPCClientManager(), account, snet.NewDescriptorCache(database))
+}
+
+// add calls the add method of the calculator and checks the answer
+func (f *fixture) add(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	result, err := f.manager.ExecuteCall(context.Background(), f.service, "add", map[string]interface{}{"a": 2, "b": 3})
+	if err != nil {
+		t.Fatalf("failed to execute call: %v", err)
+	}
+	resultMap := result.(map[string]interface{})
+	response := resultMap["response"].(map[string]interface{})
+	if response["value"] != float64(5) {
+		t.Fatalf("add(2, 3) = %v, want 5", response["value"])
+	}
+	return resultMap
+}
+
+// lastChannelID returns the payment channel of the last call recorded in the call ledger
+func (f *fixture) lastChannelID(t *testing.T) *big.Int {
+	t.Helper()
+
+	calls := f.database.ServiceCalls()
+	if len(calls) == 0 || calls[len(calls)-1].ChannelID == nil {
+		t.Fatal("no paid call recorded")
+	}
+	return calls[len(calls)-1].ChannelID
+}
+
+// TestExecuteCallPrepaid tests that calls are paid with prepaid tokens and that a token used up
+// is renewed for a higher amount, topping up the channel.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestExecuteCallPrepaid(t *testing.T) {
+	f := newFixture(t, 0, false)
+
+	for range 2 {
+		if result := f.add(t); result["strategy"] != "prepaid" {
+			t.Fatalf("strategy = %v, want prepaid", result["strategy"])
+		}
+	}
+
+	if calls := f.daemon.Calls(snet.PrepaidPaymentType); calls != 2 {
+		t.Errorf("daemon answered %d prepaid calls, want 2", calls)
+	}
+	if signed := f.daemon.SignedAmount(f.lastChannelID(t)); signed == nil || signed.Cmp(big.NewInt(2*price)) != 0 {
+		t.Errorf("signed amount = %v, want %d", signed, 2*price)
+	}
+}
+
+// TestExecuteCallEscrow tests that every call to a daemon without TokenService carries a claim
+// for exactly one more call.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestExecuteCallEscrow(t *testing.T) {
+	f := newFixture(t, 0, true)
+
+	for range 2 {
+		if result := f.add(t); result["strategy"] != "escrow" {
+			t.Fatalf("strategy = %v, want escrow", result["strategy"])
+		}
+	}
+
+	if calls := f.daemon.Calls(snet.EscrowPaymentType); calls != 2 {
+		t.Errorf("daemon answered %d escrow calls, want 2", calls)
+	}
+	if signed := f.daemon.SignedAmount(f.lastChannelID(t)); signed == nil || signed.Cmp(big.NewInt(2*price)) != 0 {
+		t.Errorf("signed amount = %v, want %d", signed, 2*price)
+	}
+}
+
+// TestExecuteCallFreeCall tests that free calls are used first and paid calls follow once they are used up.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestExecuteCallFreeCall(t *testing.T) {
+	f := newFixture(t, 1, false)
+
+	if result := f.add(t); result["strategy"] != "free-call" {
+		t.Fatalf("first call strategy = %v, want free-call", result["strategy"])
+	}
+	if result := f.add(t); result["strategy"] != "prepaid" {
+		t.Fatalf("second call strategy = %v, want prepaid", result["strategy"])
+	}
+
+	if calls := f.daemon.Calls(snet.FreeCallPaymentType); calls != 1 {
+		t.Errorf("daemon answered %d free calls, want 1", calls)
+	}
+	if calls := f.daemon.Calls(snet.PrepaidPaymentType); calls != 1 {
+		t.Errorf("daemon answered %d prepaid calls, want 1", calls)
+	}
+}
+
+// TestExecuteCallFreeCallPerUser tests that free calls are counted per Matrix user, not for the shared signer.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestExecuteCallFreeCallPerUser(t *testing.T) {
+	f := newFixture(t, 1, false)
+
+	f.manager.SetCaller("@alice:example.org", "!room:example.org")
+	if result := f.add(t); result["strategy"] != "free-call" {
+		t.Fatalf("first call of alice strategy = %v, want free-call", result["strategy"])
+	}
+	if result := f.add(t); result["strategy"] != "prepaid" {
+		t.Fatalf("second call of alice strategy = %v, want prepaid", result["strategy"])
+	}
+
+	f.manager.SetCaller("@bob:example.org", "!room:example.org")
+	if result := f.add(t); result["strategy"] != "free-call" {
+		t.Fatalf("first call of bob strategy = %v, want free-call", result["strategy"])
+	}
+
+	if calls := f.daemon.Calls(snet.FreeCallPaymentType); calls != 2 {
+		t.Errorf("daemon answered %d free calls, want 2", calls)
+	}
+}
@@ -0,0 +1,92 @@
+package snet
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// prepaidSessionTTL limits how long a prepaid session is reused before the channel is checked again
+const prepaidSessionTTL = time.Hour
+
+// prepaidSession keeps a prepaid payment channel handler between calls
+type prepaidSession struct {
+	handler   *PaymentChannelHandler
+	expiresAt time.Time
+}
+
+// prepaidSessionCache stores prepaid sessions per signer, service and payment group
+type prepaidSessionCache struct {
+	sessions map[string]prepaidSession // A map to store sessions by signer, service and group.
+	mu       sync.Mutex                // A mutex to ensure thread-safe access to the sessions map.
+}
+
+// prepaidSessions is shared by all payment managers so that sessions survive between calls
+var prepaidSessions = newPrepaidSessionCache()
+
+// newPrepaidSessionCache creates an empty prepaid session cache
+func newPrepaidSessionCache() *prepaidSessionCache {
+	return &prepaidSessionCache{
+		sessions: make(map[string]prepaidSession),
+	}
+}
+
+// prepaidSessionKey builds the cache key for a signer and service
+func prepaidSessionKey(signer common.Address, snetService *db.SnetService) string {
+	return signer.Hex() + "/" + snetService.SnetOrgID + "/" + snetService.SnetID + "/" + snetService.GroupID
+}
+
+// get returns a cached handler that can still pay for a call.
+// The handler is checked after the cache is unlocked: a handler may wait for the channel while renewing its token,
+// and the channel may wait for the cache while its sessions are invalidated.
+func (c *prepaidSessionCache) get(key string) *PaymentChannelHandler {
+	c.mu.Lock()
+	session, ok := c.sessions[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if time.Now().After(session.expiresAt) || session.handler.Exhausted() {
+		c.mu.Lock()
+		if current, ok := c.sessions[key]; ok && current.handler == session.handler {
+			delete(c.sessions, key)
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	return session.handler
+}
+
+// put stores a handler for reuse by the following calls
+func (c *prepaidSessionCache) put(key string, handler *PaymentChannelHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sessions[key] = prepaidSession{
+		handler:   handler,
+		expiresAt: time.Now().Add(prepaidSessionTTL),
+	}
+}
+
+// invalidate removes a session, e.g. after the daemon rejected its token
+func (c *prepaidSessionCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sessions, key)
+}
+
+// invalidateChannel removes the sessions paying from a channel, e.g. after the channel was claimed on-chain
+func (c *prepaidSessionCache) invalidateChannel(mpeAddress common.Address, channelID *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, session := range c.sessions {
+		if session.handler.mpeAddress == mpeAddress && session.handler.channelID.Cmp(channelID) == 0 {
+			delete(c.sessions, key)
+		}
+	}
+}
@@ -3,21 +3,21 @@ package snet
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/rs/zerolog/log"
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -30,34 +30,45 @@ const (
 
 // PaymentChannelHandler implements payment channel call strategy for blockchain services
 type PaymentChannelHandler struct {
+	mu              sync.Mutex // Guards the token and amounts; never held across network calls.
+	renewMu         sync.Mutex // Serializes token renewals, which may top up the channel on-chain.
 	ethClient       blockchain.Ethereum
 	grpcManager     *grpcmanager.GRPCClientManager
+	database        db.Service
 	serviceMetadata *db.SnetService
-	privateKeyECDSA *ecdsa.PrivateKey
+	accountSigner   signer.Signer
 	signerAddress   common.Address
+	sender          common.Address
 	Token           string
 	tokenClient     TokenServiceClient
 	channelID       *big.Int
 	nonce           *big.Int
 	signedAmount    *big.Int
+	daemonAmount    *big.Int // The amount the daemon knew as signed when the handler was created.
+	increment       *big.Int // The amount added to the signed amount when a new token or claim is signed.
+	callCount       uint64   // The number of calls a new token is signed for.
+	channelValue    *big.Int // The value locked in the channel on-chain.
 	mpeAddress      common.Address
+	price           *big.Int
+	plannedAmount   uint64
+	usedAmount      uint64
+	funded          *big.Int // The value the handler added to the channel on-chain and not yet charged to a budget.
 }
 
 // NewPaymentChannelHandler creates a new payment channel call strategy
-func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, privateKey *ecdsa.PrivateKey, callCount uint64, database db.Service) (Strategy, error) {
+func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, accountSigner signer.Signer, callCount uint64, database db.Service) (Strategy, error) {
+	return newPaymentChannelHandler(evm, grpc, serviceMetadata, accountSigner, callCount, database)
+}
+
+// newPaymentChannelHandler finds or opens a payment channel and prepares the amount to sign for callCount calls
+func newPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCClientManager, serviceMetadata *db.SnetService, accountSigner signer.Signer, callCount uint64, database db.Service) (*PaymentChannelHandler, error) {
 	logger := log.With().
 		Str("service_id", serviceMetadata.SnetID).
 		Str("service_url", serviceMetadata.URL).
 		Uint64("call_count", callCount).
 		Logger()
 
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("failed to get public key")
-	}
-
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
+	fromAddress := accountSigner.Address()
 
 	orgGroup, err := database.GetSnetOrgGroup(serviceMetadata.GroupID)
 	if err != nil {
@@ -85,7 +96,7 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 		return nil, fmt.Errorf("failed to get current block: %w", err)
 	}
 
-	transactOpts := util.GetTransactOpts(privateKey)
+	transactOpts := util.GetTransactOpts(accountSigner)
 
 	opts := &blockchain.BindOpts{
 		Call:     util.GetCallOpts(fromAddress, big.NewInt(int64(currentBlockNumber))),
@@ -106,12 +117,16 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 	recipients := []common.Address{recipient}
 	groupIDs := [][32]byte{groupID}
 
-	filteredChannel, err := evm.FilterChannels(senders, recipients, groupIDs, opts.Filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to filter channels: %w", err)
+	filteredChannel := lookupStoredChannel(evm, database, mpeAddress, fromAddress, recipient, serviceMetadata.GroupID, opts.Call)
+	if filteredChannel == nil {
+		filteredChannel, err = evm.FilterChannels(senders, recipients, groupIDs, opts.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter channels: %w", err)
+		}
 	}
 
 	priceInCogs := big.NewInt(int64(serviceMetadata.Price))
+	increment := new(big.Int).Mul(priceInCogs, new(big.Int).SetUint64(callCount))
 
 	paymentExpirationThreshold := orgGroup.PaymentExpirationThreshold
 
@@ -125,7 +140,7 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 				Msg("found channel has different recipient, creating new one")
 			filteredChannel = nil
 		} else {
-			_, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, filteredChannel.ChannelId, currentBlockNumber, privateKey)
+			_, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, filteredChannel.ChannelId, currentBlockNumber, accountSigner)
 			if err != nil {
 				logger.Info().
 					Str("channel_id", filteredChannel.ChannelId.String()).
@@ -139,7 +154,7 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 	if filteredChannel == nil {
 		logger.Info().Msg("creating new payment channel")
 
-		channelID, err := evm.OpenNewChannel(priceInCogs, newExpiration, opts, chans, senders, recipients, groupIDs)
+		channelID, err := evm.OpenNewChannel(increment, newExpiration, opts, chans, senders, recipients, groupIDs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open new channel: %w", err)
 		}
@@ -147,7 +162,7 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 		var channelState *ChannelStateReply
 		for i := 0; i < 5; i++ {
 			time.Sleep(2 * time.Second)
-			channelState, err = GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, channelID, currentBlockNumber, privateKey)
+			channelState, err = GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, channelID, currentBlockNumber, accountSigner)
 			if err == nil {
 				break
 			}
@@ -170,9 +185,17 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 			return nil, errors.New("error while getting signed amount")
 		}
 
-		increment := new(big.Int).Mul(priceInCogs, big.NewInt(int64(callCount)))
 		signedAmount := new(big.Int).Add(currentSignedAmount, increment)
 
+		// The channel was opened after currentBlockNumber, so it is read at the latest block
+		latestCall := util.GetCallOpts(fromAddress, nil)
+		saveChannel(evm, database, mpeAddress, fromAddress, recipient, serviceMetadata.GroupID, channelID, nonce, currentSignedAmount, latestCall)
+
+		opened, err := evm.GetChannel(channelID, latestCall)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get channel: %w", err)
+		}
+
 		grpcClient, err := grpc.GetClient(serviceMetadata.URL)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get gRPC client: %w", err)
@@ -187,14 +210,22 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 		return &PaymentChannelHandler{
 			ethClient:       evm,
 			grpcManager:     grpc,
+			database:        database,
 			serviceMetadata: serviceMetadata,
-			privateKeyECDSA: privateKey,
+			accountSigner:   accountSigner,
 			signerAddress:   fromAddress,
+			sender:          fromAddress,
 			tokenClient:     NewTokenServiceClient(grpcClient.Conn),
 			channelID:       channelID,
 			nonce:           nonce,
 			signedAmount:    signedAmount,
+			daemonAmount:    currentSignedAmount,
+			increment:       increment,
+			callCount:       callCount,
+			channelValue:    opened.Amount,
 			mpeAddress:      mpeAddress,
+			price:           priceInCogs,
+			funded:          opened.Amount,
 		}, nil
 	}
 
@@ -202,19 +233,25 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 		Str("channel_id", filteredChannel.ChannelId.String()).
 		Msg("using existing payment channel")
 
-	filteredChannelState, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, filteredChannel.ChannelId, currentBlockNumber, privateKey)
+	filteredChannelState, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, filteredChannel.ChannelId, currentBlockNumber, accountSigner)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channel state: %w", err)
 	}
 
 	currentSignedAmount := new(big.Int).SetBytes(filteredChannelState.GetCurrentSignedAmount())
 
-	channelID, err := evm.EnsureChannelValidity(filteredChannel, currentSignedAmount, priceInCogs, newExpiration, opts, chans)
+	// A ChannelOpen event only holds the value the channel was opened with, so the current value is read to tell what gets added
+	valueBefore := filteredChannel.Amount
+	if current, err := evm.GetChannel(filteredChannel.ChannelId, opts.Call); err == nil {
+		valueBefore = current.Amount
+	}
+
+	channelID, err := evm.EnsureChannelValidity(filteredChannel, currentSignedAmount, increment, newExpiration, opts, chans)
 	if err != nil {
 		return nil, fmt.Errorf("failed to ensure channel validity: %w", err)
 	}
 
-	channelState, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, channelID, currentBlockNumber, privateKey)
+	channelState, err := GetChannelInfoFromService(grpc, context.Background(), serviceMetadata.URL, mpeAddress, channelID, currentBlockNumber, accountSigner)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get final channel state: %w", err)
 	}
@@ -229,10 +266,20 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 		return nil, errors.New("error while getting signed amount")
 	}
 
-	increment := new(big.Int).Mul(priceInCogs, big.NewInt(int64(callCount)))
 	signedAmount := new(big.Int).Add(currentSignedAmount, increment)
 
-	// TODO: Add signedAmount vs channel amount check
+	// EnsureChannelValidity may have extended or funded the channel after currentBlockNumber, so it is read at the latest block
+	latestCall := util.GetCallOpts(fromAddress, nil)
+	opened, err := evm.GetChannel(channelID, latestCall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	if signedAmount.Cmp(opened.Amount) > 0 {
+		// EnsureChannelValidity funds the channel for the increment, so only a concurrent claim or an unconfirmed top-up gets here
+		return nil, &channelValueError{channelID: channelID, value: opened.Amount, signedAmount: signedAmount}
+	}
+
+	saveChannel(evm, database, mpeAddress, fromAddress, recipient, serviceMetadata.GroupID, channelID, nonce, currentSignedAmount, latestCall)
 
 	grpcClient, err := grpc.GetClient(serviceMetadata.URL)
 	if err != nil {
@@ -248,53 +295,111 @@ func NewPaymentChannelHandler(evm blockchain.Ethereum, grpc *grpcmanager.GRPCCli
 	return &PaymentChannelHandler{
 		ethClient:       evm,
 		grpcManager:     grpc,
+		database:        database,
 		serviceMetadata: serviceMetadata,
-		privateKeyECDSA: privateKey,
+		accountSigner:   accountSigner,
 		signerAddress:   fromAddress,
+		sender:          fromAddress,
 		tokenClient:     NewTokenServiceClient(grpcClient.Conn),
 		channelID:       channelID,
 		nonce:           nonce,
 		signedAmount:    signedAmount,
+		daemonAmount:    currentSignedAmount,
+		increment:       increment,
+		callCount:       callCount,
+		channelValue:    opened.Amount,
 		mpeAddress:      mpeAddress,
+		price:           priceInCogs,
+		funded:          positiveDifference(opened.Amount, valueBefore),
 	}, nil
 }
 
-// UpdateTokenState refreshes the payment handler state and obtains a new authentication token
-func (h *PaymentChannelHandler) UpdateTokenState(ctx context.Context) error {
+// UpdateTokenState refreshes the payment handler state and obtains a new authentication token.
+// The token is reused without re-signing while its planned amount still covers the price of the call.
+// The price is checked and counted under the session lock, so concurrent calls of differently priced methods count their own prices.
+// A renewal holds only the renewal lock while it tops up the channel and waits for the daemon, so the session stays usable meanwhile.
+func (h *PaymentChannelHandler) UpdateTokenState(ctx context.Context, price *big.Int) error {
 	logger := log.With().
 		Str("service_id", h.serviceMetadata.SnetID).
 		Str("channel_id", h.channelID.String()).
 		Logger()
 
+	if h.useToken(price) {
+		return nil
+	}
+
+	h.renewMu.Lock()
+	defer h.renewMu.Unlock()
+
+	// A concurrent call may have renewed the token while this one waited
+	if h.useToken(price) {
+		return nil
+	}
+
 	currentBlockNumber, err := h.ethClient.Client.BlockNumber(ctx)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to get current block number")
 		return fmt.Errorf("failed to get current block: %w", err)
 	}
 
+	// The new token must cover the call being made, also when its method costs more than the price the handler was created for
+	increment := h.increment
+	if batch := new(big.Int).Mul(price, new(big.Int).SetUint64(max(h.callCount, 1))); batch.Cmp(increment) > 0 {
+		increment = batch
+	}
+
+	// Concurrent handlers of the same channel must not sign the same amount
+	reservation, err := channelAmounts.reserve(h.database, h.mpeAddress, h.channelID, h.nonce, h.daemonAmount, increment)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to reserve signed amount")
+		return fmt.Errorf("failed to reserve signed amount: %w", err)
+	}
+	if err := h.coverSignedAmount(ctx, reservation.signedAmount, increment); err != nil {
+		reservation.release(false)
+		logger.Error().Err(err).Msg("channel value does not cover the signed amount")
+		return err
+	}
+	h.mu.Lock()
+	h.signedAmount = reservation.signedAmount
+	h.mu.Unlock()
+
 	// Generate claim signature for the payment channel
-	claimSignature := h.generatePaymentClaimSignature()
+	claimSignature, err := h.generatePaymentClaimSignature()
+	if err != nil {
+		reservation.release(false)
+		return err
+	}
 
 	// Sign the claim with current block number for time-based validation
-	signature := h.signWithBlockNumber(claimSignature, big.NewInt(int64(currentBlockNumber)))
+	signature, err := h.signWithBlockNumber(claimSignature, big.NewInt(int64(currentBlockNumber)))
+	if err != nil {
+		reservation.release(false)
+		return err
+	}
 
 	request := TokenRequest{
 		ChannelId:      h.channelID.Uint64(),
 		CurrentNonce:   h.nonce.Uint64(),
-		SignedAmount:   h.signedAmount.Uint64(),
+		SignedAmount:   reservation.signedAmount.Uint64(),
 		Signature:      signature,
 		CurrentBlock:   currentBlockNumber,
 		ClaimSignature: claimSignature,
 	}
 
 	tokenReply, err := h.tokenClient.GetToken(ctx, &request)
+	reservation.release(err == nil)
 	if err != nil {
 		return fmt.Errorf("failed to get token: %w", err)
 	}
 
+	h.mu.Lock()
 	h.Token = tokenReply.GetToken()
+	h.plannedAmount = tokenReply.GetPlannedAmount()
+	h.usedAmount = tokenReply.GetUsedAmount() + price.Uint64()
+	h.mu.Unlock()
+
 	logger.Debug().
-		Str("token", h.Token).
+		Str("token", tokenReply.GetToken()).
 		Uint64("channel_id", tokenReply.GetChannelId()).
 		Uint64("planned_amount", tokenReply.GetPlannedAmount()).
 		Uint64("used_amount", tokenReply.GetUsedAmount()).
@@ -302,6 +407,140 @@ func (h *PaymentChannelHandler) UpdateTokenState(ctx context.Context) error {
 	return nil
 }
 
+// useToken counts a call of the price against the current token if its planned amount still covers the call
+func (h *PaymentChannelHandler) useToken(price *big.Int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.price = price
+	if h.Token == "" || !h.hasPrepaidAmount(price) {
+		return false
+	}
+	h.usedAmount += price.Uint64()
+
+	log.Debug().
+		Str("service_id", h.serviceMetadata.SnetID).
+		Str("channel_id", h.channelID.String()).
+		Uint64("planned_amount", h.plannedAmount).
+		Uint64("used_amount", h.usedAmount).
+		Msg("reusing prepaid token")
+	return true
+}
+
+// channelValueError reports that a payment channel holds less than the amount to sign for it
+type channelValueError struct {
+	channelID    *big.Int
+	value        *big.Int
+	signedAmount *big.Int
+}
+
+// Error implements the error interface.
+func (e *channelValueError) Error() string {
+	return fmt.Sprintf("payment channel %s holds %s cogs, but %s cogs would be signed", e.channelID, e.value, e.signedAmount)
+}
+
+// coverSignedAmount makes sure the channel value covers the amount about to be signed for a payment of increment cogs.
+// The daemon rejects tokens and claims above the channel value, so a short channel is topped up first.
+// It must not be called with h.mu held; prepaid sessions call it under the renewal lock, which guards the channel value.
+// Channels funded by a user through the payment gateway cannot be topped up on their behalf.
+func (h *PaymentChannelHandler) coverSignedAmount(ctx context.Context, signedAmount, increment *big.Int) error {
+	if h.channelValue == nil || signedAmount.Cmp(h.channelValue) <= 0 {
+		return nil
+	}
+	if h.sender != h.signerAddress {
+		return errInsufficientChannelFunds
+	}
+
+	currentBlockNumber, err := h.ethClient.Client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current block: %w", err)
+	}
+	currentBlock := new(big.Int).SetUint64(currentBlockNumber)
+
+	opts := &blockchain.BindOpts{
+		Call:     util.GetCallOpts(h.sender, currentBlock),
+		Transact: util.GetTransactOpts(h.accountSigner),
+		Watch:    util.GetWatchOpts(currentBlock),
+		Filter:   util.GetFilterOpts(currentBlock),
+	}
+	chans := &blockchain.ChansToWatch{
+		ChannelAddFunds: make(chan *blockchain.MultiPartyEscrowChannelAddFunds),
+		DepositFunds:    make(chan *blockchain.MultiPartyEscrowDepositFunds),
+		Err:             make(chan error),
+	}
+
+	// Another process may have funded the channel already
+	opened, err := h.ethClient.GetChannel(h.channelID, opts.Call)
+	if err != nil {
+		return fmt.Errorf("failed to get channel: %w", err)
+	}
+	h.channelValue = opened.Amount
+	if signedAmount.Cmp(h.channelValue) <= 0 {
+		return nil
+	}
+
+	missing := new(big.Int).Sub(signedAmount, h.channelValue)
+	log.Info().
+		Str("channel_id", h.channelID.String()).
+		Str("channel_value", h.channelValue.String()).
+		Str("signed_amount", signedAmount.String()).
+		Msg("payment channel is short, topping it up")
+
+	added, err := h.ethClient.AddChannelFunds(opened, missing, increment, opts, chans)
+	if err != nil {
+		return err
+	}
+	h.channelValue = new(big.Int).Add(h.channelValue, added)
+
+	h.mu.Lock()
+	if h.funded == nil {
+		h.funded = new(big.Int)
+	}
+	h.funded = new(big.Int).Add(h.funded, added)
+	h.mu.Unlock()
+	return nil
+}
+
+// takeFunding returns the value the handler added to the channel since it was last asked, so it is charged to one call only
+func (h *PaymentChannelHandler) takeFunding() *big.Int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	funded := h.funded
+	h.funded = nil
+	return funded
+}
+
+// positiveDifference returns a - b, or zero if b is larger
+func positiveDifference(a, b *big.Int) *big.Int {
+	difference := new(big.Int).Sub(a, b)
+	if difference.Sign() < 0 {
+		difference.SetInt64(0)
+	}
+	return difference
+}
+
+// hasPrepaidAmount reports whether the planned amount of the current token covers one more call of the price
+func (h *PaymentChannelHandler) hasPrepaidAmount(price *big.Int) bool {
+	return h.plannedAmount >= h.usedAmount+price.Uint64()
+}
+
+// canPay reports whether the current token can still pay for a call of the price.
+// Services with per-method pricing charge different amounts for calls paid from the same session;
+// the price is counted by UpdateTokenState, which renews the token if a concurrent call used it up meanwhile.
+func (h *PaymentChannelHandler) canPay(price *big.Int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.Token == "" || h.hasPrepaidAmount(price)
+}
+
+// Exhausted reports whether the prepaid token can no longer pay for another call of the last price
+func (h *PaymentChannelHandler) Exhausted() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.Token != "" && !h.hasPrepaidAmount(h.price)
+}
+
 // BuildRequestMetadata constructs gRPC metadata for service calls with payment information
 func (h *PaymentChannelHandler) BuildRequestMetadata(ctx context.Context) context.Context {
 	logger := log.With().
@@ -309,16 +548,21 @@ func (h *PaymentChannelHandler) BuildRequestMetadata(ctx context.Context) contex
 		Str("channel_id", h.channelID.String()).
 		Logger()
 
+	// Calls sharing the session may be renewing the token at the same time
+	h.mu.Lock()
+	token, nonce := h.Token, h.nonce.String()
+	h.mu.Unlock()
+
 	logger.Debug().
-		Str("token", h.Token).
+		Str("token", token).
 		Msg("building gRPC request metadata")
 
 	// Construct metadata with payment channel information
 	md := metadata.New(map[string]string{
-		"snet-payment-type":       "prepaid-call",
+		"snet-payment-type":       PrepaidPaymentType,
 		PaymentChannelIDHeader:    h.channelID.String(),
-		PaymentChannelNonceHeader: h.nonce.String(),
-		PrePaidAuthTokenHeader:    h.Token,
+		PaymentChannelNonceHeader: nonce,
+		PrePaidAuthTokenHeader:    token,
 	})
 	return metadata.NewOutgoingContext(ctx, md)
 }
@@ -330,7 +574,7 @@ func (h *PaymentChannelHandler) AvailableFreeCallCount() (uint64, error) {
 }
 
 // generatePaymentClaimSignature creates a cryptographic claim signature for payment validation
-func (h *PaymentChannelHandler) generatePaymentClaimSignature() []byte {
+func (h *PaymentChannelHandler) generatePaymentClaimSignature() ([]byte, error) {
 	// Construct message by concatenating payment claim components
 	message := bytes.Join([][]byte{
 		[]byte(PrefixInSignature),
@@ -339,14 +583,14 @@ func (h *PaymentChannelHandler) generatePaymentClaimSignature() []byte {
 		util.BigIntToBytes(h.nonce),
 		util.BigIntToBytes(h.signedAmount),
 	}, nil)
-	return util.GetSignature(message, h.privateKeyECDSA)
+	return util.GetSignature(message, h.accountSigner)
 }
 
 // signWithBlockNumber creates a time-bounded signature by combining payment signature with current block number
-func (h *PaymentChannelHandler) signWithBlockNumber(paymentSignature []byte, currentBlockNumber *big.Int) []byte {
+func (h *PaymentChannelHandler) signWithBlockNumber(paymentSignature []byte, currentBlockNumber *big.Int) ([]byte, error) {
 	// Convert block number to bytes for signature
 	blockBytes := math.U256Bytes(currentBlockNumber)
 	// Combine payment signature with block number for temporal validation
 	message := bytes.Join([][]byte{paymentSignature, blockBytes}, nil)
-	return util.GetSignature(message, h.privateKeyECDSA)
+	return util.GetSignature(message, h.accountSigner)
 }
@@ -0,0 +1,54 @@
+package snet
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// methodPrice returns the price in cogs of a method in a payment group from the pricing table of a service.
+// Empty group, package or service names match any per-method entry of the method.
+// Methods without an own price cost the default price.
+func methodPrice(prices []db.SnetServicePrice, groupID, packageName, serviceName, methodName string, defaultPrice int) int {
+	for _, price := range prices {
+		if price.PriceModel != blockchain.PriceModelPerMethod || price.MethodName != methodName {
+			continue
+		}
+		if groupID != "" && price.GroupID != "" && price.GroupID != groupID {
+			continue
+		}
+		if packageName != "" && price.PackageName != "" && price.PackageName != packageName {
+			continue
+		}
+		if serviceName != "" && price.ServiceName != "" && price.ServiceName != serviceName {
+			continue
+		}
+		return price.PriceInCogs
+	}
+	return defaultPrice
+}
+
+// pricedService returns a copy of the service whose Price is the price of the invoked method,
+// so that quotes, budgets and the signed amount all use what the daemon will charge.
+func pricedService(database db.Service, snetService *db.SnetService, packageName, serviceName, methodName string) *db.SnetService {
+	prices, err := database.GetSnetServicePrices(snetService.ID)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("service_id", snetService.SnetID).
+			Msg("failed to get pricing table, using the default price")
+		return snetService
+	}
+
+	priced := *snetService
+	priced.Price = methodPrice(prices, snetService.GroupID, packageName, serviceName, methodName, snetService.Price)
+	if priced.Price != snetService.Price {
+		log.Debug().
+			Str("service_id", snetService.SnetID).
+			Str("method", methodName).
+			Int("default_price", snetService.Price).
+			Int("method_price", priced.Price).
+			Msg("using method price")
+	}
+	return &priced
+}
@@ -0,0 +1,332 @@
+package snet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+	"github.com/tensved/bobrix/mxbot"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/internal/matrix"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// Approximate gas limits of the transactions a call may trigger, used to estimate the fee in quotes
+const (
+	approveGas        = 50_000
+	depositAndOpenGas = 250_000
+	openChannelGas    = 200_000
+	depositGas        = 80_000
+	addFundsGas       = 60_000
+	extendGas         = 50_000
+)
+
+// Answers accepted in replies and reactions to a quote
+var (
+	confirmAnswers = []string{"yes", "y", "ok", "confirm", "+", "👍", "✅"}
+	cancelAnswers  = []string{"no", "n", "cancel", "-", "👎", "❌"}
+)
+
+// callQuote describes what a call will cost before any transaction is sent
+type callQuote struct {
+	price        *big.Int // The price of the call in cogs.
+	funding      *big.Int // The amount locked in the payment channel for the following calls, in cogs.
+	transactions []string // The on-chain transactions the call triggers.
+	fee          *big.Int // The estimated fee of the transactions in wei.
+}
+
+// String formats the quote for the Matrix user
+func (q *callQuote) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The call costs %s AGIX (%s cogs).", util.CogToAgix(q.price), q.price)
+	if q.funding.Sign() > 0 {
+		fmt.Fprintf(&b, " %s AGIX will be locked in the payment channel for the following calls.", util.CogToAgix(q.funding))
+	}
+	if len(q.transactions) > 0 {
+		fmt.Fprintf(&b, " This needs %d on-chain transactions (%s)", len(q.transactions), strings.Join(q.transactions, ", "))
+		if q.fee.Sign() > 0 {
+			fmt.Fprintf(&b, " with an estimated fee of %s ETH", decimal.NewFromBigInt(q.fee, -18))
+		}
+		b.WriteString(".")
+	}
+	return b.String()
+}
+
+// quoteCall estimates the price of a call and the channel deposit or extension it triggers
+func quoteCall(eth blockchain.Ethereum, database db.Service, snetService *db.SnetService, accountSigner signer.Signer) (*callQuote, error) {
+	quote := &callQuote{
+		price:   big.NewInt(int64(snetService.Price)),
+		funding: new(big.Int),
+		fee:     new(big.Int),
+	}
+
+	// The user funds the channel on the payment gateway page, which shows the deposit itself
+	if config.Payments.Mode == PaymentModeUser || quote.price.Sign() == 0 {
+		return quote, nil
+	}
+
+	sender := accountSigner.Address()
+	if prepaidSessions.get(prepaidSessionKey(sender, snetService)) != nil {
+		return quote, nil
+	}
+
+	orgGroup, err := database.GetSnetOrgGroup(snetService.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get org group: %w", err)
+	}
+	recipient := common.HexToAddress(orgGroup.PaymentAddress)
+	mpeAddress := common.HexToAddress(snetService.MPEAddress)
+	groupID, err := util.DecodePaymentGroupID(snetService.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode group ID: %w", err)
+	}
+
+	ctx := context.Background()
+	currentBlockNumber, err := eth.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current block: %w", err)
+	}
+	currentBlock := new(big.Int).SetUint64(currentBlockNumber)
+	callOpts := util.GetCallOpts(sender, currentBlock)
+
+	increment := new(big.Int).Mul(quote.price, new(big.Int).SetUint64(max(config.Payments.PrepaidCallBatch, 1)))
+	newExpiration := util.GetNewExpiration(currentBlock, orgGroup.PaymentExpirationThreshold)
+
+	channel := lookupStoredChannel(eth, database, mpeAddress, sender, recipient, snetService.GroupID, callOpts)
+	if channel == nil {
+		channel, err = eth.FilterChannels([]common.Address{sender}, []common.Address{recipient}, [][32]byte{groupID}, util.GetFilterOpts(currentBlock))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if channel != nil && channel.Recipient != recipient {
+		channel = nil
+	}
+
+	missing := increment
+	if channel != nil {
+		signed := new(big.Int)
+		stored, err := database.GetPaymentChannel(mpeAddress.Hex(), sender.Hex(), recipient.Hex(), snetService.GroupID)
+		if err == nil && stored != nil && stored.ChannelID != nil && stored.ChannelID.Cmp(channel.ChannelId) == 0 && stored.SignedAmount != nil {
+			signed = stored.SignedAmount
+		}
+		available := new(big.Int).Sub(channel.Amount, signed)
+		missing = new(big.Int).Sub(increment, available)
+		if missing.Sign() < 0 {
+			missing = new(big.Int)
+		}
+	}
+
+	var gas uint64
+	if missing.Sign() > 0 {
+		quote.funding = missing
+		if channel != nil {
+			// Short channels are topped up for several payments at once
+			quote.funding = blockchain.TopUpAmount(missing, increment)
+		}
+
+		mpeBalance, err := eth.MPE.Balances(callOpts, sender)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get MPE balance: %w", err)
+		}
+		needsDeposit := mpeBalance.Cmp(quote.funding) < 0
+		if needsDeposit && eth.Token != nil {
+			allowance, err := eth.Token.Allowance(callOpts, sender, eth.MPEAddress)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get token allowance: %w", err)
+			}
+			if allowance.Cmp(quote.funding) < 0 {
+				quote.transactions = append(quote.transactions, "token approval")
+				gas += approveGas
+			}
+		}
+
+		switch {
+		case channel == nil && needsDeposit:
+			quote.transactions = append(quote.transactions, "deposit and channel opening")
+			gas += depositAndOpenGas
+		case channel == nil:
+			quote.transactions = append(quote.transactions, "channel opening")
+			gas += openChannelGas
+		case needsDeposit:
+			quote.transactions = append(quote.transactions, "deposit", "channel funding")
+			gas += depositGas + addFundsGas
+		default:
+			quote.transactions = append(quote.transactions, "channel funding")
+			gas += addFundsGas
+		}
+	}
+	if channel != nil && channel.Expiration.Cmp(newExpiration) <= 0 {
+		quote.transactions = append(quote.transactions, "channel extension")
+		gas += extendGas
+	}
+
+	if gas > 0 {
+		gasPrice, err := eth.Client.SuggestGasPrice(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to get gas price for the quote")
+		} else {
+			quote.fee = new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+		}
+	}
+
+	return quote, nil
+}
+
+// confirmThreshold returns the price below which calls in a room run without confirmation
+func confirmThreshold(database db.Service, roomID string) int64 {
+	settings, err := database.GetRoomSettings(roomID)
+	if err != nil {
+		log.Warn().Err(err).Str("room_id", roomID).Msg("failed to get room settings")
+	}
+	if settings != nil && settings.ConfirmThreshold != nil {
+		return *settings.ConfirmThreshold
+	}
+	return config.Payments.ConfirmThreshold
+}
+
+// quoteConfirmationKey builds the key of the call waiting for a user to confirm a quote message
+func quoteConfirmationKey(matrixUserID string, quoteEventID id.EventID) string {
+	return matrixUserID + " " + string(quoteEventID)
+}
+
+// parseQuoteAnswer reports whether a reply or reaction confirms or cancels a quote
+func parseQuoteAnswer(text string) (confirmed, answered bool) {
+	// Reaction keys may carry an emoji variation selector
+	answer := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(text, "\ufe0f", "")))
+	for _, a := range confirmAnswers {
+		if answer == a {
+			return true, true
+		}
+	}
+	for _, a := range cancelAnswers {
+		if answer == a {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// answerQuote runs or cancels the call waiting for the user to confirm a quote message.
+// It reports whether the answer was meant for a pending quote.
+func answerQuote(mx matrix.Service, pending *pendingCalls, roomID id.RoomID, matrixUserID string, quoteEventID id.EventID, text string) bool {
+	if quoteEventID == "" {
+		return false
+	}
+	confirmed, answered := parseQuoteAnswer(text)
+	if !answered {
+		return false
+	}
+
+	run := pending.take(quoteConfirmationKey(matrixUserID, quoteEventID))
+	if run == nil {
+		return false
+	}
+
+	logger := log.With().
+		Str("room_id", string(roomID)).
+		Str("sender", matrixUserID).
+		Str("quote_event_id", string(quoteEventID)).
+		Bool("confirmed", confirmed).
+		Logger()
+
+	logger.Info().Msg("quote answered")
+	if confirmed {
+		go run()
+		return true
+	}
+	if _, err := mx.SendMessage(roomID, "Call cancelled."); err != nil {
+		logger.Error().Err(err).Msg("failed to send cancellation")
+	}
+	return true
+}
+
+// replyText returns the text of a reply without the quoted fallback of the original message
+func replyText(content *event.MessageEventContent) string {
+	if content.FormattedBody != "" {
+		if _, text, err := matrix.ExtractTexts(content.FormattedBody); err == nil {
+			return text
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(content.Body, "\n") {
+		if !strings.HasPrefix(line, ">") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quoteReactionHandler confirms or cancels quoted calls with reactions to the quote message
+func quoteReactionHandler(mx matrix.Service, pending *pendingCalls) func(ctx mxbot.Ctx) error {
+	return func(ctx mxbot.Ctx) error {
+		evt := ctx.Event()
+		reaction := evt.Content.AsReaction()
+		if reaction == nil {
+			return nil
+		}
+		answerQuote(mx, pending, evt.RoomID, evt.Sender.String(), reaction.RelatesTo.EventID, reaction.RelatesTo.Key)
+		return nil
+	}
+}
+
+// quoteCommand handles the !quote command showing and setting the confirmation threshold of a room
+func quoteCommand(database db.Service) func(c mxbot.CommandCtx) error {
+	logger := log.With().
+		Str("command", "quote").
+		Logger()
+
+	return func(c mxbot.CommandCtx) error {
+		roomID := string(c.Event().RoomID)
+		args := commandArgs(c)
+
+		logger.Debug().
+			Str("room", roomID).
+			Str("sender", c.Event().Sender.String()).
+			Strs("args", args).
+			Msg("quote command received")
+
+		var answer string
+		switch {
+		case len(args) == 0:
+			threshold := confirmThreshold(database, roomID)
+			answer = "Every paid call in this room needs confirmation."
+			if threshold > 0 {
+				answer = fmt.Sprintf("Calls cheaper than %s AGIX run without confirmation in this room.", util.CogToAgix(big.NewInt(threshold)))
+			}
+		case args[0] == "default":
+			if err := database.SaveRoomSettings(&db.RoomSettings{RoomID: roomID}); err != nil {
+				return c.TextAnswer("Failed to save the threshold.")
+			}
+			answer = "The room uses the default confirmation threshold now."
+		case args[0] == "threshold" && len(args) == 2:
+			amount, err := util.AgixToCog(args[1])
+			if err != nil || amount.Sign() < 0 || !amount.IsInt64() {
+				return c.TextAnswer("Invalid amount. Usage: !quote threshold <AGIX>")
+			}
+			threshold := amount.Int64()
+			if err := database.SaveRoomSettings(&db.RoomSettings{RoomID: roomID, ConfirmThreshold: &threshold}); err != nil {
+				return c.TextAnswer("Failed to save the threshold.")
+			}
+			answer = fmt.Sprintf("Calls cheaper than %s AGIX run without confirmation in this room now.", util.CogToAgix(amount))
+		default:
+			answer = "Usage: !quote [threshold <AGIX>|default]"
+		}
+
+		err := c.TextAnswer(answer)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to send quote answer")
+		}
+		return err
+	}
+}
@@ -3,7 +3,6 @@ package snet
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"math/big"
@@ -17,16 +16,14 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog/log"
 	"github.com/tensved/bobrix/contracts"
 
-	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/internal/grpcmanager"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
 
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -43,6 +40,7 @@ type Handler struct {
 	ETH            blockchain.Ethereum
 	DB             db.Service
 	GRPCManager    *grpcmanager.GRPCClientManager
+	Descriptors    *DescriptorCache
 	InputMsg       *dynamicpb.Message
 	OutputMsg      *dynamicpb.Message
 }
@@ -80,7 +78,7 @@ type bindOpts struct {
 	filter   *bind.FilterOpts
 }
 
-func NewHandler(descriptorName, snetID, serviceName, methodName string, inputMsg, outputMsg *dynamicpb.Message, eth blockchain.Ethereum, db db.Service, grpc *grpcmanager.GRPCClientManager) *Handler {
+func NewHandler(descriptorName, snetID, serviceName, methodName string, inputMsg, outputMsg *dynamicpb.Message, eth blockchain.Ethereum, db db.Service, grpc *grpcmanager.GRPCClientManager, descriptors *DescriptorCache) *Handler {
 
 	return &Handler{
 		DescriptorName: descriptorName,
@@ -90,12 +88,13 @@ func NewHandler(descriptorName, snetID, serviceName, methodName string, inputMsg
 		ETH:            eth,
 		DB:             db,
 		GRPCManager:    grpc,
+		Descriptors:    descriptors,
 		InputMsg:       inputMsg,
 		OutputMsg:      outputMsg,
 	}
 }
 
-func NewService(serviceDescriptor protoreflect.ServiceDescriptor, descriptorName, snetID, serviceName string, eth blockchain.Ethereum, db db.Service, grpc *grpcmanager.GRPCClientManager) *contracts.Service {
+func NewService(serviceDescriptor protoreflect.ServiceDescriptor, descriptorName, snetID, serviceName string, eth blockchain.Ethereum, db db.Service, grpc *grpcmanager.GRPCClientManager, descriptors *DescriptorCache) *contracts.Service {
 	service := &contracts.Service{
 		Name:        snetID,
 		Description: map[string]string{"en": serviceName},
@@ -154,7 +153,7 @@ func NewService(serviceDescriptor protoreflect.ServiceDescriptor, descriptorName
 				method.Handler = &contracts.Handler{
 					Name: method.Name,
 					Do: func(ctx contracts.HandlerContext) error {
-						handler := NewHandler(descriptorName, snetID, serviceName, method.Name, inputMsg, outputMsg, eth, db, grpc)
+						handler := NewHandler(descriptorName, snetID, serviceName, method.Name, inputMsg, outputMsg, eth, db, grpc, descriptors)
 						inputData := make(map[string]any)
 						for name, input := range ctx.Inputs() {
 							inputData[name] = input.Value()
@@ -203,27 +202,16 @@ func (h *Handler) Do(inputData map[string]any) *contracts.MethodResponse {
 		Str("service_name", snetService.DisplayName).
 		Msg("retrieved service from database")
 
-	privateKey, err := crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
+	// Requests dispatched by bobrix carry no Matrix sender, so they are paid by the admin account
+	accountSigner, err := resolveSigner(nil, "")
 	if err != nil {
-		logger.Error().Err(err).Msg("failed to parse private key")
+		logger.Error().Err(err).Msg("failed to resolve signer")
 		return &contracts.MethodResponse{
 			Err: err,
 		}
 	}
 
-	protoFiles, err := getProtoFilesForService(snetService)
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to get proto files")
-		return &contracts.MethodResponse{
-			Err: err,
-		}
-	}
-
-	logger.Debug().
-		Int("proto_files_count", len(protoFiles)).
-		Msg("retrieved proto files")
-
-	paymentManager := NewPaymentManager(h.ETH, h.DB, h.GRPCManager, privateKey, protoFiles)
+	paymentManager := NewPaymentManager(h.ETH, h.DB, h.GRPCManager, accountSigner, h.Descriptors)
 
 	result, err := paymentManager.ExecuteCall(context.Background(), snetService, h.MethodName, inputData)
 	if err != nil {
@@ -305,7 +293,7 @@ func (h *Handler) getChannelStateFromBlockchain(channelID *big.Int) (channel *Mu
 }
 
 // Deprecated: getChannelStateFromDaemon retrieves channel state from daemon.
-func (h *Handler) getChannelStateFromDaemon(serviceURL string, channelID, lastBlockNumber *big.Int, privateKeyECDSA *ecdsa.PrivateKey) (*ChannelStateReply, error) {
+func (h *Handler) getChannelStateFromDaemon(serviceURL string, channelID, lastBlockNumber *big.Int, accountSigner signer.Signer) (*ChannelStateReply, error) {
 	logger := log.With().
 		Str("service_url", serviceURL).
 		Str("channel_id", channelID.String()).
@@ -327,7 +315,10 @@ func (h *Handler) getChannelStateFromDaemon(serviceURL string, channelID, lastBl
 
 	client := NewPaymentChannelStateServiceClient(grpcService.Conn)
 
-	signature := h.getSignatureToGetChannelStateFromDaemon(channelID, lastBlockNumber, privateKeyECDSA)
+	signature, err := h.getSignatureToGetChannelStateFromDaemon(channelID, lastBlockNumber, accountSigner)
+	if err != nil {
+		return nil, err
+	}
 
 	request := &ChannelStateRequest{
 		ChannelId:    util.BigIntToBytes(channelID),
@@ -347,7 +338,7 @@ func (h *Handler) getChannelStateFromDaemon(serviceURL string, channelID, lastBl
 }
 
 // Deprecated: getSignatureToGetChannelStateFromDaemon creates signature for channel state request.
-func (h *Handler) getSignatureToGetChannelStateFromDaemon(channelID, lastBlockNumber *big.Int, privateKeyECDSA *ecdsa.PrivateKey) []byte {
+func (h *Handler) getSignatureToGetChannelStateFromDaemon(channelID, lastBlockNumber *big.Int, accountSigner signer.Signer) ([]byte, error) {
 	message := bytes.Join([][]byte{
 		[]byte(prefixGetChannelState),
 		h.ETH.MPEAddress.Bytes(),
@@ -355,12 +346,11 @@ func (h *Handler) getSignatureToGetChannelStateFromDaemon(channelID, lastBlockNu
 		math.U256Bytes(lastBlockNumber),
 	}, nil)
 
-	signature := util.GetSignature(message, privateKeyECDSA)
-	return signature
+	return util.GetSignature(message, accountSigner)
 }
 
 // Deprecated: getMetadataToInvokeMethod creates metadata for method invocation.
-func (h *Handler) getMetadataToInvokeMethod(channelID, nonce *big.Int, totalAmount int64, privateKeyECDSA *ecdsa.PrivateKey) metadata.MD {
+func (h *Handler) getMetadataToInvokeMethod(channelID, nonce *big.Int, totalAmount int64, accountSigner signer.Signer) (metadata.MD, error) {
 	message := bytes.Join([][]byte{
 		[]byte(blockchain.PrefixInSignature),
 		h.ETH.MPEAddress.Bytes(),
@@ -369,7 +359,10 @@ func (h *Handler) getMetadataToInvokeMethod(channelID, nonce *big.Int, totalAmou
 		util.BigIntToBytes(big.NewInt(totalAmount)),
 	}, nil)
 
-	signature := util.GetSignature(message, privateKeyECDSA)
+	signature, err := util.GetSignature(message, accountSigner)
+	if err != nil {
+		return nil, err
+	}
 
 	md := metadata.New(map[string]string{
 		"snet-payment-type":                  "escrow",
@@ -378,7 +371,7 @@ func (h *Handler) getMetadataToInvokeMethod(channelID, nonce *big.Int, totalAmou
 		"snet-payment-channel-amount":        strconv.Itoa(int(totalAmount)),
 		"snet-payment-channel-signature-bin": string(signature),
 	})
-	return md
+	return md, nil
 }
 
 // Deprecated: callMethod calls a service method via gRPC.
@@ -508,23 +501,15 @@ func (h *Handler) filterChannels(senders, recipients []common.Address, groupIDs
 	return filteredEvent, nil
 }
 
-// Deprecated: getFromAddressAndPrivateKeyECDSA retrieves address and private key.
-func (h *Handler) getFromAddressAndPrivateKeyECDSA() (common.Address, *ecdsa.PrivateKey, error) {
-	privateKeyECDSA, err := crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
+// Deprecated: getFromAddressAndSigner retrieves address and signer of the admin account.
+func (h *Handler) getFromAddressAndSigner() (common.Address, signer.Signer, error) {
+	adminSigner, err := signer.Admin()
 	if err != nil {
 		return common.Address{}, nil, err
 	}
 
-	publicKey := privateKeyECDSA.Public()
-
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return common.Address{}, nil, errors.New("failed to get public key")
-	}
-
 	// sender/signer address
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	return fromAddress, privateKeyECDSA, nil
+	return adminSigner.Address(), adminSigner, nil
 }
 
 // Deprecated: watchChannelOpen watches for channel open events.
@@ -585,20 +570,17 @@ func (h *Handler) selectPaymentChannel(openedChannel *blockchain.MultiPartyEscro
 	amount := new(big.Int)
 	amount.SetString("1000000000000000000", 10)
 
-	privateKeyECDSA, err := crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
+	adminSigner, err := signer.Admin()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	chainID, err := h.ETH.Client.NetworkID(context.Background())
+	chainID, err := h.ETH.Client.ChainID(context.Background())
 	if err != nil {
 		return nil, nil, err
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKeyECDSA, chainID)
-	if err != nil {
-		return nil, nil, err
-	}
+	auth := signer.TransactOpts(adminSigner, chainID)
 
 	var channelID *big.Int
 	var nonce *big.Int
@@ -766,7 +748,7 @@ func (h *Handler) getLastBlockNumber() *big.Int {
 }
 
 // Deprecated: waitForTransaction waits for transaction confirmation.
-func waitForTransaction(client *ethclient.Client, tx *types.Transaction) (*types.Receipt, error) {
+func waitForTransaction(client blockchain.Client, tx *types.Transaction) (*types.Receipt, error) {
 	ctx := context.Background()
 	txHash := tx.Hash()
 
@@ -0,0 +1,128 @@
+package snettest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/tensved/snet-matrix-framework/internal/syncer"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// CalculatorProtoFile is the name of the proto file of the sample service.
+	CalculatorProtoFile = "example_service.proto"
+	// CalculatorProto is the proto source of the sample service, the calculator of the SingularityNET example service.
+	CalculatorProto = `syntax = "proto3";
+
+package example_service;
+
+message Numbers {
+    float a = 1;
+    float b = 2;
+}
+
+message Result {
+    float value = 1;
+}
+
+service Calculator {
+    rpc add(Numbers) returns (Result) {}
+    rpc sub(Numbers) returns (Result) {}
+    rpc mul(Numbers) returns (Result) {}
+    rpc div(Numbers) returns (Result) {}
+}
+`
+)
+
+// CalculatorProtoFiles returns the proto files of the sample service by file name, as published in IPFS.
+func CalculatorProtoFiles() map[string]string {
+	return map[string]string{CalculatorProtoFile: CalculatorProto}
+}
+
+// CalculatorServiceProtos returns the proto files of the sample service with their compiled descriptors,
+// in the form the syncer stores them for PaymentManager.
+func CalculatorServiceProtos() (*db.ServiceProtos, error) {
+	file, err := compileCalculator()
+	if err != nil {
+		return nil, err
+	}
+	return syncer.NewServiceProtos(CalculatorProtoFiles(), []protoreflect.FileDescriptor{file})
+}
+
+// compileCalculator compiles the proto file of the sample service.
+func compileCalculator() (protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{Accessor: protocompile.SourceAccessorFromMap(CalculatorProtoFiles())},
+	}
+	files, err := compiler.Compile(context.Background(), CalculatorProtoFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile calculator proto: %w", err)
+	}
+	return files[0], nil
+}
+
+// calculatorServiceDesc describes the sample service for the gRPC server.
+// Requests and replies are dynamic messages of the compiled proto, so the service needs no generated code.
+func (d *Daemon) calculatorServiceDesc() (*grpc.ServiceDesc, error) {
+	file, err := compileCalculator()
+	if err != nil {
+		return nil, err
+	}
+	service := file.Services().Get(0)
+
+	desc := &grpc.ServiceDesc{
+		ServiceName: string(service.FullName()),
+		HandlerType: (*any)(nil),
+		Metadata:    CalculatorProtoFile,
+	}
+	for i := 0; i < service.Methods().Len(); i++ {
+		method := service.Methods().Get(i)
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(method.Name()),
+			Handler:    d.calculatorHandler(method),
+		})
+	}
+	return desc, nil
+}
+
+// calculatorHandler charges the payment sent with a call and answers it
+func (d *Daemon) calculatorHandler(method protoreflect.MethodDescriptor) grpc.MethodHandler {
+	return func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		in := dynamicpb.NewMessage(method.Input())
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if err := d.charge(ctx); err != nil {
+			return nil, err
+		}
+
+		fields := method.Input().Fields()
+		a := in.Get(fields.ByName("a")).Float()
+		b := in.Get(fields.ByName("b")).Float()
+
+		var value float64
+		switch method.Name() {
+		case "add":
+			value = a + b
+		case "sub":
+			value = a - b
+		case "mul":
+			value = a * b
+		case "div":
+			if b == 0 {
+				return nil, status.Error(codes.InvalidArgument, "division by zero")
+			}
+			value = a / b
+		}
+
+		out := dynamicpb.NewMessage(method.Output())
+		out.Set(method.Output().Fields().ByName("value"), protoreflect.ValueOfFloat32(float32(value)))
+		return out, nil
+	}
+}
@@ -0,0 +1,448 @@
+// Package snettest runs a fake SingularityNET daemon in process, so that payment strategies
+// can be tested end to end against a simulated chain without a real daemon or network.
+package snettest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tensved/snet-matrix-framework/internal/snet"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DaemonConfig describes the service a fake daemon sells.
+type DaemonConfig struct {
+	ETH        blockchain.Ethereum // The chain payment channels are read from.
+	OrgID      string              // The organization ID of the service, part of free call signatures.
+	ServiceID  string              // The service ID, part of free call signatures.
+	GroupID    string              // The base64-encoded payment group ID, part of free call signatures.
+	Price      *big.Int            // The price of a call in cogs.
+	FreeCalls  uint64              // The number of free calls granted to each user.
+	EscrowOnly bool                // Serve without TokenService, like daemons accepting classic escrow payments only.
+}
+
+// channelState is what the daemon knows about a payment channel
+type channelState struct {
+	nonce        *big.Int // The nonce the amounts were signed for.
+	signedAmount *big.Int // The highest amount signed by the client, the planned amount of prepaid calls.
+	usedAmount   *big.Int // The amount consumed by prepaid calls.
+	signature    []byte   // The claim signature of the signed amount.
+	token        string   // The prepaid token issued for the channel.
+}
+
+// Daemon is a fake daemon serving TokenService, PaymentChannelStateService, FreeCallStateService,
+// gRPC health and the sample calculator service. Like the real daemon it checks every signature
+// against the on-chain signer of the channel, the amounts against the channel value and every call
+// against the payment it carries. It does not check how recent the signed block numbers are.
+type Daemon struct {
+	snet.UnimplementedTokenServiceServer
+	snet.UnimplementedPaymentChannelStateServiceServer
+	snet.UnimplementedFreeCallStateServiceServer
+
+	URL string // The URL clients reach the daemon at.
+
+	config    DaemonConfig
+	mu        sync.Mutex               // A mutex to ensure thread-safe access to the state below.
+	channels  map[string]*channelState // The state of payment channels by channel ID.
+	tokens    map[string]string        // The channel IDs by prepaid token.
+	freeCalls map[string]uint64        // The free calls used by user ID.
+	calls     map[string]int           // The answered calls by payment type.
+}
+
+// NewDaemon starts a fake daemon listening on a free local port. It is stopped when the test finishes.
+//
+// Parameters:
+//   - tb: The test the daemon is used by.
+//   - config: The service the daemon sells.
+//
+// Returns:
+//   - *Daemon: The running daemon.
+func NewDaemon(tb testing.TB, config DaemonConfig) *Daemon {
+	tb.Helper()
+
+	d := &Daemon{
+		config:    config,
+		channels:  make(map[string]*channelState),
+		tokens:    make(map[string]string),
+		freeCalls: make(map[string]uint64),
+		calls:     make(map[string]int),
+	}
+
+	calculator, err := d.calculatorServiceDesc()
+	if err != nil {
+		tb.Fatalf("failed to describe calculator service: %v", err)
+	}
+
+	server := grpc.NewServer()
+	if !config.EscrowOnly {
+		snet.RegisterTokenServiceServer(server, d)
+	}
+	snet.RegisterPaymentChannelStateServiceServer(server, d)
+	snet.RegisterFreeCallStateServiceServer(server, d)
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	server.RegisterService(calculator, d)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("failed to listen: %v", err)
+	}
+	d.URL = "http://" + listener.Addr().String()
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	tb.Cleanup(server.Stop)
+	return d
+}
+
+// SignedAmount returns the highest amount the client signed for a channel, nil if the channel is unknown.
+func (d *Daemon) SignedAmount(channelID *big.Int) *big.Int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.channels[channelID.String()]
+	if !ok {
+		return nil
+	}
+	return new(big.Int).Set(state.signedAmount)
+}
+
+// Calls returns the number of calls answered with a payment of the type, e.g. snet.PrepaidPaymentType.
+func (d *Daemon) Calls(paymentType string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[paymentType]
+}
+
+// GetChannelState returns the nonce and the amount last signed for a channel to its sender or signer.
+func (d *Daemon) GetChannelState(_ context.Context, request *snet.ChannelStateRequest) (*snet.ChannelStateReply, error) {
+	channelID := new(big.Int).SetBytes(request.GetChannelId())
+	channel, err := d.onChainChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := bytes.Join([][]byte{
+		[]byte("__get_channel_state"),
+		d.config.ETH.MPEAddress.Bytes(),
+		util.BigIntToBytes(channelID),
+		math.U256Bytes(new(big.Int).SetUint64(request.GetCurrentBlock())),
+	}, nil)
+	address, err := recoverSigner(message, request.GetSignature())
+	if err != nil {
+		return nil, err
+	}
+	if address != channel.Sender && address != channel.Signer {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is neither sender nor signer of channel %s", address.Hex(), channelID)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.channelState(channel)
+	return &snet.ChannelStateReply{
+		CurrentNonce:        state.nonce.Bytes(),
+		CurrentSignedAmount: state.signedAmount.Bytes(),
+		CurrentSignature:    state.signature,
+	}, nil
+}
+
+// GetToken checks the claim signed for a channel and returns a prepaid token for the signed amount.
+func (d *Daemon) GetToken(_ context.Context, request *snet.TokenRequest) (*snet.TokenReply, error) {
+	channelID := new(big.Int).SetUint64(request.GetChannelId())
+	channel, err := d.onChainChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := new(big.Int).SetUint64(request.GetCurrentNonce())
+	signedAmount := new(big.Int).SetUint64(request.GetSignedAmount())
+	if err := d.verifyClaim(channel, nonce, signedAmount, request.GetClaimSignature()); err != nil {
+		return nil, err
+	}
+
+	message := bytes.Join([][]byte{
+		request.GetClaimSignature(),
+		math.U256Bytes(new(big.Int).SetUint64(request.GetCurrentBlock())),
+	}, nil)
+	address, err := recoverSigner(message, request.GetSignature())
+	if err != nil {
+		return nil, err
+	}
+	if address != channel.Signer {
+		return nil, status.Errorf(codes.Unauthenticated, "token request is signed by %s, not by the channel signer", address.Hex())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.channelState(channel)
+	if nonce.Cmp(state.nonce) != 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "nonce %s differs from the channel nonce %s", nonce, state.nonce)
+	}
+	if signedAmount.Cmp(state.signedAmount) < 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "signed amount %s is below the amount %s signed before", signedAmount, state.signedAmount)
+	}
+	state.signedAmount = signedAmount
+	state.signature = request.GetClaimSignature()
+
+	if state.token == "" {
+		state.token = rand.Text()
+		d.tokens[state.token] = channelID.String()
+	}
+
+	return &snet.TokenReply{
+		ChannelId:     request.GetChannelId(),
+		Token:         state.token,
+		PlannedAmount: state.signedAmount.Uint64(),
+		UsedAmount:    state.usedAmount.Uint64(),
+	}, nil
+}
+
+// GetFreeCallToken issues a free call token to a user who signed the request.
+func (d *Daemon) GetFreeCallToken(_ context.Context, request *snet.GetFreeCallTokenRequest) (*snet.FreeCallToken, error) {
+	message := d.freeCallMessage(request.GetAddress(), request.GetUserId(), request.GetCurrentBlock(), nil)
+	if err := verifyFreeCallSignature(message, request.GetSignature(), request.GetAddress()); err != nil {
+		return nil, err
+	}
+
+	expirationBlock := request.GetCurrentBlock() + request.GetTokenLifetimeInBlocks()
+	token := []byte(rand.Text() + "_" + strconv.FormatUint(expirationBlock, 10))
+	return &snet.FreeCallToken{
+		Token:                token,
+		TokenHex:             hex.EncodeToString(token),
+		TokenExpirationBlock: expirationBlock,
+	}, nil
+}
+
+// GetFreeCallsAvailable returns the number of free calls a user has left.
+func (d *Daemon) GetFreeCallsAvailable(_ context.Context, request *snet.FreeCallStateRequest) (*snet.FreeCallStateReply, error) {
+	message := d.freeCallMessage(request.GetAddress(), request.GetUserId(), request.GetCurrentBlock(), request.GetFreeCallToken())
+	if err := verifyFreeCallSignature(message, request.GetSignature(), request.GetAddress()); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return &snet.FreeCallStateReply{
+		FreeCallsAvailable: d.config.FreeCalls - min(d.freeCalls[request.GetUserId()], d.config.FreeCalls),
+	}, nil
+}
+
+// charge checks the payment sent with a call of the sample service and books it
+func (d *Daemon) charge(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	paymentType := header(blockchain.PaymentTypeHeader)
+	var err error
+	switch paymentType {
+	case snet.PrepaidPaymentType:
+		err = d.chargePrepaid(header(snet.PrePaidAuthTokenHeader), header(blockchain.PaymentChannelNonceHeader))
+	case snet.EscrowPaymentType:
+		err = d.chargeEscrow(header(blockchain.PaymentChannelIDHeader), header(blockchain.PaymentChannelNonceHeader),
+			header(blockchain.PaymentChannelAmountHeader), []byte(header(blockchain.PaymentChannelSignatureHeader)))
+	case snet.FreeCallPaymentType:
+		err = d.chargeFreeCall(header(blockchain.UserInfoHeader), header(blockchain.FreeCallUserIdHeader), header(blockchain.CurrentBlockNumberHeader),
+			[]byte(header(blockchain.FreeCallAuthTokenHeader)), []byte(header(blockchain.PaymentChannelSignatureHeader)))
+	default:
+		err = status.Errorf(codes.Unauthenticated, "unsupported payment type %q", paymentType)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.calls[paymentType]++
+	d.mu.Unlock()
+	return nil
+}
+
+// chargePrepaid takes the price of a call from the planned amount of a prepaid token
+func (d *Daemon) chargePrepaid(token, nonce string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	channelID, ok := d.tokens[token]
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unknown prepaid token")
+	}
+	state := d.channels[channelID]
+	if state.nonce.String() != nonce {
+		return status.Errorf(codes.Unauthenticated, "nonce %s differs from the channel nonce %s", nonce, state.nonce)
+	}
+
+	used := new(big.Int).Add(state.usedAmount, d.config.Price)
+	if used.Cmp(state.signedAmount) > 0 {
+		return status.Errorf(codes.Unauthenticated, "planned amount %s is used up", state.signedAmount)
+	}
+	state.usedAmount = used
+	return nil
+}
+
+// chargeEscrow checks a claim signed for exactly one more call
+func (d *Daemon) chargeEscrow(channelIDHeader, nonceHeader, amountHeader string, signature []byte) error {
+	channelID, ok1 := new(big.Int).SetString(channelIDHeader, 10)
+	nonce, ok2 := new(big.Int).SetString(nonceHeader, 10)
+	amount, ok3 := new(big.Int).SetString(amountHeader, 10)
+	if !ok1 || !ok2 || !ok3 {
+		return status.Error(codes.InvalidArgument, "invalid payment headers")
+	}
+
+	channel, err := d.onChainChannel(channelID)
+	if err != nil {
+		return err
+	}
+	if err := d.verifyClaim(channel, nonce, amount, signature); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.channelState(channel)
+	if nonce.Cmp(state.nonce) != 0 {
+		return status.Errorf(codes.Unauthenticated, "nonce %s differs from the channel nonce %s", nonce, state.nonce)
+	}
+	if increment := new(big.Int).Sub(amount, state.signedAmount); increment.Cmp(d.config.Price) != 0 {
+		return status.Errorf(codes.Unauthenticated, "signed amount grows by %s, the price is %s", increment, d.config.Price)
+	}
+	state.signedAmount = amount
+	state.signature = signature
+	return nil
+}
+
+// chargeFreeCall checks a free call token and takes one of the free calls of the user
+func (d *Daemon) chargeFreeCall(address, userID, currentBlock string, token, signature []byte) error {
+	block, err := strconv.ParseUint(currentBlock, 10, 64)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid current block")
+	}
+	if err := verifyFreeCallSignature(d.freeCallMessage(address, userID, block, token), signature, address); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.freeCalls[userID] >= d.config.FreeCalls {
+		return status.Error(codes.Unauthenticated, "free calls are used up")
+	}
+	d.freeCalls[userID]++
+	return nil
+}
+
+// verifyClaim checks that the channel signer signed the amount and that the channel value covers it
+func (d *Daemon) verifyClaim(channel *blockchain.MultiPartyEscrowChannelOpen, nonce, amount *big.Int, signature []byte) error {
+	message := bytes.Join([][]byte{
+		[]byte(snet.PrefixInSignature),
+		d.config.ETH.MPEAddress.Bytes(),
+		util.BigIntToBytes(channel.ChannelId),
+		util.BigIntToBytes(nonce),
+		util.BigIntToBytes(amount),
+	}, nil)
+	address, err := recoverSigner(message, signature)
+	if err != nil {
+		return err
+	}
+	if address != channel.Signer {
+		return status.Errorf(codes.Unauthenticated, "claim is signed by %s, not by the channel signer", address.Hex())
+	}
+	if amount.Cmp(channel.Amount) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "signed amount %s exceeds the channel value %s", amount, channel.Amount)
+	}
+	return nil
+}
+
+// onChainChannel reads a channel from the MPE contract
+func (d *Daemon) onChainChannel(channelID *big.Int) (*blockchain.MultiPartyEscrowChannelOpen, error) {
+	channel, err := d.config.ETH.GetChannel(channelID, nil)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return channel, nil
+}
+
+// channelState returns the state of a channel, starting a new one when the on-chain nonce moved on.
+// The caller must hold d.mu.
+func (d *Daemon) channelState(channel *blockchain.MultiPartyEscrowChannelOpen) *channelState {
+	key := channel.ChannelId.String()
+	state, ok := d.channels[key]
+	if !ok || state.nonce.Cmp(channel.Nonce) != 0 {
+		state = &channelState{
+			nonce:        channel.Nonce,
+			signedAmount: new(big.Int),
+			usedAmount:   new(big.Int),
+		}
+		d.channels[key] = state
+	}
+	return state
+}
+
+// freeCallMessage builds the message a user signs for free call requests; the token is appended when present
+func (d *Daemon) freeCallMessage(address, userID string, currentBlock uint64, token []byte) []byte {
+	return bytes.Join([][]byte{
+		[]byte(blockchain.FreeCallPrefixSignature),
+		[]byte(address),
+		[]byte(userID),
+		[]byte(d.config.OrgID),
+		[]byte(d.config.ServiceID),
+		[]byte(d.config.GroupID),
+		math.U256Bytes(new(big.Int).SetUint64(currentBlock)),
+		token,
+	}, nil)
+}
+
+// verifyFreeCallSignature checks that a free call message is signed by the address
+func verifyFreeCallSignature(message, signature []byte, address string) error {
+	signer, err := recoverSigner(message, signature)
+	if err != nil {
+		return err
+	}
+	if signer != common.HexToAddress(address) {
+		return status.Errorf(codes.Unauthenticated, "free call request is signed by %s, not by %s", signer.Hex(), address)
+	}
+	return nil
+}
+
+// recoverSigner returns the address that signed the Keccak-256 hash of the message as an Ethereum signed message,
+// the scheme of util.GetSignature
+func recoverSigner(message, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, status.Errorf(codes.Unauthenticated, "signature has %d bytes", len(signature))
+	}
+	sig := bytes.Clone(signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	publicKey, err := crypto.SigToPub(accounts.TextHash(crypto.Keccak256(message)), sig)
+	if err != nil {
+		return common.Address{}, status.Error(codes.Unauthenticated, fmt.Errorf("failed to recover signer: %w", err).Error())
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
@@ -0,0 +1,157 @@
+package snettest
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+// Database is an in-memory db.Service holding the org groups, payment channels and call ledger
+// the payment strategies use. Other methods are left to the embedded nil db.Service and panic when called.
+type Database struct {
+	db.Service
+
+	mu       sync.Mutex                    // A mutex to ensure thread-safe access to the maps below.
+	groups   map[string]db.SnetOrgGroup    // The org groups by group ID.
+	channels map[string]*db.PaymentChannel // The payment channels by MPE address, sender, recipient and group ID.
+	calls    []db.ServiceCall              // The call ledger.
+	protos   map[string]*db.ServiceProtos  // The proto sources and descriptors by content hash.
+}
+
+// NewDatabase creates an empty in-memory database.
+func NewDatabase() *Database {
+	return &Database{
+		groups:   make(map[string]db.SnetOrgGroup),
+		channels: make(map[string]*db.PaymentChannel),
+		protos:   make(map[string]*db.ServiceProtos),
+	}
+}
+
+// AddOrgGroup stores an org group, e.g. the payment group of the service a daemon sells.
+func (d *Database) AddOrgGroup(group db.SnetOrgGroup) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groups[group.GroupID] = group
+}
+
+// ServiceCalls returns the recorded service calls, oldest first.
+func (d *Database) ServiceCalls() []db.ServiceCall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.calls)
+}
+
+// GetSnetOrgGroup retrieves an org group by its ID.
+func (d *Database) GetSnetOrgGroup(groupID string) (db.SnetOrgGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.groups[groupID], nil
+}
+
+// GetServiceProtos retrieves proto sources and their descriptors by content hash, nil if there are none.
+func (d *Database) GetServiceProtos(contentHash string) (*db.ServiceProtos, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.protos[contentHash], nil
+}
+
+// SaveServiceProtos stores proto sources and their descriptors.
+func (d *Database) SaveServiceProtos(protos *db.ServiceProtos) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.protos[protos.ContentHash] = protos
+	return nil
+}
+
+// GetSnetServicePrices returns no pricing table, so every method costs the default price.
+func (d *Database) GetSnetServicePrices(int) ([]db.SnetServicePrice, error) {
+	return nil, nil
+}
+
+// GetPaymentChannel retrieves the active payment channel between a sender and a recipient group, nil if there is none.
+func (d *Database) GetPaymentChannel(mpeAddress, sender, recipient, groupID string) (*db.PaymentChannel, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	channel, ok := d.channels[channelKey(mpeAddress, sender, recipient, groupID)]
+	if !ok || channel.DeletedAt != nil {
+		return nil, nil
+	}
+	stored := *channel
+	return &stored, nil
+}
+
+// SavePaymentChannel creates or updates a payment channel.
+func (d *Database) SavePaymentChannel(channel *db.PaymentChannel) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stored := *channel
+	stored.UpdatedAt = time.Now()
+	d.channels[channelKey(channel.MPEAddress, channel.Sender, channel.Recipient, channel.GroupID)] = &stored
+	return nil
+}
+
+// UpdatePaymentChannelSignedAmount updates the nonce and the last signed amount of a payment channel.
+func (d *Database) UpdatePaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, channel := range d.channels {
+		if strings.EqualFold(channel.MPEAddress, mpeAddress) && channel.ChannelID.Cmp(channelID) == 0 {
+			channel.Nonce = nonce
+			channel.SignedAmount = signedAmount
+			channel.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+// RevertPaymentChannelSignedAmount lowers the last signed amount of a payment channel for the same nonce.
+func (d *Database) RevertPaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, channel := range d.channels {
+		if strings.EqualFold(channel.MPEAddress, mpeAddress) && channel.ChannelID.Cmp(channelID) == 0 &&
+			channel.Nonce != nil && channel.Nonce.Cmp(nonce) == 0 && channel.SignedAmount != nil && channel.SignedAmount.Cmp(signedAmount) > 0 {
+			channel.SignedAmount = signedAmount
+			channel.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+// DeletePaymentChannel marks a payment channel as deleted.
+func (d *Database) DeletePaymentChannel(mpeAddress string, channelID *big.Int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for _, channel := range d.channels {
+		if strings.EqualFold(channel.MPEAddress, mpeAddress) && channel.ChannelID.Cmp(channelID) == 0 {
+			channel.DeletedAt = &now
+		}
+	}
+	return nil
+}
+
+// CreateServiceCall records a service call in the call ledger.
+func (d *Database) CreateServiceCall(call *db.ServiceCall) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recorded := *call
+	recorded.CreatedAt = time.Now()
+	d.calls = append(d.calls, recorded)
+	return nil
+}
+
+// channelKey builds the key of a payment channel
+func channelKey(mpeAddress, sender, recipient, groupID string) string {
+	return strings.ToLower(mpeAddress+"/"+sender+"/"+recipient) + "/" + groupID
+}
@@ -0,0 +1,133 @@
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// NewServiceProtos bundles the proto sources of a service with the descriptors compiled from them for storage.
+//
+// Parameters:
+//   - sources: The proto sources by file name, as published in IPFS.
+//   - descriptors: The file descriptors compiled from the sources.
+//
+// Returns:
+//   - *db.ServiceProtos: The sources with their content hash and the serialized FileDescriptorSet.
+//   - error: An error if the descriptors cannot be serialized.
+func NewServiceProtos(sources map[string]string, descriptors []protoreflect.FileDescriptor) (*db.ServiceProtos, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	// Dependencies are added before the files importing them, as protodesc.NewFiles expects
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range descriptors {
+		if fd != nil {
+			add(fd)
+		}
+	}
+
+	descriptorSet, err := proto.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal file descriptor set: %w", err)
+	}
+	return &db.ServiceProtos{
+		ContentHash:   protoContentHash(sources),
+		Sources:       sources,
+		DescriptorSet: descriptorSet,
+	}, nil
+}
+
+// ServiceDescriptors restores the file descriptors of the proto sources of a service from their stored FileDescriptorSet.
+// Only the files of the service are returned, not the imports compiled along with them.
+//
+// Parameters:
+//   - protos: The stored proto sources and descriptors of the service.
+//
+// Returns:
+//   - []protoreflect.FileDescriptor: The file descriptors of the service, sorted by file name.
+//   - error: An error if the descriptor set cannot be restored.
+func ServiceDescriptors(protos *db.ServiceProtos) ([]protoreflect.FileDescriptor, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(protos.DescriptorSet, set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore file descriptors: %w", err)
+	}
+
+	var descriptors []protoreflect.FileDescriptor
+	for _, name := range slices.Sorted(maps.Keys(protos.Sources)) {
+		if fd, err := files.FindFileByPath(name); err == nil {
+			descriptors = append(descriptors, fd)
+		}
+	}
+	return descriptors, nil
+}
+
+// protoContentHash returns the hex-encoded SHA-256 hash of proto sources, independent of the order of the files.
+func protoContentHash(sources map[string]string) string {
+	hash := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(sources)) {
+		// The lengths keep the boundaries between names and contents unambiguous
+		_, _ = fmt.Fprintf(hash, "%d:%s%d:%s", len(name), name, len(sources[name]), sources[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// LoadCatalog fills the file descriptors of the synced services from the descriptors stored by previous syncs,
+// so the services can be connected before the first sync of this run completes.
+//
+// Returns:
+//   - error: An error if the services cannot be read from the database.
+func (s *SnetSyncer) LoadCatalog() error {
+	services, err := s.DB.GetSnetServices(false)
+	if err != nil {
+		return fmt.Errorf("failed to get snet services: %w", err)
+	}
+
+	fileDescriptors := make(map[string][]protoreflect.FileDescriptor)
+	for _, service := range services {
+		if service.ProtoHash == "" {
+			continue
+		}
+		protos, err := s.DB.GetServiceProtos(service.ProtoHash)
+		if err != nil || protos == nil {
+			log.Warn().Err(err).Str("snet_id", service.SnetID).Msg("no stored proto descriptors for service")
+			continue
+		}
+		descriptors, err := ServiceDescriptors(protos)
+		if err != nil {
+			log.Warn().Err(err).Str("snet_id", service.SnetID).Msg("failed to restore proto descriptors")
+			continue
+		}
+		if len(descriptors) > 0 {
+			fileDescriptors[service.SnetID] = descriptors
+		}
+	}
+
+	fileDescriptors = s.inScope(fileDescriptors, s.Scope())
+	log.Info().Int("services_count", len(fileDescriptors)).Msg("loaded stored service descriptors")
+	s.publish(fileDescriptors, false)
+	return nil
+}
@@ -0,0 +1,180 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+)
+
+// registryEventsSync is the name the last block processed by the event sync is stored under.
+const registryEventsSync = "registry_events"
+
+// serviceKey identifies a service of an organization in the registry.
+type serviceKey struct {
+	orgID     [32]byte // The ID of the organization.
+	serviceID [32]byte // The ID of the service.
+}
+
+// SyncEvents re-syncs the organizations and services changed by registry events since the last processed block.
+// Events are read in batches of config.Sync.EventsBatch blocks and the last processed block is stored after each batch,
+// so a restart resumes where the previous run stopped. The first run only records the current block,
+// the full sync covers everything before it.
+//
+// Parameters:
+//   - ctx: The context of the sync.
+//
+// Returns:
+//   - error: An error if the events cannot be read or the progress cannot be stored.
+func (s *SnetSyncer) SyncEvents(ctx context.Context) error {
+	if !s.ready() {
+		return errors.New("syncer is not initialized")
+	}
+
+	s.catalog.syncing.Lock()
+	defer s.catalog.syncing.Unlock()
+
+	lastBlock, err := s.DB.GetSyncBlock(registryEventsSync)
+	if err != nil {
+		return fmt.Errorf("failed to get last synced block: %w", err)
+	}
+	currentBlock, err := s.Ethereum.Client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current block: %w", err)
+	}
+	if lastBlock == 0 {
+		if err = s.DB.SaveSyncBlock(registryEventsSync, currentBlock); err != nil {
+			return fmt.Errorf("failed to save synced block: %w", err)
+		}
+		return nil
+	}
+
+	batch := max(config.Sync.EventsBatch, 1)
+	for fromBlock := lastBlock + 1; fromBlock <= currentBlock; fromBlock += batch {
+		toBlock := min(fromBlock+batch-1, currentBlock)
+		events, err := s.Ethereum.RegistryEvents(ctx, fromBlock, toBlock)
+		if err != nil {
+			return fmt.Errorf("failed to get registry events of blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+
+		s.applyEvents(ctx, events)
+
+		if err = s.DB.SaveSyncBlock(registryEventsSync, toBlock); err != nil {
+			return fmt.Errorf("failed to save synced block: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyEvents re-syncs every organization and service in the sync scope changed by the events once.
+// A service changed by several events ends up in the state of the last one, and its organization is synced first,
+// since the service records reference it. Deletions apply regardless of the scope.
+func (s *SnetSyncer) applyEvents(ctx context.Context, events []blockchain.RegistryEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	var orgIDs [][32]byte
+	var serviceKeys []serviceKey
+	orgSeen := make(map[[32]byte]bool)
+	serviceDeleted := make(map[serviceKey]bool)
+	for _, event := range events {
+		if !event.IsServiceEvent() {
+			if !orgSeen[event.OrgID] {
+				orgSeen[event.OrgID] = true
+				orgIDs = append(orgIDs, event.OrgID)
+			}
+			continue
+		}
+		key := serviceKey{orgID: event.OrgID, serviceID: event.ServiceID}
+		if _, ok := serviceDeleted[key]; !ok {
+			serviceKeys = append(serviceKeys, key)
+		}
+		serviceDeleted[key] = event.Name == blockchain.ServiceDeletedEvent
+	}
+
+	// The descriptors are replaced rather than changed in place, so readers of the previous map are not disturbed
+	fileDescriptors := maps.Clone(s.FileDescriptors())
+	stages := newPipeline()
+	scope := s.Scope()
+
+	for _, key := range serviceKeys {
+		if !serviceDeleted[key] {
+			if !orgSeen[key.orgID] {
+				orgSeen[key.orgID] = true
+				orgIDs = append(orgIDs, key.orgID)
+			}
+			continue
+		}
+		orgIDStr, serviceIDStr := snetID(key.orgID), snetID(key.serviceID)
+		if err := s.DB.DeleteSnetService(orgIDStr, serviceIDStr); err != nil {
+			log.Error().
+				Err(err).
+				Str("org_id", orgIDStr).
+				Str("service_id", serviceIDStr).
+				Msg("failed to delete service")
+			continue
+		}
+		delete(fileDescriptors, serviceIDStr)
+		log.Info().
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Msg("service deleted from registry")
+	}
+
+	syncedServices := 0
+	for _, orgIDBytes := range orgIDs {
+		if !scope.allowsOrg(snetID(orgIDBytes)) {
+			continue
+		}
+		org, _ := s.syncOrg(ctx, stages, orgIDBytes)
+		if org == nil {
+			continue
+		}
+		for _, key := range serviceKeys {
+			if key.orgID != orgIDBytes || serviceDeleted[key] || !scope.allowsService(org.SnetID, snetID(key.serviceID)) {
+				continue
+			}
+			descriptors, ok := s.syncService(ctx, stages, orgIDBytes, org, key.serviceID)
+			if !ok {
+				continue
+			}
+			syncedServices++
+			if len(descriptors) > 0 {
+				fileDescriptors[snetID(key.serviceID)] = descriptors
+			} else {
+				delete(fileDescriptors, snetID(key.serviceID))
+			}
+		}
+	}
+
+	s.publish(fileDescriptors, false)
+
+	log.Info().
+		Int("events_count", len(events)).
+		Int("organizations_count", len(orgIDs)).
+		Int("synced_services", syncedServices).
+		Msg("registry events applied")
+}
+
+// startEventsAfter makes the event sync follow the registry from the block after the given one,
+// unless it already does. It is called after a full sync, which covers everything up to that block.
+func (s *SnetSyncer) startEventsAfter(block uint64) {
+	lastBlock, err := s.DB.GetSyncBlock(registryEventsSync)
+	if err != nil || lastBlock != 0 {
+		return
+	}
+	if err = s.DB.SaveSyncBlock(registryEventsSync, block); err != nil {
+		log.Error().Err(err).Msg("failed to save synced block")
+	}
+}
+
+// snetID converts a registry ID to the Snet ID of an organization or a service by dropping its zero padding.
+func snetID(id [32]byte) string {
+	return strings.ReplaceAll(string(id[:]), "\u0000", "")
+}
@@ -0,0 +1,49 @@
+package syncer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// pipeline bounds how many registry reads, IPFS fetches and proto compilations of a sync run at once.
+// Organizations and services are synced concurrently, so while one service waits for IPFS another one compiles.
+type pipeline struct {
+	chain   chan struct{} // The slots of registry reads.
+	ipfs    chan struct{} // The slots of IPFS fetches.
+	compile chan struct{} // The slots of proto compilations.
+}
+
+// newPipeline creates a pipeline with the concurrency configured in config.Sync.
+func newPipeline() *pipeline {
+	return &pipeline{
+		chain:   make(chan struct{}, max(config.Sync.ChainConcurrency, 1)),
+		ipfs:    make(chan struct{}, max(config.Sync.IPFSConcurrency, 1)),
+		compile: make(chan struct{}, max(config.Sync.CompileConcurrency, 1)),
+	}
+}
+
+// runStage waits for a free slot of a pipeline stage and calls fn in it.
+// If the sync runs out of time first, fn is not called and the context error is returned.
+func runStage[T any](ctx context.Context, stage chan struct{}, fn func() (T, error)) (T, error) {
+	select {
+	case stage <- struct{}{}:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+	defer func() { <-stage }()
+	return fn()
+}
+
+// catalog holds the file descriptors of the synced services and the scope of the sync. It is shared by all copies of a syncer.
+type catalog struct {
+	syncing         sync.Mutex                                     // A mutex to ensure only one sync changes the catalog at a time.
+	mu              sync.RWMutex                                   // A mutex to ensure thread-safe access to the fields below.
+	fileDescriptors map[string][]protoreflect.FileDescriptor       // The file descriptors of the synced services by Snet ID.
+	synced          bool                                           // Indicates if a full sync has completed.
+	onUpdate        func(map[string][]protoreflect.FileDescriptor) // Called with the file descriptors after each change.
+	scope           Scope                                          // The organizations and services synced.
+}
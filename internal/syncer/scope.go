@@ -0,0 +1,296 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// syncScopeSetting is the name of the setting the scope changed by admins is stored under.
+const syncScopeSetting = "sync_scope"
+
+// Scope narrows the sync down to the organizations and services a deployment uses. Empty lists match everything.
+// IDs are matched as glob patterns, so "snet*" matches every ID starting with snet,
+// and service patterns match both the service ID and "<org ID>/<service ID>".
+type Scope struct {
+	Orgs            []string `json:"orgs"`            // The organization IDs or patterns to sync, all when empty.
+	Services        []string `json:"services"`        // The service IDs or patterns to sync, all when empty.
+	Tags            []string `json:"tags"`            // The tags a service needs at least one of to be synced, any when empty.
+	ExcludeOrgs     []string `json:"excludeOrgs"`     // The organization IDs or patterns never synced.
+	ExcludeServices []string `json:"excludeServices"` // The service IDs or patterns never synced.
+}
+
+// ConfiguredScope returns the scope configured in config.Sync, which applies unless an admin changed it.
+func ConfiguredScope() Scope {
+	return Scope{
+		Orgs:            slices.Clone(config.Sync.Orgs),
+		Services:        slices.Clone(config.Sync.Services),
+		Tags:            slices.Clone(config.Sync.Tags),
+		ExcludeOrgs:     slices.Clone(config.Sync.ExcludeOrgs),
+		ExcludeServices: slices.Clone(config.Sync.ExcludeServices),
+	}
+}
+
+// Validate checks that every pattern of the scope is well-formed.
+//
+// Returns:
+//   - error: An error naming the first malformed pattern.
+func (sc Scope) Validate() error {
+	for _, patterns := range [][]string{sc.Orgs, sc.Services, sc.ExcludeOrgs, sc.ExcludeServices} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// String describes the scope for admins.
+func (sc Scope) String() string {
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "all"
+		}
+		return strings.Join(values, ", ")
+	}
+	none := func(values []string) string {
+		if len(values) == 0 {
+			return "none"
+		}
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("Organizations: %s\nServices: %s\nTags: %s\nExcluded organizations: %s\nExcluded services: %s",
+		list(sc.Orgs), list(sc.Services), list(sc.Tags), none(sc.ExcludeOrgs), none(sc.ExcludeServices))
+}
+
+// loadScope returns the scope stored by the last SetScope, or the configured scope if admins have not changed it.
+func loadScope(database db.Service) Scope {
+	if database == nil {
+		return ConfiguredScope()
+	}
+
+	value, err := database.GetSetting(syncScopeSetting)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get stored sync scope, using the configured one")
+		return ConfiguredScope()
+	}
+	if value == "" {
+		return ConfiguredScope()
+	}
+
+	var scope Scope
+	if err = json.Unmarshal([]byte(value), &scope); err == nil {
+		err = scope.Validate()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("invalid stored sync scope, using the configured one")
+		return ConfiguredScope()
+	}
+	log.Info().Str("scope", scope.String()).Msg("using the sync scope changed by an admin")
+	return scope
+}
+
+// allowsOrg reports whether the services of an organization may be synced.
+func (sc Scope) allowsOrg(orgID string) bool {
+	if matchesAny(sc.ExcludeOrgs, orgID) {
+		return false
+	}
+	return len(sc.Orgs) == 0 || matchesAny(sc.Orgs, orgID)
+}
+
+// allowsService reports whether a service may be synced, judging by its ID and the ID of its organization.
+func (sc Scope) allowsService(orgID, serviceID string) bool {
+	if !sc.allowsOrg(orgID) || matchesAny(sc.ExcludeServices, serviceID, orgID+"/"+serviceID) {
+		return false
+	}
+	return len(sc.Services) == 0 || matchesAny(sc.Services, serviceID, orgID+"/"+serviceID)
+}
+
+// allowsTags reports whether a service with the tags may be synced. Tags are compared case-insensitively.
+func (sc Scope) allowsTags(tags []string) bool {
+	if len(sc.Tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.ContainsFunc(sc.Tags, func(wanted string) bool { return strings.EqualFold(wanted, tag) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a stored service is in scope.
+func (sc Scope) allows(service db.SnetService) bool {
+	return sc.allowsService(service.SnetOrgID, service.SnetID) && sc.allowsTags(service.Tags)
+}
+
+// matchesAny reports whether any of the values matches any of the patterns.
+func matchesAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Scope returns the organizations and services synced.
+func (s *SnetSyncer) Scope() Scope {
+	s.catalog.mu.RLock()
+	defer s.catalog.mu.RUnlock()
+	return s.catalog.scope
+}
+
+// SetScope changes the organizations and services synced. The scope is stored, so it applies after restarts
+// instead of the configured one until it is changed again or reset by ResetScope.
+// Services are synced or dropped accordingly by the next sync, or right away by ResyncScope.
+//
+// Parameters:
+//   - scope: The new scope.
+//
+// Returns:
+//   - error: An error if a pattern of the scope is malformed or the scope cannot be stored.
+func (s *SnetSyncer) SetScope(scope Scope) error {
+	if err := scope.Validate(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(scope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync scope: %w", err)
+	}
+	if err = s.DB.SaveSetting(syncScopeSetting, string(value)); err != nil {
+		return fmt.Errorf("failed to store sync scope: %w", err)
+	}
+
+	s.catalog.mu.Lock()
+	defer s.catalog.mu.Unlock()
+	s.catalog.scope = scope
+	return nil
+}
+
+// ResetScope drops the scope stored by SetScope and restores the configured one.
+//
+// Returns:
+//   - Scope: The configured scope.
+//   - error: An error if the stored scope cannot be dropped.
+func (s *SnetSyncer) ResetScope() (Scope, error) {
+	if err := s.DB.DeleteSetting(syncScopeSetting); err != nil {
+		return Scope{}, fmt.Errorf("failed to drop stored sync scope: %w", err)
+	}
+
+	scope := ConfiguredScope()
+	s.catalog.mu.Lock()
+	defer s.catalog.mu.Unlock()
+	s.catalog.scope = scope
+	return scope, nil
+}
+
+// ResyncScope brings the synced services in line with the current scope: services out of scope are dropped
+// and services in scope but not synced yet are synced, without crawling the rest of the registry.
+//
+// Parameters:
+//   - ctx: The context of the sync.
+//
+// Returns:
+//   - error: An error if the syncer is not initialized or the organizations cannot be listed.
+func (s *SnetSyncer) ResyncScope(ctx context.Context) error {
+	if !s.ready() {
+		return errors.New("syncer is not initialized")
+	}
+
+	s.catalog.syncing.Lock()
+	defer s.catalog.syncing.Unlock()
+	scope := s.Scope()
+	stages := newPipeline()
+
+	fileDescriptors := s.inScope(maps.Clone(s.FileDescriptors()), scope)
+	dropped := len(s.FileDescriptors()) - len(fileDescriptors)
+
+	orgs, err := runStage(ctx, stages.chain, s.Ethereum.GetOrgs)
+	if err != nil {
+		return fmt.Errorf("failed to get organizations from blockchain: %w", err)
+	}
+
+	syncedServices := 0
+	for _, orgIDBytes := range orgs {
+		orgIDStr := snetID(orgIDBytes)
+		if !scope.allowsOrg(orgIDStr) {
+			continue
+		}
+		borg, err := runStage(ctx, stages.chain, func() (blockchain.Org, error) {
+			return s.Ethereum.GetOrg(orgIDBytes)
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("org_id", orgIDStr).Msg("failed to get organization from blockchain")
+			continue
+		}
+
+		var missing [][32]byte
+		for _, serviceIDBytes := range borg.ServiceIds {
+			serviceIDStr := snetID(serviceIDBytes)
+			if _, ok := fileDescriptors[serviceIDStr]; !ok && scope.allowsService(orgIDStr, serviceIDStr) {
+				missing = append(missing, serviceIDBytes)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		org, _ := s.syncOrg(ctx, stages, orgIDBytes)
+		if org == nil {
+			continue
+		}
+		for _, serviceIDBytes := range missing {
+			descriptors, ok := s.syncService(ctx, stages, orgIDBytes, org, serviceIDBytes)
+			if ok && len(descriptors) > 0 {
+				fileDescriptors[snetID(serviceIDBytes)] = descriptors
+				syncedServices++
+			}
+		}
+	}
+
+	// Services synced above are judged by their tags, known only once they are stored
+	fileDescriptors = s.inScope(fileDescriptors, scope)
+	s.publish(fileDescriptors, false)
+
+	log.Info().
+		Int("dropped_services", dropped).
+		Int("synced_services", syncedServices).
+		Msg("sync scope applied")
+	return nil
+}
+
+// inScope removes the services out of scope from the file descriptors, judging by their stored IDs and tags,
+// and returns the file descriptors.
+func (s *SnetSyncer) inScope(fileDescriptors map[string][]protoreflect.FileDescriptor, scope Scope) map[string][]protoreflect.FileDescriptor {
+	if len(scope.Orgs) == 0 && len(scope.Services) == 0 && len(scope.Tags) == 0 &&
+		len(scope.ExcludeOrgs) == 0 && len(scope.ExcludeServices) == 0 {
+		return fileDescriptors
+	}
+
+	services, err := s.DB.GetSnetServices(false)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get snet services, keeping services out of sync scope")
+		return fileDescriptors
+	}
+	for _, service := range services {
+		if _, ok := fileDescriptors[service.SnetID]; ok && !scope.allows(service) {
+			delete(fileDescriptors, service.SnetID)
+		}
+	}
+	return fileDescriptors
+}
@@ -3,12 +3,14 @@ package syncer
 import (
 	"context"
 	"encoding/json"
-	"os"
+	"maps"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bufbuild/protocompile"
 	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
 	"github.com/tensved/snet-matrix-framework/pkg/db"
 	ipfs "github.com/tensved/snet-matrix-framework/pkg/ipfs"
@@ -16,33 +18,96 @@ import (
 )
 
 type SnetSyncer struct {
-	Ethereum        blockchain.Ethereum
-	IPFSClient      ipfs.IPFSClient
-	DB              db.Service
-	FileDescriptors map[string][]protoreflect.FileDescriptor
-	cancelFunc      context.CancelFunc
+	Ethereum   blockchain.Ethereum
+	IPFSClient ipfs.IPFSClient
+	DB         db.Service
+	catalog    *catalog
+	cancelFunc context.CancelFunc
 }
 
 func New(eth blockchain.Ethereum, ipfs ipfs.IPFSClient, db db.Service) SnetSyncer {
 	return SnetSyncer{
-		Ethereum:        eth,
-		IPFSClient:      ipfs,
-		DB:              db,
-		FileDescriptors: make(map[string][]protoreflect.FileDescriptor),
+		Ethereum:   eth,
+		IPFSClient: ipfs,
+		DB:         db,
+		catalog: &catalog{
+			fileDescriptors: make(map[string][]protoreflect.FileDescriptor),
+			scope:           loadScope(db),
+		},
 	}
 }
 
-func (s *SnetSyncer) SyncOnce() {
+// FileDescriptors returns the file descriptors of the synced services by Snet ID.
+// The map is replaced rather than changed by later syncs and must not be modified.
+func (s *SnetSyncer) FileDescriptors() map[string][]protoreflect.FileDescriptor {
+	s.catalog.mu.RLock()
+	defer s.catalog.mu.RUnlock()
+	return s.catalog.fileDescriptors
+}
+
+// OnUpdate sets the function called with the file descriptors of all synced services whenever a sync changed them,
+// e.g. to connect new services to the bot.
+func (s *SnetSyncer) OnUpdate(fn func(fileDescriptors map[string][]protoreflect.FileDescriptor)) {
+	s.catalog.mu.Lock()
+	defer s.catalog.mu.Unlock()
+	s.catalog.onUpdate = fn
+}
+
+// publish replaces the file descriptors of the synced services and reports them to the OnUpdate function.
+func (s *SnetSyncer) publish(fileDescriptors map[string][]protoreflect.FileDescriptor, fullSync bool) {
+	s.catalog.mu.Lock()
+	s.catalog.fileDescriptors = fileDescriptors
+	s.catalog.synced = s.catalog.synced || fullSync
+	onUpdate := s.catalog.onUpdate
+	s.catalog.mu.Unlock()
+
+	if onUpdate != nil {
+		onUpdate(fileDescriptors)
+	}
+}
+
+// Synced reports whether a full sync has completed since the start.
+func (s *SnetSyncer) Synced() bool {
+	s.catalog.mu.RLock()
+	defer s.catalog.mu.RUnlock()
+	return s.catalog.synced
+}
+
+// SyncOnce crawls the organizations and services of the registry in the sync scope and stores them with their IPFS metadata.
+// Organizations and services are synced concurrently within the limits of config.Sync and until config.Sync.Timeout;
+// services not reached by then keep their previous file descriptors until the next sync.
+//
+// Parameters:
+//   - ctx: The context of the sync.
+func (s *SnetSyncer) SyncOnce(ctx context.Context) {
 	logger := log.With().Logger()
 
 	logger.Info().Msg("starting SNET synchronization")
 
 	startTime := time.Now()
 
-	// Clear file descriptors to prevent duplicates
-	s.FileDescriptors = make(map[string][]protoreflect.FileDescriptor)
+	if !s.ready() {
+		return
+	}
+
+	s.catalog.syncing.Lock()
+	defer s.catalog.syncing.Unlock()
+	scope := s.Scope()
+
+	if config.Sync.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Sync.Timeout)
+		defer cancel()
+	}
+	stages := newPipeline()
 
-	orgs, err := s.Ethereum.GetOrgs()
+	// Registry events of the blocks after this one are replayed by the event sync
+	startBlock, blockErr := s.Ethereum.Client.BlockNumber(ctx)
+	if blockErr != nil {
+		logger.Warn().Err(blockErr).Msg("failed to get current block")
+	}
+
+	orgs, err := runStage(ctx, stages.chain, s.Ethereum.GetOrgs)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to get organizations from blockchain")
 		return
@@ -52,305 +117,408 @@ func (s *SnetSyncer) SyncOnce() {
 		Int("organizations_count", len(orgs)).
 		Msg("found organizations in blockchain")
 
+	var mu sync.Mutex // A mutex to ensure thread-safe access to the results below.
 	processedOrgs := 0
 	processedServices := 0
+	fileDescriptors := make(map[string][]protoreflect.FileDescriptor)
+	var seenServices []string // The services listed on-chain by the organizations synced.
+	var unknownOrgs []string  // The organizations whose services could not be listed.
+
+	var wg sync.WaitGroup
+	for _, orgIDBytes := range orgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Services of organizations out of scope are left as they are, without listing them
+			orgIDStr := snetID(orgIDBytes)
+			var org *blockchain.OrganizationMetaData
+			var serviceIDs [][32]byte
+			if scope.allowsOrg(orgIDStr) {
+				org, serviceIDs = s.syncOrg(ctx, stages, orgIDBytes)
+			}
+			mu.Lock()
+			if org == nil {
+				unknownOrgs = append(unknownOrgs, orgIDStr)
+				mu.Unlock()
+				return
+			}
+			processedOrgs++
+			for _, serviceIDBytes := range serviceIDs {
+				seenServices = append(seenServices, snetID(serviceIDBytes))
+			}
+			mu.Unlock()
 
-	for i, orgIDBytes := range orgs {
-		orgIDStr := strings.ReplaceAll(string(orgIDBytes[:]), "\u0000", "")
+			for _, serviceIDBytes := range serviceIDs {
+				if !scope.allowsService(orgIDStr, snetID(serviceIDBytes)) {
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
 
-		logger.Info().
-			Int("org_index", i).
-			Str("org_id", orgIDStr).
-			Msg("processing organization")
+					descriptors, ok := s.syncService(ctx, stages, orgIDBytes, org, serviceIDBytes)
+					if !ok {
+						return
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					processedServices++
+					if len(descriptors) > 0 {
+						fileDescriptors[snetID(serviceIDBytes)] = descriptors
+					}
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Services not reached or failed to sync keep the descriptors of the previous sync
+	merged := maps.Clone(s.FileDescriptors())
+	if ctx.Err() != nil {
+		logger.Warn().
+			Err(ctx.Err()).
+			Int("processed_organizations", processedOrgs).
+			Int("processed_services", processedServices).
+			Msg("snet sync stopped before all services were synced")
+		maps.Copy(merged, fileDescriptors)
+		s.publish(s.inScope(merged, scope), false)
+		return
+	}
+	for _, deleted := range s.deleteMissing(orgs, seenServices, unknownOrgs) {
+		delete(merged, deleted)
+	}
+	maps.Copy(merged, fileDescriptors)
+	s.publish(s.inScope(merged, scope), true)
 
-		borg, err := s.Ethereum.GetOrg(orgIDBytes)
-		if err != nil {
-			logger.Error().
-				Err(err).
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("failed to get organization from blockchain")
-			continue
-		}
+	if blockErr == nil {
+		s.startEventsAfter(startBlock)
+	}
 
-		if !borg.Found {
-			logger.Warn().
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("organization not found in blockchain")
-			continue
-		}
+	logger.Info().
+		Int("processed_organizations", processedOrgs).
+		Int("processed_services", processedServices).
+		Dur("duration", time.Since(startTime)).
+		Msg("snet syncer successfully")
+}
 
-		var org blockchain.OrganizationMetaData
+// syncOrg stores an organization and its payment groups from the registry and its IPFS metadata.
+// It returns the stored organization and the IDs of its services, or nil if the organization could not be synced.
+func (s *SnetSyncer) syncOrg(ctx context.Context, stages *pipeline, orgIDBytes [32]byte) (*blockchain.OrganizationMetaData, [][32]byte) {
+	logger := log.With().Logger()
 
-		if len(borg.OrgMetadataURI) == 0 {
-			logger.Warn().
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("organization has no metadata URI")
-			continue
-		}
+	orgIDStr := snetID(orgIDBytes)
 
-		if s.IPFSClient.HttpApi == nil {
-			logger.Error().Msg("IPFSClient.HttpApi is nil")
-			return
-		}
+	logger.Info().
+		Str("org_id", orgIDStr).
+		Msg("processing organization")
 
-		logger.Debug().
+	borg, err := runStage(ctx, stages.chain, func() (blockchain.Org, error) {
+		return s.Ethereum.GetOrg(orgIDBytes)
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Msg("failed to get organization from blockchain")
+		return nil, nil
+	}
+
+	if !borg.Found {
+		logger.Warn().
+			Str("org_id", orgIDStr).
+			Msg("organization not found in blockchain")
+		return nil, nil
+	}
+
+	var org blockchain.OrganizationMetaData
+
+	if len(borg.OrgMetadataURI) == 0 {
+		logger.Warn().
+			Str("org_id", orgIDStr).
+			Msg("organization has no metadata URI")
+		return nil, nil
+	}
+
+	logger.Debug().
+		Str("org_id", orgIDStr).
+		Str("metadata_uri", string(borg.OrgMetadataURI)).
+		Msg("fetching organization metadata from IPFS")
+
+	metadataJSON, err := runStage(ctx, stages.ipfs, func() ([]byte, error) {
+		return s.IPFSClient.GetIpfsFile(string(borg.OrgMetadataURI))
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
 			Str("org_id", orgIDStr).
 			Str("metadata_uri", string(borg.OrgMetadataURI)).
-			Msg("fetching organization metadata from IPFS")
+			Msg("failed to get organization metadata from IPFS")
+		return nil, nil
+	}
 
-		metadataJSON, err := s.IPFSClient.GetIpfsFile(string(borg.OrgMetadataURI))
-		if err != nil {
-			logger.Error().
-				Err(err).
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Str("metadata_uri", string(borg.OrgMetadataURI)).
-				Msg("failed to get organization metadata from IPFS")
-			continue
-		}
+	err = json.Unmarshal(metadataJSON, &org)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Msg("failed to unmarshal organization metadata from IPFS")
+		return nil, nil
+	}
 
-		err = json.Unmarshal(metadataJSON, &org)
-		if err != nil {
-			logger.Error().
-				Err(err).
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("failed to unmarshal organization metadata from IPFS")
-			continue
-		}
+	org.Owner = borg.Owner.Hex()
+	org.SnetID = snetID(borg.Id)
 
-		org.Owner = borg.Owner.Hex()
-		org.SnetID = strings.ReplaceAll(string(borg.Id[:]), "\u0000", "")
+	logger.Debug().
+		Str("org_id", orgIDStr).
+		Str("org_name", org.OrgName).
+		Msg("saving organization to database")
 
-		if s.DB == nil {
-			logger.Error().Msg("DB is nil")
-			return
-		}
+	dbOrg, dbGroups := org.DB()
+	orgID, err := s.DB.CreateSnetOrg(dbOrg)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Msg("failed to create organization in database")
+	}
+	org.ID = orgID
+	err = s.DB.CreateSnetOrgGroups(orgID, dbGroups)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Msg("failed to create organization groups in database")
+	}
 
-		logger.Debug().
+	logger.Info().
+		Str("org_id", orgIDStr).
+		Int("services_count", len(borg.ServiceIds)).
+		Msg("processing organization services")
+
+	return &org, borg.ServiceIds
+}
+
+// syncService stores a service of an organization from the registry and its IPFS metadata and compiles its proto files.
+// It returns the file descriptors of the service, and false if the service could not be stored.
+func (s *SnetSyncer) syncService(ctx context.Context, stages *pipeline, orgIDBytes [32]byte, org *blockchain.OrganizationMetaData, serviceIDBytes [32]byte) ([]protoreflect.FileDescriptor, bool) {
+	logger := log.With().Logger()
+
+	orgIDStr := org.SnetID
+	serviceIDStr := snetID(serviceIDBytes)
+
+	logger.Info().
+		Str("org_id", orgIDStr).
+		Str("service_id", serviceIDStr).
+		Msg("processing service")
+
+	service, err := runStage(ctx, stages.chain, func() (blockchain.Service, error) {
+		return s.Ethereum.GetService(orgIDBytes, serviceIDBytes)
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
 			Str("org_id", orgIDStr).
-			Str("org_name", org.OrgName).
-			Msg("saving organization to database")
+			Str("service_id", serviceIDStr).
+			Msg("failed to get service from blockchain")
+		return nil, false
+	}
 
-		dbOrg, dbGroups := org.DB()
-		orgID, err := s.DB.CreateSnetOrg(dbOrg)
-		if err != nil {
+	if !service.Found {
+		logger.Warn().
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Msg("service not found in blockchain")
+		return nil, false
+	}
+
+	logger.Debug().
+		Str("org_id", orgIDStr).
+		Str("service_id", serviceIDStr).
+		Str("metadata_uri", string(service.MetadataURI)).
+		Msg("fetching service metadata from IPFS")
+
+	metadataJSON, err := runStage(ctx, stages.ipfs, func() ([]byte, error) {
+		return s.IPFSClient.GetIpfsFile(string(service.MetadataURI))
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Str("metadata_uri", string(service.MetadataURI)).
+			Msg("failed to get service metadata from IPFS")
+		return nil, false
+	}
+
+	var srvMeta blockchain.ServiceMetadata
+	err = json.Unmarshal(metadataJSON, &srvMeta)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Msg("failed to unmarshal service metadata from IPFS")
+		return nil, false
+	}
+
+	logger.Info().
+		Str("org_id", orgIDStr).
+		Str("service_id", serviceIDStr).
+		Interface("metadata", srvMeta).
+		Msg("retrieved service metadata")
+	if len(srvMeta.Groups) > 0 {
+		logger.Info().
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Interface("endpoints", srvMeta.Groups[0].Endpoints).
+			Msg("service endpoints")
+		logger.Info().
+			Str("org_id", orgIDStr).
+			Str("service_id", serviceIDStr).
+			Interface("daemon_addresses", srvMeta.Groups[0].DaemonAddresses).
+			Msg("service daemon addresses")
+	}
+
+	srvMeta.OrgID = org.ID
+	srvMeta.SnetID = serviceIDStr
+	srvMeta.SnetOrgID = org.SnetID
+	dbSrvMeta, err := srvMeta.DB()
+	if err != nil {
+		logger.Error().Err(err)
+	}
+	srvMeta.ID, err = s.DB.CreateSnetService(dbSrvMeta)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("id", srvMeta.ID).
+			Str("snet-id", srvMeta.SnetID).
+			Msg("failed to add snet_service")
+	} else {
+		if err = s.DB.SaveSnetServicePrices(srvMeta.ID, srvMeta.Prices()); err != nil {
 			logger.Error().
 				Err(err).
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("failed to create organization in database")
+				Str("snet-id", srvMeta.SnetID).
+				Msg("failed to save snet_service prices")
 		}
-		org.ID = orgID
-		err = s.DB.CreateSnetOrgGroups(orgID, dbGroups)
-		if err != nil {
+		if err = s.DB.SaveSnetServiceGroups(srvMeta.ID, srvMeta.ServiceGroups()); err != nil {
 			logger.Error().
 				Err(err).
-				Str("org_id", orgIDStr).
-				Int("org_index", i).
-				Msg("failed to create organization groups in database")
+				Str("snet-id", srvMeta.SnetID).
+				Msg("failed to save snet_service groups")
 		}
+	}
 
-		logger.Info().
-			Str("org_id", orgIDStr).
-			Int("org_index", i).
-			Int("services_count", len(borg.ServiceIds)).
-			Msg("processing organization services")
-
-		processedOrgs++
-
-		var service blockchain.Service
-		for j, serviceIDBytes := range borg.ServiceIds {
-			serviceIDStr := strings.ReplaceAll(string(serviceIDBytes[:]), "\u0000", "")
-
-			logger.Info().
-				Int("org_index", i).
-				Int("service_index", j).
-				Str("org_id", orgIDStr).
-				Str("service_id", serviceIDStr).
-				Msg("processing service")
-
-			service, err = s.Ethereum.GetService(borg.Id, serviceIDBytes)
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("org_id", orgIDStr).
-					Str("service_id", serviceIDStr).
-					Int("org_index", i).
-					Int("service_index", j).
-					Msg("failed to get service from blockchain")
-				continue
-			}
-
-			logger.Debug().
-				Str("org_id", orgIDStr).
-				Str("service_id", serviceIDStr).
-				Str("metadata_uri", string(service.MetadataURI)).
-				Msg("fetching service metadata from IPFS")
-
-			metadataJSON, err = s.IPFSClient.GetIpfsFile(string(service.MetadataURI))
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("org_id", orgIDStr).
-					Str("service_id", serviceIDStr).
-					Int("org_index", i).
-					Int("service_index", j).
-					Str("metadata_uri", string(service.MetadataURI)).
-					Msg("failed to get service metadata from IPFS")
-				continue
-			}
-
-			var srvMeta blockchain.ServiceMetadata
-			err = json.Unmarshal(metadataJSON, &srvMeta)
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("org_id", orgIDStr).
-					Str("service_id", serviceIDStr).
-					Int("org_index", i).
-					Int("service_index", j).
-					Msg("failed to unmarshal service metadata from IPFS")
-				continue
-			}
+	// The tags are known from the metadata only, so services out of scope by tags are stored but their protos are not fetched
+	if !s.Scope().allowsTags(srvMeta.Tags) {
+		logger.Debug().
+			Str("snet_id", srvMeta.SnetID).
+			Strs("tags", srvMeta.Tags).
+			Msg("service tags out of sync scope, skipping proto files")
+		return nil, true
+	}
 
-			logger.Info().
-				Str("org_id", orgIDStr).
-				Str("service_id", serviceIDStr).
-				Int("org_index", i).
-				Int("service_index", j).
-				Interface("metadata", srvMeta).
-				Msg("retrieved service metadata")
-			if len(srvMeta.Groups) > 0 {
-				logger.Info().
-					Str("org_id", orgIDStr).
-					Str("service_id", serviceIDStr).
-					Interface("endpoints", srvMeta.Groups[0].Endpoints).
-					Msg("service endpoints")
-				logger.Info().
-					Str("org_id", orgIDStr).
-					Str("service_id", serviceIDStr).
-					Interface("daemon_addresses", srvMeta.Groups[0].DaemonAddresses).
-					Msg("service daemon addresses")
-			}
+	// Try ServiceApiSource first, then ModelIpfsHash, then both if available
+	var protoHashes []string
+	if srvMeta.ServiceApiSource != "" {
+		protoHashes = append(protoHashes, srvMeta.ServiceApiSource)
+	}
+	if srvMeta.ModelIpfsHash != "" {
+		protoHashes = append(protoHashes, srvMeta.ModelIpfsHash)
+	}
 
-			srvMeta.OrgID = orgID
-			srvMeta.SnetID = strings.ReplaceAll(string(serviceIDBytes[:]), "\u0000", "")
-			srvMeta.SnetOrgID = org.SnetID
-			dbSrvMeta, err := srvMeta.DB()
-			if err != nil {
-				logger.Error().Err(err)
-			}
-			srvMeta.ID, err = s.DB.CreateSnetService(dbSrvMeta)
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Int("id", srvMeta.ID).
-					Str("snet-id", srvMeta.SnetID).
-					Msg("failed to add snet_service")
-			}
+	if len(protoHashes) == 0 {
+		logger.Error().
+			Str("snet_id", srvMeta.SnetID).
+			Msg("both ModelIpfsHash and ServiceApiSource are empty")
+		return nil, true
+	}
 
-			// Try ServiceApiSource first, then ModelIpfsHash, then both if available
-			var protoHashes []string
-			if srvMeta.ServiceApiSource != "" {
-				protoHashes = append(protoHashes, srvMeta.ServiceApiSource)
-			}
-			if srvMeta.ModelIpfsHash != "" {
-				protoHashes = append(protoHashes, srvMeta.ModelIpfsHash)
-			}
+	logger.Info().
+		Str("snet_id", srvMeta.SnetID).
+		Str("model_ipfs_hash", srvMeta.ModelIpfsHash).
+		Msg("model IPFS hash")
+	logger.Info().
+		Str("snet_id", srvMeta.SnetID).
+		Str("service_api_source", srvMeta.ServiceApiSource).
+		Msg("service API source")
 
-			if len(protoHashes) == 0 {
-				logger.Error().
-					Str("snet_id", srvMeta.SnetID).
-					Msg("both ModelIpfsHash and ServiceApiSource are empty")
-				continue
-			}
+	// Try each hash until one works
+	var content []byte
+	var successfulHash string
+	var protoErr error
 
+	for _, protoHash := range protoHashes {
+		logger.Info().
+			Str("snet_id", srvMeta.SnetID).
+			Str("hash", protoHash).
+			Msg("trying to get proto files from IPFS")
+		content, protoErr = runStage(ctx, stages.ipfs, func() ([]byte, error) {
+			return s.IPFSClient.GetIpfsFile(protoHash)
+		})
+		if protoErr == nil {
+			successfulHash = protoHash
 			logger.Info().
 				Str("snet_id", srvMeta.SnetID).
-				Str("model_ipfs_hash", srvMeta.ModelIpfsHash).
-				Msg("model IPFS hash")
-			logger.Info().
-				Str("snet_id", srvMeta.SnetID).
-				Str("service_api_source", srvMeta.ServiceApiSource).
-				Msg("service API source")
-
-			// Try each hash until one works
-			var content []byte
-			var successfulHash string
-			var protoErr error
-
-			for _, protoHash := range protoHashes {
-				logger.Info().
-					Str("snet_id", srvMeta.SnetID).
-					Str("hash", protoHash).
-					Msg("trying to get proto files from IPFS")
-				content, protoErr = s.IPFSClient.GetIpfsFile(protoHash)
-				if protoErr == nil {
-					successfulHash = protoHash
-					logger.Info().
-						Str("snet_id", srvMeta.SnetID).
-						Str("successful_hash", successfulHash).
-						Msg("successfully got proto files from IPFS")
-					break
-				}
-				logger.Error().
-					Err(protoErr).
-					Str("hash", protoHash).
-					Str("snet_id", srvMeta.SnetID).
-					Msg("failed to get proto files from IPFS, trying next hash")
-			}
+				Str("successful_hash", successfulHash).
+				Msg("successfully got proto files from IPFS")
+			break
+		}
+		logger.Error().
+			Err(protoErr).
+			Str("hash", protoHash).
+			Str("snet_id", srvMeta.SnetID).
+			Msg("failed to get proto files from IPFS, trying next hash")
+	}
 
-			if protoErr != nil {
-				logger.Error().
-					Err(protoErr).
-					Strs("hashes", protoHashes).
-					Str("snet_id", srvMeta.SnetID).
-					Msg("failed to get proto files from all IPFS hashes")
-				continue
-			}
+	if protoErr != nil {
+		logger.Error().
+			Err(protoErr).
+			Strs("hashes", protoHashes).
+			Str("snet_id", srvMeta.SnetID).
+			Msg("failed to get proto files from all IPFS hashes")
+		return nil, true
+	}
 
-			logger.Info().
-				Str("snet_id", srvMeta.SnetID).
-				Int("content_size", len(content)).
-				Msg("received content from IPFS")
-			logger.Info().
-				Str("snet_id", srvMeta.SnetID).
-				Str("full_content", string(content)).
-				Msg("FULL IPFS CONTENT")
-
-			protoFiles, err := ipfs.ReadFilesCompressed(string(content))
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("hash", successfulHash).
-					Str("snet_id", srvMeta.SnetID).
-					Msg("failed to read compressed proto files")
-				continue
-			}
+	logger.Info().
+		Str("snet_id", srvMeta.SnetID).
+		Int("content_size", len(content)).
+		Msg("received content from IPFS")
+	logger.Info().
+		Str("snet_id", srvMeta.SnetID).
+		Str("full_content", string(content)).
+		Msg("FULL IPFS CONTENT")
 
-			logger.Info().
-				Str("snet_id", srvMeta.SnetID).
-				Int("files_count", len(protoFiles)).
-				Msg("extracted proto files count")
-			for fileName, fileContent := range protoFiles {
-				logger.Info().
-					Str("snet_id", srvMeta.SnetID).
-					Str("file_name", fileName).
-					Int("file_size", len(fileContent)).
-					Msg("proto file details")
-			}
+	protoFiles, err := ipfs.ReadFilesCompressed(string(content))
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("hash", successfulHash).
+			Str("snet_id", srvMeta.SnetID).
+			Msg("failed to read compressed proto files")
+		return nil, true
+	}
 
-			protoFilesMap := make(map[string]string)
-			for fileName, fileContent := range protoFiles {
-				protoFilesMap[fileName] = string(fileContent)
-			}
+	logger.Info().
+		Str("snet_id", srvMeta.SnetID).
+		Int("files_count", len(protoFiles)).
+		Msg("extracted proto files count")
+	for fileName, fileContent := range protoFiles {
+		logger.Info().
+			Str("snet_id", srvMeta.SnetID).
+			Str("file_name", fileName).
+			Int("file_size", len(fileContent)).
+			Msg("proto file details")
+	}
 
-			// Add training.proto without importing google/protobuf/descriptor.proto
-			trainingProtoContent := `syntax = "proto3";
+	sources := make(map[string]string)
+	for fileName, fileContent := range protoFiles {
+		sources[fileName] = string(fileContent)
+	}
+	protoFilesMap := maps.Clone(sources)
+
+	// Add training.proto without importing google/protobuf/descriptor.proto
+	trainingProtoContent := `syntax = "proto3";
 package training;
 option go_package = "github.com/singnet/snet-daemon/v5/training;training";
 import "google/protobuf/descriptor.proto";
@@ -470,10 +638,10 @@ message ValidateRequest {
 
 // Temporarily removed extensions to test compilation`
 
-			protoFilesMap["training.proto"] = trainingProtoContent
+	protoFilesMap["training.proto"] = trainingProtoContent
 
-			// Add full google/protobuf/descriptor.proto
-			googleDescriptorProto := `syntax = "proto2";
+	// Add full google/protobuf/descriptor.proto
+	googleDescriptorProto := `syntax = "proto2";
 
 package google.protobuf;
 
@@ -729,74 +897,158 @@ message Annotation {
   optional int32 end = 4;
 }`
 
-			protoFilesMap["google/protobuf/descriptor.proto"] = googleDescriptorProto
-
-			hasValidFileDescriptor := false
-			for fileName, fileContent := range protoFiles {
-				modifiedContent := string(fileContent)
-				if fileName == "main.proto" {
-					lines := strings.Split(modifiedContent, "\n")
-					var filteredLines []string
-					for _, line := range lines {
-						if !strings.Contains(line, "option (training.") {
-							filteredLines = append(filteredLines, line)
-						}
-					}
-					modifiedContent = strings.Join(filteredLines, "\n")
-				}
-
-				tempProtoFilesMap := make(map[string]string)
-				for k, v := range protoFilesMap {
-					tempProtoFilesMap[k] = v
-				}
-				tempProtoFilesMap[fileName] = modifiedContent
-
-				fd := getFileDescriptorWithDependencies(tempProtoFilesMap, fileName)
-				if fd != nil {
-					s.FileDescriptors[srvMeta.SnetID] = append(s.FileDescriptors[srvMeta.SnetID], fd)
-					hasValidFileDescriptor = true
-					err := os.WriteFile(fileName, fileContent, 0600)
-					if err != nil {
-						return
-					}
+	protoFilesMap["google/protobuf/descriptor.proto"] = googleDescriptorProto
+
+	var descriptors []protoreflect.FileDescriptor
+	hasValidFileDescriptor := false
+	for fileName, fileContent := range protoFiles {
+		modifiedContent := string(fileContent)
+		if fileName == "main.proto" {
+			lines := strings.Split(modifiedContent, "\n")
+			var filteredLines []string
+			for _, line := range lines {
+				if !strings.Contains(line, "option (training.") {
+					filteredLines = append(filteredLines, line)
 				}
 			}
+			modifiedContent = strings.Join(filteredLines, "\n")
+		}
 
-			if hasValidFileDescriptor {
-				logger.Info().
-					Str("snet_id", srvMeta.SnetID).
-					Msg("successfully created file descriptors")
-			} else {
-				logger.Warn().
-					Str("snet_id", srvMeta.SnetID).
-					Msg("failed to create file descriptors, but will still be saved to database")
-			}
+		tempProtoFilesMap := make(map[string]string)
+		for k, v := range protoFilesMap {
+			tempProtoFilesMap[k] = v
+		}
+		tempProtoFilesMap[fileName] = modifiedContent
+
+		fd, err := runStage(ctx, stages.compile, func() (protoreflect.FileDescriptor, error) {
+			return getFileDescriptorWithDependencies(tempProtoFilesMap, fileName), nil
+		})
+		if err != nil {
+			return descriptors, true
+		}
+		if fd != nil {
+			descriptors = append(descriptors, fd)
+			hasValidFileDescriptor = true
 		}
 	}
 
-	logger.Info().
-		Int("processed_organizations", processedOrgs).
-		Int("processed_services", processedServices).
-		Dur("duration", time.Since(startTime)).
-		Msg("snet syncer successfully")
+	if hasValidFileDescriptor {
+		logger.Info().
+			Str("snet_id", srvMeta.SnetID).
+			Msg("successfully created file descriptors")
+		s.saveServiceProtos(srvMeta.SnetID, sources, descriptors)
+	} else {
+		logger.Warn().
+			Str("snet_id", srvMeta.SnetID).
+			Msg("failed to create file descriptors, but will still be saved to database")
+	}
+
+	return descriptors, true
 }
 
+// saveServiceProtos stores the proto sources of a service with the descriptors compiled from them,
+// so calls of the service need neither IPFS nor the compiler.
+func (s *SnetSyncer) saveServiceProtos(snetID string, sources map[string]string, descriptors []protoreflect.FileDescriptor) {
+	logger := log.With().Str("snet_id", snetID).Logger()
+
+	protos, err := NewServiceProtos(sources, descriptors)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to serialize proto descriptors")
+		return
+	}
+	if err = s.DB.SaveServiceProtos(protos); err != nil {
+		logger.Error().Err(err).Msg("failed to save proto descriptors")
+		return
+	}
+	if err = s.DB.SetSnetServiceProtoHash(snetID, protos.ContentHash); err != nil {
+		logger.Error().Err(err).Msg("failed to set proto hash of service")
+		return
+	}
+	logger.Debug().Str("content_hash", protos.ContentHash).Msg("proto descriptors saved")
+}
+
+// deleteMissing marks the organizations and services no longer in the registry as deleted after a complete sync.
+// Services of organizations that could not be synced are kept, since their current services are unknown.
+// It returns the Snet IDs of the services marked as deleted.
+func (s *SnetSyncer) deleteMissing(orgs [][32]byte, seenServices, unknownOrgs []string) []string {
+	logger := log.With().Logger()
+
+	// An empty registry is far more likely a failed read than the deletion of everything
+	if len(orgs) == 0 {
+		logger.Warn().Msg("no organizations in registry, skipping deletion of missing ones")
+		return nil
+	}
+
+	seenOrgs := make([]string, 0, len(orgs))
+	for _, orgIDBytes := range orgs {
+		seenOrgs = append(seenOrgs, snetID(orgIDBytes))
+	}
+	deletedOrgs, err := s.DB.DeleteSnetOrgsExcept(seenOrgs)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to delete missing organizations")
+	}
+	deletedServices, err := s.DB.DeleteSnetServicesExcept(seenServices, unknownOrgs)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to delete missing services")
+	}
+
+	if len(deletedOrgs) > 0 || len(deletedServices) > 0 {
+		logger.Info().
+			Strs("organizations", deletedOrgs).
+			Strs("services", deletedServices).
+			Msg("marked organizations and services missing from registry as deleted")
+	}
+	return deletedServices
+}
+
+// ready reports whether the IPFS client and the database the syncer stores into are set.
+func (s *SnetSyncer) ready() bool {
+	if s.IPFSClient.HttpApi == nil {
+		log.Error().Msg("IPFSClient.HttpApi is nil")
+		return false
+	}
+	if s.DB == nil {
+		log.Error().Msg("DB is nil")
+		return false
+	}
+	return true
+}
+
+// Start runs a full sync right away unless one has completed already, then every config.Sync.Interval,
+// and applies registry events every config.Sync.EventsInterval until the context is cancelled or Stop is called.
 func (s *SnetSyncer) Start(ctx context.Context) {
 	// Store the cancel function for later use in Stop
 	ctx, cancel := context.WithCancel(ctx)
 	s.cancelFunc = cancel
 
-	duration := 24 * time.Hour
-	// duration := 5 * time.Minute
-	ticker := time.NewTicker(duration)
+	if !s.Synced() {
+		log.Info().Msg("starting initial sync in the background")
+		s.SyncOnce(ctx)
+	}
+
+	ticker := time.NewTicker(config.Sync.Interval)
 	defer ticker.Stop()
 
-	log.Info().Msg("SNET syncer started successfully, waiting for sync interval")
+	var events <-chan time.Time
+	if config.Sync.EventsInterval > 0 {
+		eventsTicker := time.NewTicker(config.Sync.EventsInterval)
+		defer eventsTicker.Stop()
+		events = eventsTicker.C
+	}
+
+	log.Info().
+		Dur("interval", config.Sync.Interval).
+		Dur("events_interval", config.Sync.EventsInterval).
+		Msg("SNET syncer started successfully, waiting for sync interval")
 	for {
 		select {
 		case <-ticker.C:
 			log.Debug().Msg("sync interval triggered, starting sync process")
-			s.SyncOnce()
+			s.SyncOnce(ctx)
+		case <-events:
+			if err := s.SyncEvents(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to sync registry events")
+			}
 		case <-ctx.Done():
 			log.Info().Msg("snet syncer received shutdown signal, stopping sync process")
 			return
@@ -0,0 +1,169 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/pkg/db"
+)
+
+var (
+	// ErrDisabled is returned when no wallet encryption key is configured.
+	ErrDisabled = errors.New("user wallets are disabled")
+	// ErrNotFound is returned when a Matrix user has no wallet yet.
+	ErrNotFound = errors.New("wallet not found")
+)
+
+// Manager maps Matrix users to their own signing keys stored encrypted in the database.
+type Manager struct {
+	database db.Service  // The database holding the encrypted wallets.
+	aead     cipher.AEAD // The cipher used to encrypt private keys, nil if wallets are disabled.
+}
+
+// NewManager creates and returns a new Manager.
+// The encryption key is derived from the given secret; an empty secret disables user wallets.
+func NewManager(database db.Service, secret string) *Manager {
+	m := &Manager{database: database}
+	if secret == "" {
+		log.Warn().Msg("wallet encryption key is not set, user wallets are disabled")
+		return m
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create wallet cipher")
+		return m
+	}
+	m.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create wallet cipher")
+	}
+	return m
+}
+
+// Enabled reports whether user wallets can be used.
+func (m *Manager) Enabled() bool {
+	return m != nil && m.aead != nil
+}
+
+// Get returns the wallet of a Matrix user or ErrNotFound.
+func (m *Manager) Get(matrixUserID string) (*db.UserWallet, error) {
+	if !m.Enabled() {
+		return nil, ErrDisabled
+	}
+
+	w, err := m.database.GetUserWallet(matrixUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+	if w == nil {
+		return nil, ErrNotFound
+	}
+	return w, nil
+}
+
+// Create generates a new signing key for a Matrix user. An existing wallet is returned unchanged.
+func (m *Manager) Create(matrixUserID string) (*db.UserWallet, error) {
+	w, err := m.Get(matrixUserID)
+	if err == nil {
+		return w, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	encrypted, err := m.encrypt(crypto.FromECDSA(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	w = &db.UserWallet{
+		MatrixUserID:        matrixUserID,
+		Address:             crypto.PubkeyToAddress(privateKey.PublicKey).Hex(),
+		EncryptedPrivateKey: encrypted,
+	}
+	if err := m.database.SaveUserWallet(w); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("matrix_user_id", matrixUserID).
+		Str("address", w.Address).
+		Msg("user wallet created")
+	return w, nil
+}
+
+// Link attaches an external address owned by the user to their wallet.
+func (m *Manager) Link(matrixUserID, address string) (*db.UserWallet, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid address: %s", address)
+	}
+
+	w, err := m.Get(matrixUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	linked := common.HexToAddress(address).Hex()
+	w.LinkedAddress = &linked
+	if err := m.database.SaveUserWallet(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// PrivateKey decrypts the signing key of a Matrix user.
+func (m *Manager) PrivateKey(matrixUserID string) (*ecdsa.PrivateKey, error) {
+	w, err := m.Get(matrixUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := m.decrypt(w.EncryptedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := crypto.ToECDSA(plain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wallet key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// encrypt seals the plaintext with a random nonce prepended to the ciphertext.
+func (m *Manager) encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return m.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// decrypt opens a ciphertext produced by encrypt.
+func (m *Manager) decrypt(sealed []byte) ([]byte, error) {
+	nonceSize := m.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("encrypted wallet key is too short")
+	}
+	plain, err := m.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt wallet key: %w", err)
+	}
+	return plain, nil
+}
@@ -6,18 +6,22 @@ import (
 	"crypto/ecdsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog/log"
 
 	contracts "github.com/singnet/snet-ecosystem-contracts"
 	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
 )
 
 var (
@@ -104,15 +108,28 @@ type ChansToWatch struct {
 	Err             chan error
 }
 
+// Client is the part of the Ethereum node API used by the framework.
+// It is implemented by *ethclient.Client and by the client of go-ethereum's simulated backend.
+type Client interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ethereum.BlockNumberReader
+	ethereum.ChainIDReader
+	ethereum.ChainReader
+	ethereum.ChainStateReader
+}
+
 // Ethereum represents the Ethereum client, including HTTP and WebSocket clients, registry, and MPE (MultiPartyEscrow) contracts.
 type Ethereum struct {
-	Client     *ethclient.Client
-	WSSClient  *ethclient.Client
-	Registry   *Registry
-	MPE        *MultiPartyEscrow
-	MPEAddress common.Address
-	privateKey *ecdsa.PrivateKey
-	chainID    *big.Int
+	Client          Client
+	WSSClient       Client
+	Registry        *Registry
+	RegistryAddress common.Address
+	MPE             *MultiPartyEscrow
+	MPEAddress      common.Address
+	Token           *FetchToken
+	TokenAddress    common.Address
+	chainID         *big.Int
 }
 
 // Init initializes the Ethereum client and connects to the blockchain via HTTPS and WSS. It also initializes the registry and MPE contracts.
@@ -122,21 +139,22 @@ type Ethereum struct {
 func Init() (e Ethereum) {
 	var err error
 	log.Debug().Any("ETH_URL", config.Blockchain.EthProviderURL).Msg("ETH_URL")
-	e.Client, err = ethclient.Dial(config.Blockchain.EthProviderURL)
+	client, err := ethclient.Dial(config.Blockchain.EthProviderURL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to blockchain via HTTPS")
 	}
-	e.WSSClient, err = ethclient.Dial(config.Blockchain.EthProviderWSURL)
+	e.Client = client
+	wssClient, err := ethclient.Dial(config.Blockchain.EthProviderWSURL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to blockchain via WSS")
 	}
+	e.WSSClient = wssClient
 
-	e.privateKey, err = crypto.HexToECDSA(config.Blockchain.AdminPrivateKey)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to parse private key")
+	if _, err = signer.Admin(); err != nil {
+		log.Fatal().Err(err).Msg("failed to load admin signer")
 	}
 
-	e.chainID, err = e.Client.NetworkID(context.Background())
+	e.chainID, err = e.Client.ChainID(context.Background())
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to get chain ID")
 	}
@@ -152,6 +170,42 @@ func Init() (e Ethereum) {
 	return
 }
 
+// New creates an Ethereum instance on top of connected clients, e.g. those of a simulated backend,
+// and binds the Registry and MPE contracts at the given addresses. The token is the one escrowed by the MPE contract.
+//
+// Parameters:
+//   - client: The client used for calls and transactions.
+//   - wssClient: The client used to watch contract events.
+//   - registryAddress: The address of the Registry contract.
+//   - mpeAddress: The address of the MultiPartyEscrow contract.
+//
+// Returns:
+//   - Ethereum: The Ethereum instance.
+//   - error: An error if the chain ID cannot be read or a contract cannot be bound.
+func New(client, wssClient Client, registryAddress, mpeAddress common.Address) (Ethereum, error) {
+	e := Ethereum{
+		Client:    client,
+		WSSClient: wssClient,
+	}
+
+	var err error
+	e.chainID, err = client.ChainID(context.Background())
+	if err != nil {
+		return Ethereum{}, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	e.Registry, err = NewRegistry(registryAddress, client)
+	if err != nil {
+		return Ethereum{}, fmt.Errorf("failed to bind registry: %w", err)
+	}
+	e.RegistryAddress = registryAddress
+
+	if err = e.bindMPE(mpeAddress); err != nil {
+		return Ethereum{}, err
+	}
+	return e, nil
+}
+
 // networks represents a mapping of network names to their respective addresses.
 type networks map[string]struct {
 	Address string `json:"address"`
@@ -175,6 +229,7 @@ func (eth *Ethereum) InitRegistry() (err error) {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to init registry smart contract")
 	}
+	eth.RegistryAddress = common.HexToAddress(registryAddress)
 	return
 }
 
@@ -192,16 +247,26 @@ func (eth *Ethereum) InitMPE() (err error) {
 	}
 	address := n[config.Blockchain.ChainID].Address
 	log.Debug().Msgf("MPE address: %s", address)
-	eth.MPE, err = NewMultiPartyEscrow(common.HexToAddress(address), eth.WSSClient)
+	return eth.bindMPE(common.HexToAddress(address))
+}
+
+// bindMPE binds the MultiPartyEscrow contract at the address and the token contract it escrows.
+func (eth *Ethereum) bindMPE(address common.Address) (err error) {
+	eth.MPE, err = NewMultiPartyEscrow(address, eth.WSSClient)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to init MPE")
+		return fmt.Errorf("failed to bind MPE: %w", err)
 	}
-	eth.MPEAddress = common.HexToAddress(address)
-	callOpts := &bind.CallOpts{}
-	tokenAddress, _ := eth.MPE.Token(callOpts)
-	log.Debug().Msgf("token address: %s", tokenAddress)
-
-	return
+	eth.MPEAddress = address
+	eth.TokenAddress, err = eth.MPE.Token(&bind.CallOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to get token address: %w", err)
+	}
+	log.Debug().Msgf("token address: %s", eth.TokenAddress)
+	eth.Token, err = NewFetchToken(eth.TokenAddress, eth.Client)
+	if err != nil {
+		return fmt.Errorf("failed to bind token: %w", err)
+	}
+	return nil
 }
 
 // GetOrgs retrieves a list of organization IDs from the registry contract.
@@ -318,12 +383,11 @@ func (eth Ethereum) GetMPEBalance(address common.Address) (*big.Int, error) {
 }
 
 // GetTransactOpts creates transaction options for blockchain operations.
-func GetTransactOpts(chainID *big.Int, privateKey *ecdsa.PrivateKey) (*bind.TransactOpts, error) {
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transactor: %w", err)
+func GetTransactOpts(chainID *big.Int, s signer.Signer) (*bind.TransactOpts, error) {
+	if s == nil {
+		return nil, fmt.Errorf("failed to create transactor: no signer")
 	}
-	return auth, nil
+	return signer.TransactOpts(s, chainID), nil
 }
 
 // GetCallOpts creates call options for blockchain operations.
@@ -403,6 +467,106 @@ func (eth Ethereum) FilterChannels(senders, recipients []common.Address, groupID
 	return nil, nil
 }
 
+// GetChannel reads the current on-chain state of a channel by its ID.
+// It returns an error if the channel does not exist, e.g. because it was claimed.
+func (eth Ethereum) GetChannel(channelID *big.Int, callOpts *bind.CallOpts) (*MultiPartyEscrowChannelOpen, error) {
+	channel, err := eth.MPE.Channels(callOpts, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel %s: %w", channelID, err)
+	}
+	if channel.Sender == (common.Address{}) {
+		return nil, fmt.Errorf("channel %s does not exist", channelID)
+	}
+
+	return &MultiPartyEscrowChannelOpen{
+		ChannelId:  channelID,
+		Nonce:      channel.Nonce,
+		Sender:     channel.Sender,
+		Signer:     channel.Signer,
+		Recipient:  channel.Recipient,
+		GroupId:    channel.GroupId,
+		Amount:     channel.Value,
+		Expiration: channel.Expiration,
+	}, nil
+}
+
+// ChannelFromReceipt finds the channel opened or funded by a confirmed MPE transaction
+// and returns its current on-chain state.
+func (eth Ethereum) ChannelFromReceipt(receipt *types.Receipt, callOpts *bind.CallOpts) (*MultiPartyEscrowChannelOpen, error) {
+	for _, entry := range receipt.Logs {
+		if entry == nil || entry.Address != eth.MPEAddress {
+			continue
+		}
+		if opened, err := eth.MPE.ParseChannelOpen(*entry); err == nil {
+			return eth.GetChannel(opened.ChannelId, callOpts)
+		}
+		if funded, err := eth.MPE.ParseChannelAddFunds(*entry); err == nil {
+			return eth.GetChannel(funded.ChannelId, callOpts)
+		}
+	}
+	return nil, fmt.Errorf("transaction %s neither opened nor funded a channel", receipt.TxHash.Hex())
+}
+
+// SenderChannels returns the IDs of all channels opened by the sender within the filter range.
+func (eth Ethereum) SenderChannels(sender common.Address, filterOpts *bind.FilterOpts) ([]*big.Int, error) {
+	iter, err := eth.MPE.FilterChannelOpen(filterOpts, []common.Address{sender}, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter channels: %w", err)
+	}
+	defer iter.Close()
+
+	var channelIDs []*big.Int
+	for iter.Next() {
+		channelIDs = append(channelIDs, iter.Event.ChannelId)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate channels: %w", err)
+	}
+	return channelIDs, nil
+}
+
+// ClaimChannelTimeout returns the value of an expired channel to the MPE balance of its sender and waits for the receipt.
+func (eth Ethereum) ClaimChannelTimeout(ctx context.Context, channelID *big.Int, opts *bind.TransactOpts) (*types.Receipt, error) {
+	tx, err := eth.MPE.ChannelClaimTimeout(opts, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim channel timeout: %w", err)
+	}
+	return eth.waitMined(ctx, tx)
+}
+
+// WithdrawFromMPE withdraws funds from the MPE balance of the sender and waits for the receipt.
+func (eth Ethereum) WithdrawFromMPE(ctx context.Context, amount *big.Int, opts *bind.TransactOpts) (*types.Receipt, error) {
+	tx, err := eth.MPE.Withdraw(opts, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to withdraw: %w", err)
+	}
+	return eth.waitMined(ctx, tx)
+}
+
+// DepositToMPE approves and deposits tokens of the sender to its MPE balance and waits for the receipt.
+func (eth Ethereum) DepositToMPE(ctx context.Context, amount *big.Int, opts *BindOpts) (*types.Receipt, error) {
+	if err := eth.EnsureAllowance(opts.Transact.From, amount, opts); err != nil {
+		return nil, err
+	}
+	tx, err := eth.MPE.Deposit(estimateGas(opts.Transact), amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deposit to MPE: %w", err)
+	}
+	return eth.waitMined(ctx, tx)
+}
+
+// waitMined waits for a transaction receipt and returns an error if the transaction failed.
+func (eth Ethereum) waitMined(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	receipt, err := bind.WaitMined(ctx, eth.Client, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for transaction %s: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, fmt.Errorf("transaction %s failed", tx.Hash().Hex())
+	}
+	return receipt, nil
+}
+
 // EnsureChannelValidity ensures the channel is valid and has sufficient funds.
 func (eth Ethereum) EnsureChannelValidity(opened *MultiPartyEscrowChannelOpen, currentSigned, price, newExpiration *big.Int, opts *BindOpts, chans *ChansToWatch) (*big.Int, error) {
 	logger := log.With().
@@ -431,95 +595,152 @@ func (eth Ethereum) EnsureChannelValidity(opened *MultiPartyEscrowChannelOpen, c
 	}
 
 	if needFunds {
-		logger.Info().Msg("adding funds to payment channel")
+		if _, err := eth.AddChannelFunds(opened, new(big.Int).Sub(price, avail), price, opts, chans); err != nil {
+			return nil, err
+		}
+	}
 
-		missing := new(big.Int).Sub(price, avail)
+	if needExtend {
+		logger.Info().
+			Str("new_expiration", newExpiration.String()).
+			Msg("extending payment channel")
+
+		go eth.watchChannelExtend(opts.Watch, chans.ChannelExtends, chans.Err, []*big.Int{opened.ChannelId})
 
-		mpeBal, err := eth.MPE.Balances(opts.Call, opened.Sender)
+		tx, err := eth.MPE.ChannelExtend(estimateGas(opts.Transact), opened.ChannelId, newExpiration)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get MPE balance: %w", err)
+			return nil, fmt.Errorf("failed to extend channel: %w", err)
 		}
 
-		if mpeBal.Cmp(missing) < 0 {
-			logger.Info().
-				Str("mpe_balance", mpeBal.String()).
-				Str("missing_amount", missing.String()).
-				Msg("depositing to MPE")
+		logger.Info().
+			Str("tx_hash", tx.Hash().Hex()).
+			Str("new_expiration", newExpiration.String()).
+			Msg("channel extend transaction sent")
 
-			go eth.watchDepositFunds(opts.Watch, chans.DepositFunds, chans.Err, []common.Address{opened.Sender})
+		extendedID := waitingForChannelToExtend(chans.ChannelExtends, chans.Err, 30*time.Second)
+		if extendedID == nil {
 
-			tx, err := eth.MPE.Deposit(estimateGas(opts.Transact), missing)
-			if err != nil {
-				return nil, fmt.Errorf("failed to deposit to MPE: %w", err)
-			}
+			return nil, fmt.Errorf("channel extend timeout")
 
-			logger.Info().
-				Str("tx_hash", tx.Hash().Hex()).
-				Str("amount", missing.String()).
-				Msg("MPE deposit transaction sent")
+		}
 
-			deposited := waitingToDepositToMPE(chans.DepositFunds, chans.Err, 30*time.Second)
-			if !deposited {
+		logger.Info().Msg("payment channel extended successfully")
+	}
 
-				return nil, fmt.Errorf("deposit to MPE timeout")
+	return opened.ChannelId, nil
+}
 
-			}
-		}
+// TopUpAmount returns the amount added to a payment channel that lacks missing cogs for a payment of increment cogs.
+// The channel is funded for the configured number of such payments at once, so following calls need no transaction.
+//
+// Parameters:
+//   - missing: The amount the channel lacks for the payment.
+//   - increment: The amount of the payment.
+//
+// Returns:
+//   - *big.Int: The amount to add to the channel.
+func TopUpAmount(missing, increment *big.Int) *big.Int {
+	extra := new(big.Int).Mul(increment, new(big.Int).SetUint64(max(config.Blockchain.TopUpMultiple, 1)-1))
+	return new(big.Int).Add(missing, extra)
+}
+
+// AddChannelFunds adds funds to a payment channel, depositing to the MPE contract first if the sender's balance is too low.
+//
+// Parameters:
+//   - opened: The channel to fund.
+//   - missing: The amount the channel lacks for the payment.
+//   - increment: The amount of the payment, used to fund the channel for several payments at once.
+//   - opts: Transaction options.
+//   - chans: Channels for watching events.
+//
+// Returns:
+//   - *big.Int: The amount added to the channel.
+//   - error: A *TokenShortfallError if the sender holds too few tokens, or an error if the operation fails.
+func (eth Ethereum) AddChannelFunds(opened *MultiPartyEscrowChannelOpen, missing, increment *big.Int, opts *BindOpts, chans *ChansToWatch) (*big.Int, error) {
+	logger := log.With().
+		Str("channel_id", opened.ChannelId.String()).
+		Str("sender", opened.Sender.Hex()).
+		Logger()
+
+	amount := TopUpAmount(missing, increment)
+
+	mpeBal, err := eth.MPE.Balances(opts.Call, opened.Sender)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MPE balance: %w", err)
+	}
+
+	if mpeBal.Cmp(amount) < 0 {
+		deposit := new(big.Int).Sub(amount, mpeBal)
 
 		logger.Info().
-			Str("amount", missing.String()).
-			Msg("adding funds to payment channel")
+			Str("mpe_balance", mpeBal.String()).
+			Str("deposit_amount", deposit.String()).
+			Msg("depositing to MPE")
+
+		err := eth.EnsureAllowance(opened.Sender, deposit, opts)
+		var shortfall *TokenShortfallError
+		if errors.As(err, &shortfall) && new(big.Int).Add(mpeBal, shortfall.Balance).Cmp(missing) >= 0 {
+			// Fund the channel with whatever the sender holds if it still covers the payment
+			amount = new(big.Int).Add(mpeBal, shortfall.Balance)
+			logger.Info().
+				Str("amount", amount.String()).
+				Msg("token balance does not cover the full top-up, adding what is available")
+			err = nil
+			if shortfall.Balance.Sign() > 0 {
+				err = eth.EnsureAllowance(opened.Sender, shortfall.Balance, opts)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		go eth.watchChannelAddFunds(opts.Watch, chans.ChannelAddFunds, chans.Err, []*big.Int{opened.ChannelId})
+	if deposit := new(big.Int).Sub(amount, mpeBal); deposit.Sign() > 0 {
+		go eth.watchDepositFunds(opts.Watch, chans.DepositFunds, chans.Err, []common.Address{opened.Sender})
 
-		tx, err := eth.MPE.ChannelAddFunds(estimateGas(opts.Transact), opened.ChannelId, missing)
+		tx, err := eth.MPE.Deposit(estimateGas(opts.Transact), deposit)
 		if err != nil {
-			return nil, fmt.Errorf("failed to add funds to channel: %w", err)
+			return nil, fmt.Errorf("failed to deposit to MPE: %w", err)
 		}
 
 		logger.Info().
 			Str("tx_hash", tx.Hash().Hex()).
-			Str("amount", missing.String()).
-			Msg("channel add funds transaction sent")
+			Str("amount", deposit.String()).
+			Msg("MPE deposit transaction sent")
 
-		addedFundsID := waitingForChannelFundsToBeAdded(chans.ChannelAddFunds, chans.Err, 30*time.Second)
-		if addedFundsID == nil {
+		deposited := waitingToDepositToMPE(chans.DepositFunds, chans.Err, 30*time.Second)
+		if !deposited {
 
-			return nil, fmt.Errorf("add funds timeout")
+			return nil, fmt.Errorf("deposit to MPE timeout")
 
 		}
-
-		logger.Info().Msg("funds added to payment channel successfully")
 	}
 
-	if needExtend {
-		logger.Info().
-			Str("new_expiration", newExpiration.String()).
-			Msg("extending payment channel")
-
-		go eth.watchChannelExtend(opts.Watch, chans.ChannelExtends, chans.Err, []*big.Int{opened.ChannelId})
+	logger.Info().
+		Str("amount", amount.String()).
+		Msg("adding funds to payment channel")
 
-		tx, err := eth.MPE.ChannelExtend(estimateGas(opts.Transact), opened.ChannelId, newExpiration)
-		if err != nil {
-			return nil, fmt.Errorf("failed to extend channel: %w", err)
-		}
+	go eth.watchChannelAddFunds(opts.Watch, chans.ChannelAddFunds, chans.Err, []*big.Int{opened.ChannelId})
 
-		logger.Info().
-			Str("tx_hash", tx.Hash().Hex()).
-			Str("new_expiration", newExpiration.String()).
-			Msg("channel extend transaction sent")
+	tx, err := eth.MPE.ChannelAddFunds(estimateGas(opts.Transact), opened.ChannelId, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add funds to channel: %w", err)
+	}
 
-		extendedID := waitingForChannelToExtend(chans.ChannelExtends, chans.Err, 30*time.Second)
-		if extendedID == nil {
+	logger.Info().
+		Str("tx_hash", tx.Hash().Hex()).
+		Str("amount", amount.String()).
+		Msg("channel add funds transaction sent")
 
-			return nil, fmt.Errorf("channel extend timeout")
+	addedFundsID := waitingForChannelFundsToBeAdded(chans.ChannelAddFunds, chans.Err, 30*time.Second)
+	if addedFundsID == nil {
 
-		}
+		return nil, fmt.Errorf("add funds timeout")
 
-		logger.Info().Msg("payment channel extended successfully")
 	}
 
-	return opened.ChannelId, nil
+	logger.Info().Msg("funds added to payment channel successfully")
+	return amount, nil
 }
 
 // OpenNewChannel opens a new payment channel with the specified parameters.
@@ -571,6 +792,10 @@ func (eth Ethereum) OpenNewChannel(price, desiredExpiration *big.Int, opts *Bind
 
 	log.Info().Msg("OpenNewChannel: insufficient balance, depositing and opening channel")
 
+	if err := eth.EnsureAllowance(senders[0], price, opts); err != nil {
+		return nil, err
+	}
+
 	go eth.watchChannelOpen(opts.Watch, chans.ChannelOpens, chans.Err, senders, recipients, groupIDs)
 	go eth.watchDepositFunds(opts.Watch, chans.DepositFunds, chans.Err, senders)
 
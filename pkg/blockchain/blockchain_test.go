@@ -0,0 +1,186 @@
+package blockchain_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/blockchaintest"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+var (
+	recipient = common.HexToAddress("0x94d04332C4f5273feF69c4a52D24f42a3aF1F207")
+	groupID   = [32]byte{1}
+)
+
+// openChannel opens a channel from the sender to the recipient through OpenNewChannel and returns its on-chain state.
+func openChannel(t *testing.T, chain *blockchaintest.Chain, sender signer.Signer, price, expiration *big.Int) *blockchain.MultiPartyEscrowChannelOpen {
+	t.Helper()
+
+	channelID, err := chain.ETH.OpenNewChannel(price, expiration, chain.BindOpts(t, sender), blockchaintest.NewChansToWatch(),
+		[]common.Address{sender.Address()}, []common.Address{recipient}, [][32]byte{groupID})
+	if err != nil {
+		t.Fatalf("failed to open channel: %v", err)
+	}
+	return getChannel(t, chain, channelID)
+}
+
+// getChannel reads the latest on-chain state of a channel.
+func getChannel(t *testing.T, chain *blockchaintest.Chain, channelID *big.Int) *blockchain.MultiPartyEscrowChannelOpen {
+	t.Helper()
+
+	channel, err := chain.ETH.GetChannel(channelID, nil)
+	if err != nil {
+		t.Fatalf("failed to get channel: %v", err)
+	}
+	return channel
+}
+
+// TestOpenNewChannel tests that a sender without MPE balance deposits tokens and opens a channel in one transaction.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestOpenNewChannel(t *testing.T) {
+	chain := blockchaintest.New(t)
+	sender := chain.NewAccount(t, big.NewInt(1000))
+
+	price := big.NewInt(100)
+	expiration := new(big.Int).Add(chain.BlockNumber(t), big.NewInt(100))
+	channel := openChannel(t, chain, sender, price, expiration)
+
+	if channel.Amount.Cmp(price) != 0 {
+		t.Errorf("channel amount = %s, want %s", channel.Amount, price)
+	}
+	if channel.Expiration.Cmp(expiration) != 0 {
+		t.Errorf("channel expiration = %s, want %s", channel.Expiration, expiration)
+	}
+	if channel.Sender != sender.Address() || channel.Recipient != recipient || channel.GroupId != groupID {
+		t.Errorf("channel parties = %s -> %s in group %x, want %s -> %s in group %x",
+			channel.Sender.Hex(), channel.Recipient.Hex(), channel.GroupId, sender.Address().Hex(), recipient.Hex(), groupID)
+	}
+
+	found, err := chain.ETH.FilterChannels([]common.Address{sender.Address()}, []common.Address{recipient}, [][32]byte{groupID},
+		chain.BindOpts(t, sender).Filter)
+	if err != nil {
+		t.Fatalf("failed to filter channels: %v", err)
+	}
+	if found == nil || found.ChannelId.Cmp(channel.ChannelId) != 0 {
+		t.Errorf("FilterChannels did not find channel %s", channel.ChannelId)
+	}
+
+	balance, err := chain.ETH.GetMPEBalance(sender.Address())
+	if err != nil {
+		t.Fatalf("failed to get MPE balance: %v", err)
+	}
+	if balance.Sign() != 0 {
+		t.Errorf("MPE balance = %s, want 0", balance)
+	}
+}
+
+// TestEnsureChannelValidity tests that a channel lacking funds for the next payment and about to expire
+// is funded and extended.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestEnsureChannelValidity(t *testing.T) {
+	chain := blockchaintest.New(t)
+	sender := chain.NewAccount(t, big.NewInt(1000))
+
+	price := big.NewInt(100)
+	opened := openChannel(t, chain, sender, price, new(big.Int).Add(chain.BlockNumber(t), big.NewInt(10)))
+
+	newExpiration := new(big.Int).Add(opened.Expiration, big.NewInt(100))
+	channelID, err := chain.ETH.EnsureChannelValidity(opened, price, big.NewInt(50), newExpiration,
+		chain.BindOpts(t, sender), blockchaintest.NewChansToWatch())
+	if err != nil {
+		t.Fatalf("failed to ensure channel validity: %v", err)
+	}
+	if channelID.Cmp(opened.ChannelId) != 0 {
+		t.Fatalf("channel ID = %s, want %s", channelID, opened.ChannelId)
+	}
+
+	channel := getChannel(t, chain, channelID)
+	if want := big.NewInt(150); channel.Amount.Cmp(want) != 0 {
+		t.Errorf("channel amount = %s, want %s", channel.Amount, want)
+	}
+	if channel.Expiration.Cmp(newExpiration) != 0 {
+		t.Errorf("channel expiration = %s, want %s", channel.Expiration, newExpiration)
+	}
+}
+
+// TestAddChannelFunds tests that a top-up larger than the token balance of the sender adds whatever it holds
+// as long as that covers the payment.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestAddChannelFunds(t *testing.T) {
+	topUpMultiple := config.Blockchain.TopUpMultiple
+	config.Blockchain.TopUpMultiple = 3
+	t.Cleanup(func() { config.Blockchain.TopUpMultiple = topUpMultiple })
+
+	chain := blockchaintest.New(t)
+	sender := chain.NewAccount(t, big.NewInt(120))
+
+	opened := openChannel(t, chain, sender, big.NewInt(100), new(big.Int).Add(chain.BlockNumber(t), big.NewInt(100)))
+
+	// The top-up is 10 missing cogs plus two more payments of 50, but only 20 cogs are left
+	added, err := chain.ETH.AddChannelFunds(opened, big.NewInt(10), big.NewInt(50),
+		chain.BindOpts(t, sender), blockchaintest.NewChansToWatch())
+	if err != nil {
+		t.Fatalf("failed to add channel funds: %v", err)
+	}
+	if want := big.NewInt(20); added.Cmp(want) != 0 {
+		t.Errorf("added = %s, want %s", added, want)
+	}
+
+	channel := getChannel(t, chain, opened.ChannelId)
+	if want := big.NewInt(120); channel.Amount.Cmp(want) != 0 {
+		t.Errorf("channel amount = %s, want %s", channel.Amount, want)
+	}
+}
+
+// TestClaimChannelTimeout tests that the value of an expired channel returns to the MPE balance of its sender
+// and can be withdrawn.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestClaimChannelTimeout(t *testing.T) {
+	chain := blockchaintest.New(t)
+	tokens := big.NewInt(1000)
+	sender := chain.NewAccount(t, tokens)
+
+	price := big.NewInt(100)
+	opened := openChannel(t, chain, sender, price, new(big.Int).Add(chain.BlockNumber(t), big.NewInt(2)))
+	chain.AdvanceBlocks(3)
+
+	ctx := context.Background()
+	if _, err := chain.ETH.ClaimChannelTimeout(ctx, opened.ChannelId, chain.TransactOpts(sender)); err != nil {
+		t.Fatalf("failed to claim channel timeout: %v", err)
+	}
+	if channel := getChannel(t, chain, opened.ChannelId); channel.Amount.Sign() != 0 {
+		t.Errorf("channel amount = %s after the claim, want 0", channel.Amount)
+	}
+
+	balance, err := chain.ETH.GetMPEBalance(sender.Address())
+	if err != nil {
+		t.Fatalf("failed to get MPE balance: %v", err)
+	}
+	if balance.Cmp(price) != 0 {
+		t.Fatalf("MPE balance = %s, want %s", balance, price)
+	}
+
+	if _, err := chain.ETH.WithdrawFromMPE(ctx, balance, chain.TransactOpts(sender)); err != nil {
+		t.Fatalf("failed to withdraw from MPE: %v", err)
+	}
+	tokenBalance, err := chain.ETH.Token.BalanceOf(nil, sender.Address())
+	if err != nil {
+		t.Fatalf("failed to get token balance: %v", err)
+	}
+	if tokenBalance.Cmp(tokens) != 0 {
+		t.Errorf("token balance = %s, want %s", tokenBalance, tokens)
+	}
+}
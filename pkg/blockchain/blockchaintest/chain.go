@@ -0,0 +1,299 @@
+// Package blockchaintest runs the SingularityNET contracts on go-ethereum's simulated backend,
+// so that code paths sending payment channel transactions can be tested offline.
+package blockchaintest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+	contracts "github.com/singnet/snet-ecosystem-contracts"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/util"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
+)
+
+const (
+	// BlockInterval is how often a block is sealed in the background while a chain is running.
+	BlockInterval = 100 * time.Millisecond
+	// txTimeout limits how long the harness waits for its own transactions to be mined.
+	txTimeout = 10 * time.Second
+	// tokenBalancesSlot is the storage slot of the balances mapping of the FetchToken contract.
+	tokenBalancesSlot = 1
+	// tokenTotalSupplySlot is the storage slot of the total supply of the FetchToken contract.
+	tokenTotalSupplySlot = 3
+)
+
+var (
+	// TokenAddress is the address the FetchToken contract is placed at.
+	TokenAddress = common.HexToAddress("0x00000000000000000000000000000000000fe7c4")
+	// InitialSupply is the amount of tokens held by the deployer, in cogs.
+	InitialSupply = new(big.Int).Exp(big.NewInt(10), big.NewInt(27), nil)
+	// AccountEther is the amount of ether given to each account for gas, in wei.
+	AccountEther = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+)
+
+// Chain is a simulated chain with the FetchToken, MultiPartyEscrow and Registry contracts deployed.
+// The contracts package ships the FetchToken contract as runtime bytecode only, so it is placed at TokenAddress
+// in the genesis state with the initial supply credited to the deployer; the other contracts are deployed
+// through their generated bindings.
+// Blocks are sealed every BlockInterval, so code waiting for receipts or contract events makes progress.
+type Chain struct {
+	Backend  *simulated.Backend  // The simulated backend.
+	ETH      blockchain.Ethereum // The contracts bound through the client of the backend.
+	Deployer signer.Signer       // The account that deployed the contracts and holds the token supply.
+	ChainID  *big.Int            // The ID of the simulated chain.
+
+	commitMu sync.Mutex // A mutex to ensure blocks are sealed one at a time.
+}
+
+// New starts a simulated chain and deploys the MPE and Registry contracts from a freshly generated deployer account.
+// config.Blockchain.ChainID is set to the ID of the simulated chain until the test finishes.
+// The chain is closed when the test finishes.
+//
+// Parameters:
+//   - tb: The test the chain is used by.
+//
+// Returns:
+//   - *Chain: The running chain.
+func New(tb testing.TB) *Chain {
+	tb.Helper()
+
+	deployerKey := newKey(tb)
+	deployer := signer.NewLocal(deployerKey)
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		deployer.Address(): {Balance: new(big.Int).Mul(AccountEther, big.NewInt(1000))},
+		TokenAddress: {
+			Code: common.FromHex(string(contracts.GetBytecodeClean(contracts.FetchToken))),
+			Storage: map[common.Hash]common.Hash{
+				mappingSlot(deployer.Address(), tokenBalancesSlot): common.BigToHash(InitialSupply),
+				common.BigToHash(big.NewInt(tokenTotalSupplySlot)): common.BigToHash(InitialSupply),
+			},
+			Balance: new(big.Int),
+		},
+	})
+	c := &Chain{
+		Backend:  backend,
+		Deployer: deployer,
+	}
+
+	client := backend.Client()
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		_ = backend.Close()
+		tb.Fatalf("failed to get chain ID: %v", err)
+	}
+	c.ChainID = chainID
+
+	chainIDConfig := config.Blockchain.ChainID
+	config.Blockchain.ChainID = strconv.FormatInt(chainID.Int64(), 10)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	tb.Cleanup(func() {
+		close(stop)
+		<-done
+		_ = backend.Close()
+		config.Blockchain.ChainID = chainIDConfig
+	})
+	go c.sealBlocks(stop, done)
+
+	auth := c.TransactOpts(deployer)
+	mpeAddress, tx, _, err := blockchain.DeployMultiPartyEscrow(auth, client, TokenAddress)
+	if err != nil {
+		tb.Fatalf("failed to deploy MPE: %v", err)
+	}
+	c.MustMine(tb, tx)
+
+	registryAddress, tx, _, err := blockchain.DeployRegistry(auth, client)
+	if err != nil {
+		tb.Fatalf("failed to deploy registry: %v", err)
+	}
+	c.MustMine(tb, tx)
+
+	c.ETH, err = blockchain.New(client, client, registryAddress, mpeAddress)
+	if err != nil {
+		tb.Fatalf("failed to bind contracts: %v", err)
+	}
+	return c
+}
+
+// Commit seals the pending transactions into a new block.
+func (c *Chain) Commit() {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	c.Backend.Commit()
+}
+
+// AdvanceBlocks seals n blocks, e.g. to let a payment channel expire.
+func (c *Chain) AdvanceBlocks(n int) {
+	for range n {
+		c.Commit()
+	}
+}
+
+// BlockNumber returns the number of the latest block.
+func (c *Chain) BlockNumber(tb testing.TB) *big.Int {
+	tb.Helper()
+
+	number, err := c.ETH.Client.BlockNumber(context.Background())
+	if err != nil {
+		tb.Fatalf("failed to get block number: %v", err)
+	}
+	return new(big.Int).SetUint64(number)
+}
+
+// NewAccount creates an account holding AccountEther for gas and the given amount of tokens.
+//
+// Parameters:
+//   - tb: The test the account is used by.
+//   - tokens: The amount of tokens transferred from the deployer, in cogs; nil or zero transfers none.
+//
+// Returns:
+//   - signer.Signer: The signer of the new account.
+func (c *Chain) NewAccount(tb testing.TB, tokens *big.Int) signer.Signer {
+	tb.Helper()
+
+	account := signer.NewLocal(newKey(tb))
+	c.SendEther(tb, account.Address(), AccountEther)
+	if tokens != nil && tokens.Sign() > 0 {
+		c.TransferTokens(tb, account.Address(), tokens)
+	}
+	return account
+}
+
+// SendEther sends ether from the deployer and waits for the transfer to be mined.
+func (c *Chain) SendEther(tb testing.TB, to common.Address, amount *big.Int) {
+	tb.Helper()
+
+	ctx := context.Background()
+	client := c.Backend.Client()
+
+	nonce, err := client.PendingNonceAt(ctx, c.Deployer.Address())
+	if err != nil {
+		tb.Fatalf("failed to get nonce: %v", err)
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		tb.Fatalf("failed to get head: %v", err)
+	}
+	tip := big.NewInt(params.GWei)
+	tx, err := c.Deployer.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   c.ChainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2))),
+		Gas:       params.TxGas,
+		To:        &to,
+		Value:     amount,
+	}), c.ChainID)
+	if err != nil {
+		tb.Fatalf("failed to sign ether transfer: %v", err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		tb.Fatalf("failed to send ether: %v", err)
+	}
+	c.MustMine(tb, tx)
+}
+
+// TransferTokens transfers tokens from the deployer and waits for the transfer to be mined.
+func (c *Chain) TransferTokens(tb testing.TB, to common.Address, amount *big.Int) {
+	tb.Helper()
+
+	tx, err := c.ETH.Token.Transfer(c.TransactOpts(c.Deployer), to, amount)
+	if err != nil {
+		tb.Fatalf("failed to transfer tokens: %v", err)
+	}
+	c.MustMine(tb, tx)
+}
+
+// TransactOpts creates transaction options signing for the account on the simulated chain.
+func (c *Chain) TransactOpts(s signer.Signer) *bind.TransactOpts {
+	return signer.TransactOpts(s, c.ChainID)
+}
+
+// BindOpts creates the options the payment channel methods of blockchain.Ethereum expect for the account.
+// Watching starts at the latest block, so events of transactions sent afterwards are not missed.
+func (c *Chain) BindOpts(tb testing.TB, s signer.Signer) *blockchain.BindOpts {
+	tb.Helper()
+
+	currentBlock := c.BlockNumber(tb)
+	return &blockchain.BindOpts{
+		Call:     util.GetCallOpts(s.Address(), currentBlock),
+		Transact: c.TransactOpts(s),
+		Watch:    util.GetWatchOpts(currentBlock),
+		Filter:   util.GetFilterOpts(currentBlock),
+	}
+}
+
+// NewChansToWatch creates the channels the payment channel methods of blockchain.Ethereum report events to.
+func NewChansToWatch() *blockchain.ChansToWatch {
+	return &blockchain.ChansToWatch{
+		ChannelOpens:    make(chan *blockchain.MultiPartyEscrowChannelOpen),
+		ChannelExtends:  make(chan *blockchain.MultiPartyEscrowChannelExtend),
+		ChannelAddFunds: make(chan *blockchain.MultiPartyEscrowChannelAddFunds),
+		DepositFunds:    make(chan *blockchain.MultiPartyEscrowDepositFunds),
+		Err:             make(chan error),
+	}
+}
+
+// sealBlocks seals a block every BlockInterval until stop is closed.
+func (c *Chain) sealBlocks(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(BlockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.Commit()
+		}
+	}
+}
+
+// MustMine seals the transaction into a block and fails the test unless it succeeded.
+func (c *Chain) MustMine(tb testing.TB, tx *types.Transaction) {
+	tb.Helper()
+
+	c.Commit()
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+
+	receipt, err := bind.WaitMined(ctx, c.Backend.Client(), tx)
+	if err != nil {
+		tb.Fatalf("failed to wait for transaction %s: %v", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		tb.Fatalf("transaction %s failed", tx.Hash().Hex())
+	}
+}
+
+// mappingSlot returns the storage slot of the value for an address key in a mapping stored at the slot.
+func mappingSlot(key common.Address, slot int64) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key.Bytes(), 32), common.BigToHash(big.NewInt(slot)).Bytes())
+}
+
+// newKey generates a private key for a test account.
+func newKey(tb testing.TB) *ecdsa.PrivateKey {
+	tb.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		tb.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
@@ -63,12 +63,13 @@ func (o OrganizationMetaData) DB() (db.SnetOrganization, []db.SnetOrgGroup) {
 }
 
 // DB converts ServiceMetadata to db.SnetService.
+// The service row describes the first group with endpoints and pricing; all groups are returned by Groups.
 //
 // Returns:
 //   - db.SnetService: The database representation of the service.
 func (s ServiceMetadata) DB() (db.SnetService, error) {
-	if len(s.Groups) > 0 {
-		if len(s.Groups[0].Endpoints) > 0 && len(s.Groups[0].Endpoints[0]) > 0 && len(s.Groups[0].Pricing) > 0 {
+	for _, group := range s.Groups {
+		if len(group.Endpoints) > 0 && len(group.Endpoints[0]) > 0 && len(group.Pricing) > 0 {
 			return db.SnetService{
 				ID:                    s.ID,
 				SnetID:                s.SnetID,
@@ -81,19 +82,96 @@ func (s ServiceMetadata) DB() (db.SnetService, error) {
 				ModelIpfsHash:         s.ModelIpfsHash,
 				ServiceApiSource:      s.ServiceApiSource,
 				MPEAddress:            s.MpeAddress,
-				URL:                   s.Groups[0].Endpoints[0],
-				Price:                 s.Groups[0].Pricing[0].PriceInCogs,
-				GroupID:               s.Groups[0].GroupID,
-				FreeCalls:             s.Groups[0].FreeCalls,
-				FreeCallSignerAddress: s.Groups[0].FreeCallSignerAddress,
+				URL:                   group.Endpoints[0],
+				Endpoints:             group.Endpoints,
+				Price:                 defaultPrice(group.Pricing),
+				GroupID:               group.GroupID,
+				FreeCalls:             group.FreeCalls,
+				FreeCallSignerAddress: group.FreeCallSignerAddress,
 				Description:           s.ServiceDescription.Description,
 				ShortDescription:      s.ServiceDescription.ShortDescription,
+				Tags:                  s.Tags,
 			}, nil
 		}
 	}
 	return db.SnetService{}, errors.New("no service payment group found")
 }
 
+// ServiceGroups converts every payment group of the service with endpoints and pricing to its database representation.
+//
+// Returns:
+//   - []db.SnetServiceGroup: The service groups in metadata order.
+func (s ServiceMetadata) ServiceGroups() []db.SnetServiceGroup {
+	var groups []db.SnetServiceGroup
+	for _, group := range s.Groups {
+		if len(group.Endpoints) == 0 || len(group.Pricing) == 0 {
+			continue
+		}
+		groups = append(groups, db.SnetServiceGroup{
+			ServiceID:             s.ID,
+			GroupID:               group.GroupID,
+			GroupName:             group.GroupName,
+			Endpoints:             group.Endpoints,
+			Price:                 defaultPrice(group.Pricing),
+			FreeCalls:             group.FreeCalls,
+			FreeCallSignerAddress: group.FreeCallSignerAddress,
+		})
+	}
+	return groups
+}
+
+// Prices converts the pricing of every payment group to the rows of the service pricing table.
+//
+// Returns:
+//   - []db.SnetServicePrice: One row per fixed price and one row per method of per-method pricing.
+func (s ServiceMetadata) Prices() []db.SnetServicePrice {
+	var prices []db.SnetServicePrice
+	for _, group := range s.Groups {
+		for _, pricing := range group.Pricing {
+			if pricing.PriceModel != PriceModelPerMethod {
+				prices = append(prices, db.SnetServicePrice{
+					GroupID:     group.GroupID,
+					PriceModel:  pricing.PriceModel,
+					Default:     pricing.Default,
+					PriceInCogs: pricing.PriceInCogs,
+				})
+				continue
+			}
+			for _, details := range pricing.Details {
+				for _, method := range details.MethodPricing {
+					prices = append(prices, db.SnetServicePrice{
+						GroupID:     group.GroupID,
+						PriceModel:  pricing.PriceModel,
+						Default:     pricing.Default,
+						PackageName: pricing.PackageName,
+						ServiceName: details.ServiceName,
+						MethodName:  method.MethodName,
+						PriceInCogs: method.PriceInCogs,
+					})
+				}
+			}
+		}
+	}
+	return prices
+}
+
+// defaultPrice returns the fixed price marked as default, falling back to the first fixed price.
+func defaultPrice(pricing []Pricing) int {
+	price := -1
+	for _, p := range pricing {
+		if p.PriceModel == PriceModelPerMethod {
+			continue
+		}
+		if p.Default {
+			return p.PriceInCogs
+		}
+		if price < 0 {
+			price = p.PriceInCogs
+		}
+	}
+	return max(price, 0)
+}
+
 // Group represents a group within an organization in the blockchain.
 type Group struct {
 	GroupName        string   `json:"group_name"`               // Name of the group.
@@ -117,6 +195,27 @@ type PaymentChannelStorageClient struct {
 	Endpoints         []string `json:"endpoints"`                                            // List of endpoints.
 }
 
+// Pricing models a service can declare in its metadata.
+const (
+	PriceModelFixed     = "fixed_price"            // One price for every method.
+	PriceModelPerMethod = "fixed_price_per_method" // A price per gRPC method.
+)
+
+// Pricing represents one pricing entry of a service payment group.
+type Pricing struct {
+	Default     bool   `json:"default"`       // Indicates if this is the default pricing.
+	PriceModel  string `json:"price_model"`   // Pricing model.
+	PriceInCogs int    `json:"price_in_cogs"` // Price in cogs, used by the fixed price model.
+	PackageName string `json:"package_name"`  // Protobuf package of the priced methods, used by the per-method model.
+	Details     []struct {
+		ServiceName   string `json:"service_name"` // gRPC service of the priced methods.
+		MethodPricing []struct {
+			MethodName  string `json:"method_name"`   // gRPC method name.
+			PriceInCogs int    `json:"price_in_cogs"` // Price of the method in cogs.
+		} `json:"method_pricing"` // Prices of the methods of the service.
+	} `json:"details"` // Per-method prices grouped by gRPC service.
+}
+
 // ServiceMetadata represents metadata for a service in the blockchain.
 type ServiceMetadata struct {
 	ID               int    `json:"id"`                 // Internal ID.
@@ -131,17 +230,13 @@ type ServiceMetadata struct {
 	ServiceApiSource string `json:"service_api_source"` // Service API source (new field for newer services).
 	MpeAddress       string `json:"mpe_address"`        // MPE address of the service.
 	Groups           []struct {
-		FreeCalls             int      `json:"free_calls"`               // Number of free calls.
-		FreeCallSignerAddress string   `json:"free_call_signer_address"` // Address of the free call signer.
-		DaemonAddresses       []string `json:"daemon_addresses"`         // Daemon addresses.
-		Pricing               []struct {
-			Default     bool   `json:"default"`       // Indicates if this is the default pricing.
-			PriceModel  string `json:"price_model"`   // Pricing model.
-			PriceInCogs int    `json:"price_in_cogs"` // Price in cogs.
-		} `json:"pricing"` // Pricing details.
-		Endpoints []string `json:"endpoints"`  // Endpoints for the group.
-		GroupID   string   `json:"group_id"`   // ID of the group.
-		GroupName string   `json:"group_name"` // Name of the group.
+		FreeCalls             int       `json:"free_calls"`               // Number of free calls.
+		FreeCallSignerAddress string    `json:"free_call_signer_address"` // Address of the free call signer.
+		DaemonAddresses       []string  `json:"daemon_addresses"`         // Daemon addresses.
+		Pricing               []Pricing `json:"pricing"`                  // Pricing details.
+		Endpoints             []string  `json:"endpoints"`                // Endpoints for the group.
+		GroupID               string    `json:"group_id"`                 // ID of the group.
+		GroupName             string    `json:"group_name"`               // Name of the group.
 	} `json:"groups"` // List of groups.
 	ServiceDescription struct {
 		URL              string `json:"url"`               // URL of the service.
@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Names of the registry events that change organizations and services.
+const (
+	OrganizationCreatedEvent     = "OrganizationCreated"
+	OrganizationModifiedEvent    = "OrganizationModified"
+	ServiceCreatedEvent          = "ServiceCreated"
+	ServiceMetadataModifiedEvent = "ServiceMetadataModified"
+	ServiceDeletedEvent          = "ServiceDeleted"
+)
+
+// registryEventNames lists the registry events returned by RegistryEvents.
+var registryEventNames = []string{
+	OrganizationCreatedEvent,
+	OrganizationModifiedEvent,
+	ServiceCreatedEvent,
+	ServiceMetadataModifiedEvent,
+	ServiceDeletedEvent,
+}
+
+// RegistryEvent is a change of an organization or a service recorded by the registry contract.
+type RegistryEvent struct {
+	Name        string   // The name of the event, e.g., ServiceCreated.
+	OrgID       [32]byte // The ID of the organization.
+	ServiceID   [32]byte // The ID of the service, zero for organization events.
+	BlockNumber uint64   // The block the event was emitted in.
+}
+
+// IsServiceEvent reports whether the event changes a service rather than its organization.
+func (e RegistryEvent) IsServiceEvent() bool {
+	return e.ServiceID != [32]byte{}
+}
+
+// RegistryEvents returns the organization and service events emitted by the registry contract in a block range, in chain order.
+//
+// Parameters:
+//   - ctx: The context of the log query.
+//   - fromBlock: The first block of the range.
+//   - toBlock: The last block of the range, inclusive.
+//
+// Returns:
+//   - []RegistryEvent: The events of the range.
+//   - error: An error if the logs cannot be queried or parsed.
+func (eth Ethereum) RegistryEvents(ctx context.Context, fromBlock, toBlock uint64) ([]RegistryEvent, error) {
+	registryABI, err := RegistryMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry ABI: %w", err)
+	}
+	eventIDs := make([]common.Hash, 0, len(registryEventNames))
+	eventNames := make(map[common.Hash]string, len(registryEventNames))
+	for _, name := range registryEventNames {
+		id := registryABI.Events[name].ID
+		eventIDs = append(eventIDs, id)
+		eventNames[id] = name
+	}
+
+	logs, err := eth.Client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: []common.Address{eth.RegistryAddress},
+		Topics:    [][]common.Hash{eventIDs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter registry events: %w", err)
+	}
+
+	events := make([]RegistryEvent, 0, len(logs))
+	for _, entry := range logs {
+		if entry.Removed || len(entry.Topics) == 0 {
+			continue
+		}
+		event := RegistryEvent{
+			Name:        eventNames[entry.Topics[0]],
+			BlockNumber: entry.BlockNumber,
+		}
+		switch event.Name {
+		case OrganizationCreatedEvent:
+			var created *RegistryOrganizationCreated
+			if created, err = eth.Registry.ParseOrganizationCreated(entry); err == nil {
+				event.OrgID = created.OrgId
+			}
+		case OrganizationModifiedEvent:
+			var modified *RegistryOrganizationModified
+			if modified, err = eth.Registry.ParseOrganizationModified(entry); err == nil {
+				event.OrgID = modified.OrgId
+			}
+		case ServiceCreatedEvent:
+			var created *RegistryServiceCreated
+			if created, err = eth.Registry.ParseServiceCreated(entry); err == nil {
+				event.OrgID, event.ServiceID = created.OrgId, created.ServiceId
+			}
+		case ServiceMetadataModifiedEvent:
+			var modified *RegistryServiceMetadataModified
+			if modified, err = eth.Registry.ParseServiceMetadataModified(entry); err == nil {
+				event.OrgID, event.ServiceID = modified.OrgId, modified.ServiceId
+			}
+		case ServiceDeletedEvent:
+			var deleted *RegistryServiceDeleted
+			if deleted, err = eth.Registry.ParseServiceDeleted(entry); err == nil {
+				event.OrgID, event.ServiceID = deleted.OrgId, deleted.ServiceId
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s event: %w", event.Name, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,61 @@
+package blockchain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/blockchain/blockchaintest"
+)
+
+// TestRegistryEvents tests that organization and service changes are returned in chain order with their IDs.
+//
+// Parameters:
+//   - t: The testing framework instance.
+func TestRegistryEvents(t *testing.T) {
+	chain := blockchaintest.New(t)
+	owner := chain.NewAccount(t, nil)
+	fromBlock := chain.BlockNumber(t).Uint64()
+
+	orgID := [32]byte{'o', 'r', 'g'}
+	serviceID := [32]byte{'s', 'e', 'r', 'v', 'i', 'c', 'e'}
+	send := func(tx *types.Transaction, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("failed to send registry transaction: %v", err)
+		}
+		chain.MustMine(t, tx)
+	}
+
+	registry := chain.ETH.Registry
+	send(registry.CreateOrganization(chain.TransactOpts(owner), orgID, []byte("ipfs://org"), nil))
+	send(registry.CreateServiceRegistration(chain.TransactOpts(owner), orgID, serviceID, []byte("ipfs://service")))
+	send(registry.UpdateServiceRegistration(chain.TransactOpts(owner), orgID, serviceID, []byte("ipfs://service-v2")))
+	send(registry.ChangeOrganizationMetadataURI(chain.TransactOpts(owner), orgID, []byte("ipfs://org-v2")))
+	send(registry.DeleteServiceRegistration(chain.TransactOpts(owner), orgID, serviceID))
+
+	events, err := chain.ETH.RegistryEvents(context.Background(), fromBlock, chain.BlockNumber(t).Uint64())
+	if err != nil {
+		t.Fatalf("failed to get registry events: %v", err)
+	}
+
+	want := []blockchain.RegistryEvent{
+		{Name: blockchain.OrganizationCreatedEvent, OrgID: orgID},
+		{Name: blockchain.ServiceCreatedEvent, OrgID: orgID, ServiceID: serviceID},
+		{Name: blockchain.ServiceMetadataModifiedEvent, OrgID: orgID, ServiceID: serviceID},
+		{Name: blockchain.OrganizationModifiedEvent, OrgID: orgID},
+		{Name: blockchain.ServiceDeletedEvent, OrgID: orgID, ServiceID: serviceID},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		if event.Name != want[i].Name || event.OrgID != want[i].OrgID || event.ServiceID != want[i].ServiceID {
+			t.Errorf("event %d = %s %q/%q, want %s %q/%q", i, event.Name, event.OrgID, event.ServiceID, want[i].Name, want[i].OrgID, want[i].ServiceID)
+		}
+		if i > 0 && event.BlockNumber <= events[i-1].BlockNumber {
+			t.Errorf("event %d is in block %d, not after block %d", i, event.BlockNumber, events[i-1].BlockNumber)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+)
+
+// approveTimeout limits how long EnsureAllowance waits for the approve transaction to be mined.
+const approveTimeout = 2 * time.Minute
+
+// TokenShortfallError reports that an account holds fewer tokens than a deposit to the MPE contract requires.
+type TokenShortfallError struct {
+	Address  common.Address // The account paying for the deposit.
+	Balance  *big.Int       // The token balance of the account in cogs.
+	Required *big.Int       // The amount of the deposit in cogs.
+}
+
+// Error implements the error interface.
+func (e *TokenShortfallError) Error() string {
+	return fmt.Sprintf("account %s holds %s cogs, but %s cogs are required", e.Address.Hex(), e.Balance, e.Required)
+}
+
+// Missing returns the amount of cogs the account has to receive before the deposit can be made.
+func (e *TokenShortfallError) Missing() *big.Int {
+	return new(big.Int).Sub(e.Required, e.Balance)
+}
+
+// EnsureAllowance makes sure the MPE contract may transfer the given amount of tokens from the owner.
+// If the allowance is too low, it approves the amount multiplied by the configured headroom and waits for the receipt.
+//
+// Parameters:
+//   - owner: The account depositing to the MPE contract.
+//   - amount: The amount of the deposit in cogs.
+//   - opts: Binding options; Call is used for reading, Transact for the approve transaction.
+//
+// Returns:
+//   - error: A *TokenShortfallError if the owner holds fewer tokens than the amount, or an error if the operation fails.
+func (eth Ethereum) EnsureAllowance(owner common.Address, amount *big.Int, opts *BindOpts) error {
+	if eth.Token == nil {
+		return errors.New("token contract is not initialized")
+	}
+
+	logger := log.With().
+		Str("owner", owner.Hex()).
+		Str("amount", amount.String()).
+		Logger()
+
+	balance, err := eth.Token.BalanceOf(opts.Call, owner)
+	if err != nil {
+		return fmt.Errorf("failed to get token balance: %w", err)
+	}
+	if balance.Cmp(amount) < 0 {
+		logger.Warn().
+			Str("balance", balance.String()).
+			Msg("token balance is too low for the deposit")
+		return &TokenShortfallError{Address: owner, Balance: balance, Required: amount}
+	}
+
+	allowance, err := eth.Token.Allowance(opts.Call, owner, eth.MPEAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get token allowance: %w", err)
+	}
+	if allowance.Cmp(amount) >= 0 {
+		logger.Debug().
+			Str("allowance", allowance.String()).
+			Msg("token allowance is sufficient")
+		return nil
+	}
+
+	approved := new(big.Int).Mul(amount, new(big.Int).SetUint64(max(config.Blockchain.ApproveHeadroom, 1)))
+	if approved.Cmp(balance) > 0 {
+		approved = balance
+	}
+
+	tx, err := eth.Token.Approve(opts.Transact, eth.MPEAddress, approved)
+	if err != nil {
+		return fmt.Errorf("failed to approve tokens: %w", err)
+	}
+
+	logger.Info().
+		Str("tx_hash", tx.Hash().Hex()).
+		Str("allowance", allowance.String()).
+		Str("approved", approved.String()).
+		Msg("token approve transaction sent")
+
+	ctx, cancel := context.WithTimeout(context.Background(), approveTimeout)
+	defer cancel()
+
+	if _, err := eth.waitMined(ctx, tx); err != nil {
+		return fmt.Errorf("failed to approve tokens: %w", err)
+	}
+
+	logger.Info().Msg("tokens approved to MPE successfully")
+	return nil
+}
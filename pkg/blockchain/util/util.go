@@ -2,7 +2,6 @@ package util
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/base64"
 	"fmt"
 	"math/big"
@@ -18,6 +17,7 @@ import (
 	"github.com/shopspring/decimal"
 	"github.com/tensved/snet-matrix-framework/internal/config"
 	"github.com/tensved/snet-matrix-framework/pkg/blockchain"
+	"github.com/tensved/snet-matrix-framework/pkg/signer"
 )
 
 // Deprecated: EstimateGas returns a new bind.TransactOpts instance with zero gas limit
@@ -38,26 +38,22 @@ func EstimateGas(wallet *bind.TransactOpts) *bind.TransactOpts {
 	}
 }
 
-// GetSignature generates a cryptographic signature for the provided message using the given ECDSA private key.
+// GetSignature generates a cryptographic signature for the provided message using the given signer.
+// The Keccak-256 hash of the message is signed as an Ethereum signed message, as the daemon expects.
 //
 // Parameters:
 //   - message: A byte slice containing the message to be signed.
-//   - privateKeyECDSA: A pointer to an ecdsa.PrivateKey used to sign the message.
+//   - s: The signer of the paying account.
 //
 // Returns:
 //   - signature: A byte slice containing the generated signature.
-func GetSignature(message []byte, privateKeyECDSA *ecdsa.PrivateKey) []byte {
-	hash := crypto.Keccak256(
-		blockchain.HashPrefix32Bytes,
-		crypto.Keccak256(message),
-	)
-
-	signature, err := crypto.Sign(hash, privateKeyECDSA)
+//   - err: An error if signing fails.
+func GetSignature(message []byte, s signer.Signer) (signature []byte, err error) {
+	signature, err = s.SignText(crypto.Keccak256(message))
 	if err != nil {
-		panic(fmt.Sprintf("cannot sign message: %v", err))
+		return nil, fmt.Errorf("cannot sign message: %w", err)
 	}
-
-	return signature
+	return signature, nil
 }
 
 // BigIntToBytes converts a big.Int value to a byte slice.
@@ -182,13 +178,9 @@ func GetFilterOpts(lastBlockNumber *big.Int) *bind.FilterOpts {
 	}
 }
 
-func GetTransactOpts(privateKeyECDSA *ecdsa.PrivateKey) *bind.TransactOpts {
+func GetTransactOpts(s signer.Signer) *bind.TransactOpts {
 	chainID, _ := strconv.Atoi(config.Blockchain.ChainID)
-	opts, err := bind.NewKeyedTransactorWithChainID(privateKeyECDSA, big.NewInt(int64(chainID)))
-	if err != nil {
-		log.Error().Err(err).Msg("failed to create transactor")
-	}
-	return opts
+	return signer.TransactOpts(s, big.NewInt(int64(chainID)))
 }
 
 func GetNewExpiration(lastBlockNumber, paymentExpirationThreshold *big.Int) *big.Int {
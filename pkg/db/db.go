@@ -1,26 +1,75 @@
 package db
 
 import (
+	"errors"
 	"math/big"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrTxHashConsumed is returned when a payment state is marked paid with a transaction that already paid another one.
+var ErrTxHashConsumed = errors.New("transaction already paid another payment")
+
 // Service defines the interface for database operations related to Snet organizations, services, and payment states.
 type Service interface {
-	GetSnetOrgs() ([]SnetOrganization, error)                                // Retrieves a list of Snet organizations.
-	GetSnetServices() ([]SnetService, error)                                 // Retrieves a list of Snet services.
-	GetSnetService(snetID string) (s *SnetService, err error)                // Retrieves a specific Snet service by its Id.
-	CreateSnetService(service SnetService) (id int, err error)               // Creates a new Snet service.
-	CreateSnetOrg(organization SnetOrganization) (id int, err error)         // Creates a new Snet organization.
-	CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err error)        // Creates multiple Snet organization groups.
-	GetSnetOrgGroup(groupID string) (SnetOrgGroup, error)                    // Retrieves a specific Snet organization group by its Id.
-	CreatePaymentState(paymentState *PaymentState) (id uuid.UUID, err error) // Creates a new payment state.
-	GetPaymentState(id uuid.UUID) (ps *PaymentState, err error)              // Retrieves a specific payment state by its UUID.
-	GetPaymentStateByKey(key string) (ps *PaymentState, err error)           // Retrieves a payment state by its key.
-	PatchUpdatePaymentState(ps *PaymentState) (err error)                    // Updates specific fields of a payment state.
-	Health() map[string]string                                               // Checks the health of the database connection.
+	GetSnetOrgs(includeDeleted bool) ([]SnetOrganization, error)                         // Retrieves a list of Snet organizations, those deleted only if asked for.
+	GetSnetServices(includeDeleted bool) ([]SnetService, error)                          // Retrieves a list of Snet services, those deleted only if asked for.
+	GetSnetService(snetID string) (s *SnetService, err error)                            // Retrieves a specific Snet service by its Id.
+	CreateSnetService(service SnetService) (id int, err error)                           // Creates a new Snet service.
+	DeleteSnetService(snetOrgID, snetID string) (err error)                              // Marks a Snet service as deleted.
+	DeleteSnetOrgsExcept(snetIDs []string) (deleted []string, err error)                 // Marks every Snet organization not listed as deleted.
+	DeleteSnetServicesExcept(snetIDs, snetOrgIDs []string) (deleted []string, err error) // Marks every Snet service not listed as deleted, except those of the listed organizations.
+	CreateSnetOrg(organization SnetOrganization) (id int, err error)                     // Creates a new Snet organization.
+	CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err error)                    // Creates multiple Snet organization groups.
+	GetSnetOrgGroup(groupID string) (SnetOrgGroup, error)                                // Retrieves a specific Snet organization group by its Id.
+	CreatePaymentState(paymentState *PaymentState) (id uuid.UUID, err error)             // Creates a new payment state.
+	GetPaymentState(id uuid.UUID) (ps *PaymentState, err error)                          // Retrieves a specific payment state by its UUID.
+	GetPaymentStateByKey(key string) (ps *PaymentState, err error)                       // Retrieves a payment state by its key.
+	PatchUpdatePaymentState(ps *PaymentState) (err error)                                // Updates specific fields of a payment state.
+	GetUserChannelSender(matrixUserID string) (string, error)                            // Retrieves the address a Matrix user funded payment channels from, empty if there is none.
+	SaveUserChannelSender(matrixUserID, sender string) (err error)                       // Stores the address a Matrix user funded a payment channel from.
+	Health() map[string]string                                                           // Checks the health of the database connection.
+
+	GetPaymentChannel(mpeAddress, sender, recipient, groupID string) (*PaymentChannel, error)                // Retrieves the latest active payment channel between a sender and a recipient group.
+	SavePaymentChannel(channel *PaymentChannel) (err error)                                                  // Creates or updates a payment channel.
+	UpdatePaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) (err error) // Updates the nonce and the last signed amount of a payment channel.
+	RevertPaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) (err error) // Lowers the last signed amount of a payment channel for the same nonce.
+	DeletePaymentChannel(mpeAddress string, channelID *big.Int) (err error)                                  // Marks a payment channel as deleted.
+	LockPaymentChannel(mpeAddress string, channelID *big.Int) (PaymentChannelLock, error)                    // Locks the row of a payment channel until the lock is released.
+
+	GetUserWallet(matrixUserID string) (*UserWallet, error) // Retrieves the wallet of a Matrix user.
+	SaveUserWallet(wallet *UserWallet) (err error)          // Creates or updates the wallet of a Matrix user.
+
+	CreateSpending(spending *Spending) (err error)                        // Records the amount spent on a service call.
+	GetSpentAmount(filter SpendingFilter, since time.Time) (int64, error) // Sums the amounts spent since a moment, narrowed by a filter.
+
+	CreateChannelAction(action *ChannelAction) (err error) // Records an action taken on a payment channel by the reclaim worker.
+
+	GetRoomSettings(roomID string) (*RoomSettings, error) // Retrieves the settings of a Matrix room.
+	SaveRoomSettings(settings *RoomSettings) (err error)  // Creates or updates the settings of a Matrix room.
+
+	GetSnetServicePrices(serviceID int) ([]SnetServicePrice, error)             // Retrieves the pricing table of a Snet service.
+	SaveSnetServicePrices(serviceID int, prices []SnetServicePrice) (err error) // Replaces the pricing table of a Snet service.
+
+	GetSnetServiceGroups(serviceID int) ([]SnetServiceGroup, error)             // Retrieves the payment groups of a Snet service.
+	SaveSnetServiceGroups(serviceID int, groups []SnetServiceGroup) (err error) // Replaces the payment groups of a Snet service.
+	GetPreferredGroup(matrixUserID, serviceID string) (string, error)           // Retrieves the payment group a Matrix user chose for a service.
+	SavePreferredGroup(matrixUserID, serviceID, groupName string) (err error)   // Stores the payment group a Matrix user chose for a service, an empty name clears the choice.
+
+	CreateServiceCall(call *ServiceCall) (err error)                 // Records a service call in the call ledger.
+	GetServiceCalls(filter ServiceCallFilter) ([]ServiceCall, error) // Retrieves the call ledger narrowed by a filter, oldest first.
+
+	GetSyncBlock(name string) (uint64, error)            // Retrieves the last block processed by a sync job, 0 if there is none.
+	SaveSyncBlock(name string, block uint64) (err error) // Stores the last block processed by a sync job.
+
+	GetServiceProtos(contentHash string) (*ServiceProtos, error)    // Retrieves proto sources and their compiled descriptors by the hash of the sources.
+	SaveServiceProtos(protos *ServiceProtos) (err error)            // Stores proto sources and their compiled descriptors unless they are stored already.
+	SetSnetServiceProtoHash(snetID, contentHash string) (err error) // Points a Snet service to the proto sources it is called with.
+
+	GetSetting(name string) (string, error)     // Retrieves a setting changed at runtime, empty if it was not changed.
+	SaveSetting(name, value string) (err error) // Stores a setting changed at runtime.
+	DeleteSetting(name string) (err error)      // Removes a setting changed at runtime, restoring its configured value.
 }
 
 // SnetOrganization represents an organization in the Snet system.
@@ -53,17 +102,48 @@ type SnetService struct {
 	ServiceApiSource      string     `db:"service_api_source"`       // The service API source (new field for newer services).
 	MPEAddress            string     `db:"mpe_address"`              // The MPE address of the service.
 	URL                   string     `db:"url"`                      // The URL of the service.
+	Endpoints             []string   `db:"endpoints"`                // Every daemon endpoint of the service group, the URL first.
 	Price                 int        `db:"price"`                    // The price of the service.
 	GroupID               string     `db:"group_id"`                 // The group ID associated with the service.
 	FreeCalls             int        `db:"free_calls"`               // The number of free calls allowed for the service.
 	FreeCallSignerAddress string     `db:"free_call_signer_address"` // The address of the free call signer.
 	ShortDescription      string     `db:"short_description"`        // The short description of the service.
 	Description           string     `db:"description"`              // The description of the service.
+	ProtoHash             string     `db:"proto_hash"`               // The content hash of the proto sources of the service, empty until they are synced.
+	Tags                  []string   `db:"tags"`                     // The tags of the service.
 	CreatedAt             time.Time  `db:"created_at"`               // The creation timestamp of the service.
 	UpdatedAt             time.Time  `db:"updated_at"`               // The last update timestamp of the service.
 	DeletedAt             *time.Time `db:"deleted_at"`               // The deletion timestamp of the service, can be null.
 }
 
+// SnetServicePrice represents one entry of the pricing table of a Snet service.
+// Fixed prices leave the method fields empty; per-method prices name the gRPC method they apply to.
+type SnetServicePrice struct {
+	ID          int    `db:"id"`            // The ID of the price.
+	ServiceID   int    `db:"service_id"`    // The ID of the service the price belongs to.
+	GroupID     string `db:"group_id"`      // The payment group the price applies to.
+	PriceModel  string `db:"price_model"`   // The pricing model, e.g., fixed_price or fixed_price_per_method.
+	Default     bool   `db:"is_default"`    // Indicates if this is the default pricing of the service.
+	PackageName string `db:"package_name"`  // The protobuf package of the method, empty for fixed prices.
+	ServiceName string `db:"service_name"`  // The gRPC service of the method, empty for fixed prices.
+	MethodName  string `db:"method_name"`   // The gRPC method the price applies to, empty for fixed prices.
+	PriceInCogs int    `db:"price_in_cogs"` // The price in cogs.
+}
+
+// SnetServiceGroup represents a payment group a Snet service is published in.
+// Each group has its own endpoints, prices and free calls and is paid through the payment address of its organization group.
+type SnetServiceGroup struct {
+	ID                    int      `db:"id"`                       // The ID of the service group.
+	ServiceID             int      `db:"service_id"`               // The ID of the service.
+	OrgGroupID            *int     `db:"org_group_id"`             // The ID of the organization group, can be null if the group is not synced yet.
+	GroupID               string   `db:"group_id"`                 // The base64-encoded payment group ID.
+	GroupName             string   `db:"group_name"`               // The name of the group.
+	Endpoints             []string `db:"endpoints"`                // The daemon endpoints of the group.
+	Price                 int      `db:"price"`                    // The default price of the group in cogs.
+	FreeCalls             int      `db:"free_calls"`               // The number of free calls allowed in the group.
+	FreeCallSignerAddress string   `db:"free_call_signer_address"` // The address of the free call signer of the group.
+}
+
 // SnetOrgGroup represents a group within an organization in the Snet system.
 type SnetOrgGroup struct {
 	ID                         int        `db:"id"`                           // The ID of the group.
@@ -87,7 +167,124 @@ type PaymentState struct {
 	ToAddress    string    `json:"toAddress" db:"to_address"`       // The recipient address for the payment.
 	Amount       int       `json:"amount" db:"amount"`              // The amount for the payment.
 	Status       string    `json:"status" db:"status"`              // The status of the payment, e.g., pending, expired, or paid.
+	Signer       string    `json:"signer" db:"signer"`              // The address allowed to sign claims for the channel.
+	Recipient    string    `json:"recipient" db:"recipient"`        // The payment address of the service group.
+	GroupID      string    `json:"groupId" db:"group_id"`           // The base64-encoded payment group ID.
+	Expiration   int64     `json:"expiration" db:"expiration"`      // The block number the channel has to stay open until.
+	ChannelID    *string   `json:"channelId" db:"channel_id"`       // The ID of the channel to add funds to, null to open a new channel.
+	Sender       *string   `json:"sender" db:"sender"`              // The address expected to fund the channel, null if the user has not funded one before.
 	CreatedAt    time.Time `json:"createdAt" db:"created_at"`       // The creation timestamp of the payment state.
 	UpdatedAt    time.Time `json:"updatedAt" db:"updated_at"`       // The last update timestamp of the payment state.
 	ExpiresAt    time.Time `json:"expiresAt" db:"expires_at"`       // The expiration timestamp of the payment state.
 }
+
+// PaymentChannel represents an MPE payment channel used by the framework to pay for service calls.
+type PaymentChannel struct {
+	ID           int        `json:"id" db:"id"`                      // The ID of the payment channel record.
+	ChannelID    *big.Int   `json:"channelId" db:"channel_id"`       // The ID of the channel in the MPE contract.
+	MPEAddress   string     `json:"mpeAddress" db:"mpe_address"`     // The address of the MPE contract holding the channel.
+	Sender       string     `json:"sender" db:"sender"`              // The address that opened and funds the channel.
+	Recipient    string     `json:"recipient" db:"recipient"`        // The payment address of the service group.
+	GroupID      string     `json:"groupId" db:"group_id"`           // The base64-encoded payment group ID.
+	Amount       *big.Int   `json:"amount" db:"amount"`              // The value locked in the channel, in cogs.
+	Expiration   *big.Int   `json:"expiration" db:"expiration"`      // The block number after which the sender can reclaim the funds.
+	Nonce        *big.Int   `json:"nonce" db:"nonce"`                // The current nonce of the channel.
+	SignedAmount *big.Int   `json:"signedAmount" db:"signed_amount"` // The last amount signed by the sender for the current nonce.
+	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`       // The creation timestamp of the record.
+	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`       // The last update timestamp of the record.
+	DeletedAt    *time.Time `json:"deletedAt" db:"deleted_at"`       // The deletion timestamp of the record, set once the channel is claimed or reclaimed.
+}
+
+// PaymentChannelLock holds the row lock of a payment channel, so that processes sharing the database
+// sign increasing amounts for it one after another.
+type PaymentChannelLock interface {
+	Channel() *PaymentChannel                                // Returns the locked payment channel, nil if the channel is not stored.
+	Release(nonce, signedAmount *big.Int, commit bool) error // Stores the signed amount if commit is true and releases the lock.
+}
+
+// UserWallet represents the wallet a Matrix user pays for service calls with.
+type UserWallet struct {
+	ID                  int       `json:"id" db:"id"`                        // The ID of the wallet.
+	MatrixUserID        string    `json:"matrixUserId" db:"matrix_user_id"`  // The Matrix ID of the wallet owner.
+	Address             string    `json:"address" db:"address"`              // The address of the signing key.
+	EncryptedPrivateKey []byte    `json:"-" db:"encrypted_private_key"`      // The signing key encrypted with the wallet encryption key.
+	LinkedAddress       *string   `json:"linkedAddress" db:"linked_address"` // An external address owned by the user, can be null.
+	CreatedAt           time.Time `json:"createdAt" db:"created_at"`         // The creation timestamp of the wallet.
+	UpdatedAt           time.Time `json:"updatedAt" db:"updated_at"`         // The last update timestamp of the wallet.
+}
+
+// Spending represents the amount spent on one paid service call.
+type Spending struct {
+	ID           int       `json:"id" db:"id"`                       // The ID of the spending.
+	MatrixUserID string    `json:"matrixUserId" db:"matrix_user_id"` // The Matrix ID of the user who made the call.
+	RoomID       string    `json:"roomId" db:"room_id"`              // The Matrix room the call was made in.
+	ServiceID    string    `json:"serviceId" db:"service_id"`        // The Snet ID of the called service.
+	Amount       int64     `json:"amount" db:"amount"`               // The amount spent, in cogs.
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`        // The creation timestamp of the spending.
+}
+
+// SpendingFilter narrows spendings down to a user, a room or a service. Empty fields match everything.
+type SpendingFilter struct {
+	MatrixUserID string // The Matrix ID of the user who made the calls.
+	RoomID       string // The Matrix room the calls were made in.
+	ServiceID    string // The Snet ID of the called service.
+}
+
+// ChannelAction represents an on-chain action taken on a payment channel or the MPE balance by the reclaim worker.
+type ChannelAction struct {
+	ID         int       `json:"id" db:"id"`                  // The ID of the action.
+	MPEAddress string    `json:"mpeAddress" db:"mpe_address"` // The address of the MPE contract.
+	ChannelID  *big.Int  `json:"channelId" db:"channel_id"`   // The ID of the channel, nil for withdrawals.
+	Action     string    `json:"action" db:"action"`          // The action, e.g., claim_timeout or withdraw.
+	Amount     *big.Int  `json:"amount" db:"amount"`          // The amount reclaimed or withdrawn, in cogs.
+	TxHash     *string   `json:"txHash" db:"tx_hash"`         // The transaction hash, can be null if no transaction was sent.
+	Status     string    `json:"status" db:"status"`          // The status of the action, e.g., success or failed.
+	Error      *string   `json:"error" db:"error"`            // The error message of a failed action, can be null.
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`   // The creation timestamp of the action.
+}
+
+// ServiceCall represents one entry of the call ledger: who called what, how it was paid and how it ended.
+type ServiceCall struct {
+	ID           int       `json:"id" db:"id"`                       // The ID of the ledger entry.
+	MatrixUserID string    `json:"matrixUserId" db:"matrix_user_id"` // The Matrix ID of the user who made the call, empty for calls without a sender.
+	RoomID       string    `json:"roomId" db:"room_id"`              // The Matrix room the call was made in.
+	ServiceID    string    `json:"serviceId" db:"service_id"`        // The Snet ID of the called service.
+	Method       string    `json:"method" db:"method"`               // The called gRPC method.
+	Strategy     string    `json:"strategy" db:"strategy"`           // The payment strategy, e.g., prepaid, escrow or free-call.
+	Endpoint     string    `json:"endpoint" db:"endpoint"`           // The daemon endpoint that answered the call.
+	MPEAddress   string    `json:"mpeAddress" db:"mpe_address"`      // The address of the MPE contract holding the channel.
+	ChannelID    *big.Int  `json:"channelId" db:"channel_id"`        // The ID of the payment channel, nil for free calls.
+	Nonce        *big.Int  `json:"nonce" db:"nonce"`                 // The nonce of the payment channel, nil for free calls.
+	SignedAmount *big.Int  `json:"signedAmount" db:"signed_amount"`  // The amount signed for the channel when the call was made, nil for free calls.
+	Cost         int64     `json:"cost" db:"cost"`                   // The amount the call cost, in cogs.
+	DurationMs   int64     `json:"durationMs" db:"duration_ms"`      // The duration of the call in milliseconds.
+	GRPCStatus   string    `json:"grpcStatus" db:"grpc_status"`      // The gRPC status code of the call.
+	Error        string    `json:"error" db:"error"`                 // The error of a failed call.
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`        // The creation timestamp of the ledger entry.
+}
+
+// ServiceCallFilter narrows the call ledger down. Empty fields and zero times match everything.
+type ServiceCallFilter struct {
+	MatrixUserID string    // The Matrix ID of the user who made the calls.
+	RoomID       string    // The Matrix room the calls were made in.
+	ServiceID    string    // The Snet ID of the called service.
+	Since        time.Time // The earliest creation time of the calls.
+	Until        time.Time // The time before which the calls were made.
+}
+
+// RoomSettings represents the per-room settings of the bot.
+type RoomSettings struct {
+	RoomID           string    `json:"roomId" db:"room_id"`                     // The Matrix room the settings apply to.
+	ConfirmThreshold *int64    `json:"confirmThreshold" db:"confirm_threshold"` // Calls cheaper than this amount in cogs run without confirmation, null for the default.
+	CreatedAt        time.Time `json:"createdAt" db:"created_at"`               // The creation timestamp of the settings.
+	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`               // The last update timestamp of the settings.
+}
+
+// ServiceProtos represents the proto sources of a Snet service together with the descriptors compiled from them.
+// Services publishing the same sources share one entry.
+type ServiceProtos struct {
+	ContentHash   string            `db:"content_hash"`   // The hex-encoded SHA-256 hash of the sources.
+	Sources       map[string]string `db:"sources"`        // The proto sources by file name.
+	DescriptorSet []byte            `db:"descriptor_set"` // The serialized FileDescriptorSet compiled from the sources, with their imports.
+	CreatedAt     time.Time         `db:"created_at"`     // The creation timestamp of the entry.
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 	"github.com/tensved/snet-matrix-framework/internal/config"
@@ -117,6 +118,188 @@ func New() Service {
 				expires_at          		TIMESTAMP NOT NULL DEFAULT current_timestamp + interval '2 minutes'
 			);
 
+	ALTER TABLE payment_states
+		ADD COLUMN IF NOT EXISTS signer TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS recipient TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS group_id TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS expiration BIGINT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS channel_id TEXT DEFAULT NULL;
+
+	ALTER TABLE payment_states
+		ADD COLUMN IF NOT EXISTS sender TEXT DEFAULT NULL;
+
+	-- A transaction pays for one payment state only; databases already holding a reused transaction keep working without the index
+	DO $$
+	BEGIN
+		CREATE UNIQUE INDEX IF NOT EXISTS payment_states_paid_tx_hash_idx ON payment_states (tx_hash) WHERE status = 'paid';
+	EXCEPTION WHEN unique_violation THEN
+		RAISE WARNING 'payment_states holds transactions paying several payments, payment_states_paid_tx_hash_idx not created';
+	END $$;
+
+	CREATE TABLE IF NOT EXISTS user_channel_senders
+		(
+			matrix_user_id      TEXT PRIMARY KEY,
+			sender              TEXT NOT NULL,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS payment_channels
+		(
+			id                  SERIAL PRIMARY KEY,
+			channel_id          NUMERIC(78, 0) NOT NULL,
+			mpe_address         TEXT NOT NULL,
+			sender              TEXT NOT NULL,
+			recipient           TEXT NOT NULL,
+			group_id            TEXT NOT NULL,
+			amount              NUMERIC(78, 0) NOT NULL DEFAULT 0,
+			expiration          NUMERIC(78, 0) NOT NULL DEFAULT 0,
+			nonce               NUMERIC(78, 0) NOT NULL DEFAULT 0,
+			signed_amount       NUMERIC(78, 0) NOT NULL DEFAULT 0,
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			deleted_at          TIMESTAMP DEFAULT NULL,
+			UNIQUE (mpe_address, channel_id)
+		);
+
+	CREATE INDEX IF NOT EXISTS payment_channels_lookup_idx ON payment_channels (mpe_address, sender, recipient, group_id);
+
+	CREATE TABLE IF NOT EXISTS user_wallets
+		(
+			id                      SERIAL PRIMARY KEY,
+			matrix_user_id          TEXT NOT NULL UNIQUE,
+			address                 TEXT NOT NULL,
+			encrypted_private_key   BYTEA NOT NULL,
+			linked_address          TEXT DEFAULT NULL,
+			created_at              TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			updated_at              TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS spendings
+		(
+			id                  SERIAL PRIMARY KEY,
+			matrix_user_id      TEXT NOT NULL,
+			room_id             TEXT NOT NULL,
+			service_id          TEXT NOT NULL,
+			amount              BIGINT NOT NULL DEFAULT 0,
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE INDEX IF NOT EXISTS spendings_created_at_idx ON spendings (created_at);
+
+	CREATE TABLE IF NOT EXISTS channel_actions
+		(
+			id                  SERIAL PRIMARY KEY,
+			mpe_address         TEXT NOT NULL,
+			channel_id          NUMERIC(78, 0) DEFAULT NULL,
+			action              TEXT NOT NULL,
+			amount              NUMERIC(78, 0) NOT NULL DEFAULT 0,
+			tx_hash             TEXT DEFAULT NULL,
+			status              TEXT NOT NULL,
+			error               TEXT DEFAULT NULL,
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS room_settings
+		(
+			room_id             TEXT PRIMARY KEY,
+			confirm_threshold   BIGINT DEFAULT NULL,
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS snet_service_prices
+		(
+			id                  SERIAL PRIMARY KEY,
+			service_id          INTEGER NOT NULL REFERENCES snet_services (id) ON DELETE CASCADE,
+			price_model         TEXT NOT NULL DEFAULT '',
+			is_default          BOOLEAN NOT NULL DEFAULT false,
+			package_name        TEXT NOT NULL DEFAULT '',
+			service_name        TEXT NOT NULL DEFAULT '',
+			method_name         TEXT NOT NULL DEFAULT '',
+			price_in_cogs       BIGINT NOT NULL DEFAULT 0
+		);
+
+	CREATE INDEX IF NOT EXISTS snet_service_prices_service_id_idx ON snet_service_prices (service_id);
+
+	ALTER TABLE snet_service_prices
+		ADD COLUMN IF NOT EXISTS group_id TEXT NOT NULL DEFAULT '';
+
+	ALTER TABLE snet_services
+		ADD COLUMN IF NOT EXISTS endpoints TEXT[] NOT NULL DEFAULT '{}';
+
+	CREATE TABLE IF NOT EXISTS snet_service_groups
+		(
+			id                          SERIAL PRIMARY KEY,
+			service_id                  INTEGER NOT NULL REFERENCES snet_services (id) ON DELETE CASCADE,
+			org_group_id                INTEGER REFERENCES snet_org_groups (id),
+			group_id                    TEXT NOT NULL,
+			group_name                  TEXT NOT NULL DEFAULT '',
+			endpoints                   TEXT[] NOT NULL DEFAULT '{}',
+			price                       BIGINT NOT NULL DEFAULT 0,
+			free_calls                  INTEGER NOT NULL DEFAULT 0,
+			free_call_signer_address    TEXT NOT NULL DEFAULT '',
+			UNIQUE (service_id, group_id)
+		);
+
+	CREATE TABLE IF NOT EXISTS service_group_preferences
+		(
+			matrix_user_id      TEXT NOT NULL,
+			service_id          TEXT NOT NULL,
+			group_name          TEXT NOT NULL,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			PRIMARY KEY (matrix_user_id, service_id)
+		);
+
+	CREATE TABLE IF NOT EXISTS service_calls
+		(
+			id                  SERIAL PRIMARY KEY,
+			matrix_user_id      TEXT NOT NULL DEFAULT '',
+			room_id             TEXT NOT NULL DEFAULT '',
+			service_id          TEXT NOT NULL,
+			method              TEXT NOT NULL DEFAULT '',
+			strategy            TEXT NOT NULL DEFAULT '',
+			endpoint            TEXT NOT NULL DEFAULT '',
+			mpe_address         TEXT NOT NULL DEFAULT '',
+			channel_id          NUMERIC(78, 0) DEFAULT NULL,
+			nonce               NUMERIC(78, 0) DEFAULT NULL,
+			signed_amount       NUMERIC(78, 0) DEFAULT NULL,
+			cost                BIGINT NOT NULL DEFAULT 0,
+			duration_ms         BIGINT NOT NULL DEFAULT 0,
+			grpc_status         TEXT NOT NULL DEFAULT '',
+			error               TEXT NOT NULL DEFAULT '',
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE INDEX IF NOT EXISTS service_calls_created_at_idx ON service_calls (created_at);
+
+	CREATE TABLE IF NOT EXISTS sync_state
+		(
+			name                TEXT PRIMARY KEY,
+			block_number        BIGINT NOT NULL DEFAULT 0,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS service_protos
+		(
+			content_hash        TEXT PRIMARY KEY,
+			sources             JSONB NOT NULL DEFAULT '{}',
+			descriptor_set      BYTEA NOT NULL,
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	ALTER TABLE snet_services
+		ADD COLUMN IF NOT EXISTS proto_hash TEXT NOT NULL DEFAULT '';
+
+	ALTER TABLE snet_services
+		ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+	CREATE TABLE IF NOT EXISTS settings
+		(
+			name                TEXT PRIMARY KEY,
+			value               TEXT NOT NULL,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
 	CREATE EXTENSION IF NOT EXISTS pgcrypto;
 	
 	-- Add service_api_source column if it doesn't exist
@@ -167,11 +350,19 @@ func (p *postgres) Health() map[string]string {
 func (p *postgres) CreateSnetService(s SnetService) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	endpoints := s.Endpoints
+	if endpoints == nil {
+		endpoints = []string{}
+	}
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
 	row := p.Pool.QueryRow(ctx,
 		`
 			INSERT INTO snet_services
-   			(snet_id, snet_org_id, org_id, version, displayname, encoding , service_type, model_ipfs_hash, service_api_source, mpe_address, url, price, group_id, free_calls, free_call_signer_address, short_description, description) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+   			(snet_id, snet_org_id, org_id, version, displayname, encoding , service_type, model_ipfs_hash, service_api_source, mpe_address, url, price, group_id, free_calls, free_call_signer_address, short_description, description, endpoints, tags) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 			ON CONFLICT (snet_id)
 			DO UPDATE SET
 			    snet_id=EXCLUDED.snet_id,
@@ -190,9 +381,13 @@ func (p *postgres) CreateSnetService(s SnetService) (int, error) {
 				free_calls=EXCLUDED.free_calls,
 				free_call_signer_address=EXCLUDED.free_call_signer_address,
 				short_description=EXCLUDED.short_description,
-				description=EXCLUDED.description
+				description=EXCLUDED.description,
+				endpoints=EXCLUDED.endpoints,
+				tags=EXCLUDED.tags,
+				updated_at=NOW(),
+				deleted_at=NULL
 			RETURNING id`,
-		s.SnetID, s.SnetOrgID, s.OrgID, s.Version, s.DisplayName, s.Encoding, s.ServiceType, s.ModelIpfsHash, s.ServiceApiSource, s.MPEAddress, s.URL, s.Price, s.GroupID, s.FreeCalls, s.FreeCallSignerAddress, s.ShortDescription, s.Description)
+		s.SnetID, s.SnetOrgID, s.OrgID, s.Version, s.DisplayName, s.Encoding, s.ServiceType, s.ModelIpfsHash, s.ServiceApiSource, s.MPEAddress, s.URL, s.Price, s.GroupID, s.FreeCalls, s.FreeCallSignerAddress, s.ShortDescription, s.Description, endpoints, tags)
 	var id int
 	err := row.Scan(&id)
 	if err != nil {
@@ -226,7 +421,9 @@ func (p *postgres) CreateSnetOrg(org SnetOrganization) (int, error) {
 			    description=EXCLUDED.description,
 			    url=EXCLUDED.url,
 			    owner=EXCLUDED.owner,
-			    image=EXCLUDED.image
+			    image=EXCLUDED.image,
+			    updated_at=NOW(),
+			    deleted_at=NULL
 			RETURNING id`,
 		org.SnetID, org.Name, org.Type, org.ShortDescription, org.Description, org.URL, org.Owner, org.Image)
 	var id int
@@ -307,13 +504,16 @@ func (p *postgres) GetSnetOrgGroup(groupID string) (SnetOrgGroup, error) {
 
 // Deprecated: GetSnetServices retrieves a list of snet services from the database.
 //
+// Parameters:
+//   - includeDeleted: Whether services marked as deleted are included.
+//
 // Returns:
 //   - services: A slice of SnetService instances.
 //   - error: An error if the operation fails.
-func (p *postgres) GetSnetServices() ([]SnetService, error) {
+func (p *postgres) GetSnetServices(includeDeleted bool) ([]SnetService, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_services")
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_services WHERE deleted_at IS NULL OR $1", includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -326,13 +526,16 @@ func (p *postgres) GetSnetServices() ([]SnetService, error) {
 
 // Deprecated: GetSnetOrgs retrieves a list of snet organizations from the database.
 //
+// Parameters:
+//   - includeDeleted: Whether organizations marked as deleted are included.
+//
 // Returns:
 //   - orgs: A slice of SnetOrganization instances.
 //   - error: An error if the operation fails.
-func (p *postgres) GetSnetOrgs() ([]SnetOrganization, error) {
+func (p *postgres) GetSnetOrgs(includeDeleted bool) ([]SnetOrganization, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_organizations WHERE deleted_at is NULL")
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_organizations WHERE deleted_at IS NULL OR $1", includeDeleted)
 	if err != nil {
 		return nil, errors.New("failed to retrieve snet orgs")
 	}
@@ -373,6 +576,93 @@ func (p *postgres) GetSnetService(snetID string) (*SnetService, error) {
 	return &services[0], nil
 }
 
+// DeleteSnetService marks a snet service as deleted.
+//
+// Parameters:
+//   - snetOrgID: The Snet ID of the organization of the service.
+//   - snetID: The Snet ID of the service.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) DeleteSnetService(snetOrgID, snetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`UPDATE snet_services SET deleted_at=NOW(), updated_at=NOW() WHERE snet_org_id=$1 AND snet_id=$2 AND deleted_at IS NULL`,
+		snetOrgID, snetID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete snet service")
+		return errors.New("failed to delete snet service")
+	}
+	return nil
+}
+
+// DeleteSnetOrgsExcept marks every snet organization not listed as deleted, e.g. those removed from the registry.
+//
+// Parameters:
+//   - snetIDs: The Snet IDs of the organizations to keep.
+//
+// Returns:
+//   - deleted: The Snet IDs of the organizations marked as deleted.
+//   - error: An error if the operation fails.
+func (p *postgres) DeleteSnetOrgsExcept(snetIDs []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := p.Pool.Query(ctx,
+		`UPDATE snet_organizations SET deleted_at=NOW(), updated_at=NOW() WHERE deleted_at IS NULL AND NOT (snet_id = ANY($1)) RETURNING snet_id`,
+		snetIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete snet orgs")
+		return nil, errors.New("failed to delete snet orgs")
+	}
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to scan deleted snet orgs")
+		return nil, errors.New("failed to delete snet orgs")
+	}
+	return deleted, nil
+}
+
+// DeleteSnetServicesExcept marks every snet service not listed as deleted, e.g. those removed from the registry.
+// Services of the listed organizations are kept as well, for organizations whose current services are unknown.
+//
+// Parameters:
+//   - snetIDs: The Snet IDs of the services to keep.
+//   - snetOrgIDs: The Snet IDs of the organizations whose services are kept.
+//
+// Returns:
+//   - deleted: The Snet IDs of the services marked as deleted.
+//   - error: An error if the operation fails.
+func (p *postgres) DeleteSnetServicesExcept(snetIDs, snetOrgIDs []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if snetIDs == nil {
+		snetIDs = []string{}
+	}
+	if snetOrgIDs == nil {
+		snetOrgIDs = []string{}
+	}
+	rows, err := p.Pool.Query(ctx,
+		`
+			UPDATE snet_services SET deleted_at=NOW(), updated_at=NOW()
+			WHERE deleted_at IS NULL AND NOT (snet_id = ANY($1)) AND NOT (COALESCE(snet_org_id, '') = ANY($2))
+			RETURNING snet_id`,
+		snetIDs, snetOrgIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete snet services")
+		return nil, errors.New("failed to delete snet services")
+	}
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to scan deleted snet services")
+		return nil, errors.New("failed to delete snet services")
+	}
+	return deleted, nil
+}
+
+// paymentStateColumns lists the payment_states columns in the order they are scanned.
+const paymentStateColumns = `id, url, status, key, tx_hash, token_address, to_address, amount, created_at, updated_at, expires_at, signer, recipient, group_id, expiration, channel_id, sender`
+
 // CreatePaymentState creates a new payment state in the database.
 //
 // Parameters:
@@ -381,13 +671,16 @@ func (p *postgres) GetSnetService(snetID string) (*SnetService, error) {
 // Returns:
 //   - id: The UUID of the created payment state.
 //   - error: An error if the operation fails.
-//
-// Deprecated: CreatePaymentState creates a new payment state in the database.
 func (p *postgres) CreatePaymentState(ps *PaymentState) (uuid.UUID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	query := `INSERT INTO payment_states (id, url, key, token_address, to_address, amount) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	row := p.Pool.QueryRow(ctx, query, ps.ID, ps.URL, ps.Key, ps.TokenAddress, ps.ToAddress, ps.Amount)
+	query := `INSERT INTO payment_states (id, url, key, token_address, to_address, amount, signer, recipient, group_id, expiration, channel_id, sender, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE($13, current_timestamp + interval '2 minutes')) RETURNING id`
+	var expiresAt *time.Time
+	if !ps.ExpiresAt.IsZero() {
+		expiresAt = &ps.ExpiresAt
+	}
+	row := p.Pool.QueryRow(ctx, query, ps.ID, ps.URL, ps.Key, ps.TokenAddress, ps.ToAddress, ps.Amount, ps.Signer, ps.Recipient, ps.GroupID, ps.Expiration, ps.ChannelID, ps.Sender, expiresAt)
 	id := uuid.UUID{}
 	err := row.Scan(&id)
 	if err != nil {
@@ -396,7 +689,7 @@ func (p *postgres) CreatePaymentState(ps *PaymentState) (uuid.UUID, error) {
 	return id, nil
 }
 
-// Deprecated: GetPaymentStateByKey retrieves a payment state from the database using a key.
+// GetPaymentStateByKey retrieves a payment state from the database using a key.
 //
 // Parameters:
 //   - key: The key to retrieve the payment state.
@@ -407,10 +700,10 @@ func (p *postgres) CreatePaymentState(ps *PaymentState) (uuid.UUID, error) {
 func (p *postgres) GetPaymentStateByKey(key string) (*PaymentState, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	query := `SELECT * FROM payment_states WHERE key = $1 AND status != 'paid'`
+	query := `SELECT ` + paymentStateColumns + ` FROM payment_states WHERE key = $1 AND status != 'paid'`
 	row := p.Pool.QueryRow(ctx, query, key)
 	ps := &PaymentState{}
-	err := row.Scan(&ps.ID, &ps.URL, &ps.Status, &ps.Key, &ps.TxHash, &ps.TokenAddress, &ps.ToAddress, &ps.Amount, &ps.CreatedAt, &ps.UpdatedAt, &ps.ExpiresAt)
+	err := row.Scan(&ps.ID, &ps.URL, &ps.Status, &ps.Key, &ps.TxHash, &ps.TokenAddress, &ps.ToAddress, &ps.Amount, &ps.CreatedAt, &ps.UpdatedAt, &ps.ExpiresAt, &ps.Signer, &ps.Recipient, &ps.GroupID, &ps.Expiration, &ps.ChannelID, &ps.Sender)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("no payment state found with key %s", key)
@@ -421,7 +714,7 @@ func (p *postgres) GetPaymentStateByKey(key string) (*PaymentState, error) {
 	return ps, nil
 }
 
-// Deprecated: GetPaymentState retrieves a payment state from the database using an Id.
+// GetPaymentState retrieves a payment state from the database using an Id.
 //
 // Parameters:
 //   - id: The UUID of the payment state to retrieve.
@@ -432,10 +725,10 @@ func (p *postgres) GetPaymentStateByKey(key string) (*PaymentState, error) {
 func (p *postgres) GetPaymentState(id uuid.UUID) (*PaymentState, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	query := `SELECT * FROM payment_states WHERE id = $1 AND status != 'paid'`
+	query := `SELECT ` + paymentStateColumns + ` FROM payment_states WHERE id = $1 AND status != 'paid'`
 	row := p.Pool.QueryRow(ctx, query, id)
 	ps := &PaymentState{}
-	err := row.Scan(&ps.ID, &ps.URL, &ps.Status, &ps.Key, &ps.TxHash, &ps.TokenAddress, &ps.ToAddress, &ps.Amount, &ps.CreatedAt, &ps.UpdatedAt, &ps.ExpiresAt)
+	err := row.Scan(&ps.ID, &ps.URL, &ps.Status, &ps.Key, &ps.TxHash, &ps.TokenAddress, &ps.ToAddress, &ps.Amount, &ps.CreatedAt, &ps.UpdatedAt, &ps.ExpiresAt, &ps.Signer, &ps.Recipient, &ps.GroupID, &ps.Expiration, &ps.ChannelID, &ps.Sender)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, errors.New("no payment state found")
@@ -446,7 +739,7 @@ func (p *postgres) GetPaymentState(id uuid.UUID) (*PaymentState, error) {
 	return ps, nil
 }
 
-// Deprecated: PatchUpdatePaymentState updates specific fields of a payment state in the database.
+// PatchUpdatePaymentState updates specific fields of a payment state in the database.
 //
 // Parameters:
 //   - ps: An instance of PaymentState containing the fields to update.
@@ -481,8 +774,1006 @@ func (p *postgres) PatchUpdatePaymentState(ps *PaymentState) error {
 	defer cancel()
 	_, err := p.Pool.Exec(ctx, query, params...)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrTxHashConsumed
+		}
 		return errors.New("failed to update payment state")
 	}
 
 	return nil
 }
+
+// GetUserChannelSender retrieves the address a Matrix user funded payment channels from through the payment gateway.
+//
+// Parameters:
+//   - matrixUserID: The Matrix ID of the user.
+//
+// Returns:
+//   - sender: The address of the channel sender, empty if the user has not funded a channel yet.
+//   - error: An error if the operation fails.
+func (p *postgres) GetUserChannelSender(matrixUserID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var sender string
+	err := p.Pool.QueryRow(ctx, `SELECT sender FROM user_channel_senders WHERE matrix_user_id = $1`, matrixUserID).Scan(&sender)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve user channel sender")
+		return "", err
+	}
+	return sender, nil
+}
+
+// SaveUserChannelSender stores the address a Matrix user funded a payment channel from through the payment gateway.
+//
+// Parameters:
+//   - matrixUserID: The Matrix ID of the user.
+//   - sender: The address of the channel sender.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveUserChannelSender(matrixUserID, sender string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO user_channel_senders (matrix_user_id, sender)
+			VALUES ($1, $2)
+			ON CONFLICT (matrix_user_id)
+			DO UPDATE SET
+				sender=EXCLUDED.sender,
+				updated_at=NOW()`,
+		matrixUserID, sender)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save user channel sender")
+		return errors.New("failed to save user channel sender")
+	}
+	return nil
+}
+
+// paymentChannelColumns lists the payment_channels columns with numeric values cast to text for scanning into big.Int.
+const paymentChannelColumns = `id, channel_id::text, mpe_address, sender, recipient, group_id, amount::text, expiration::text, nonce::text, signed_amount::text, created_at, updated_at, deleted_at`
+
+// scanPaymentChannel scans a payment_channels row selected with paymentChannelColumns.
+func scanPaymentChannel(row pgx.Row) (*PaymentChannel, error) {
+	var channelID, amount, expiration, nonce, signedAmount string
+	ch := &PaymentChannel{}
+	err := row.Scan(&ch.ID, &channelID, &ch.MPEAddress, &ch.Sender, &ch.Recipient, &ch.GroupID, &amount, &expiration, &nonce, &signedAmount, &ch.CreatedAt, &ch.UpdatedAt, &ch.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert numeric strings to *big.Int
+	ch.ChannelID, _ = new(big.Int).SetString(channelID, 10)
+	ch.Amount, _ = new(big.Int).SetString(amount, 10)
+	ch.Expiration, _ = new(big.Int).SetString(expiration, 10)
+	ch.Nonce, _ = new(big.Int).SetString(nonce, 10)
+	ch.SignedAmount, _ = new(big.Int).SetString(signedAmount, 10)
+	return ch, nil
+}
+
+// bigIntString returns the decimal representation of a big.Int, treating nil as zero.
+func bigIntString(value *big.Int) string {
+	if value == nil {
+		return "0"
+	}
+	return value.String()
+}
+
+// GetPaymentChannel retrieves the latest active payment channel between a sender and a recipient group.
+//
+// Parameters:
+//   - mpeAddress: The address of the MPE contract.
+//   - sender: The address of the channel sender.
+//   - recipient: The payment address of the service group.
+//   - groupID: The base64-encoded payment group ID.
+//
+// Returns:
+//   - ch: The retrieved PaymentChannel instance, or nil if no channel is stored.
+//   - error: An error if the operation fails.
+func (p *postgres) GetPaymentChannel(mpeAddress, sender, recipient, groupID string) (*PaymentChannel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	query := `SELECT ` + paymentChannelColumns + ` FROM payment_channels
+		WHERE lower(mpe_address) = lower($1) AND lower(sender) = lower($2) AND lower(recipient) = lower($3) AND group_id = $4 AND deleted_at IS NULL
+		ORDER BY channel_id DESC LIMIT 1`
+	ch, err := scanPaymentChannel(p.Pool.QueryRow(ctx, query, mpeAddress, sender, recipient, groupID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve payment channel")
+		return nil, err
+	}
+	log.Debug().Msgf("retrieved payment channel: %+v", ch)
+	return ch, nil
+}
+
+// SavePaymentChannel creates or updates a payment channel in the database.
+//
+// Parameters:
+//   - ch: An instance of PaymentChannel containing channel details.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SavePaymentChannel(ch *PaymentChannel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO payment_channels
+			(channel_id, mpe_address, sender, recipient, group_id, amount, expiration, nonce, signed_amount)
+			VALUES ($1::numeric, $2, $3, $4, $5, $6::numeric, $7::numeric, $8::numeric, $9::numeric)
+			ON CONFLICT (mpe_address, channel_id)
+			DO UPDATE SET
+				sender=EXCLUDED.sender,
+				recipient=EXCLUDED.recipient,
+				group_id=EXCLUDED.group_id,
+				amount=EXCLUDED.amount,
+				expiration=EXCLUDED.expiration,
+				nonce=EXCLUDED.nonce,
+				signed_amount=GREATEST(payment_channels.signed_amount, EXCLUDED.signed_amount),
+				updated_at=NOW(),
+				deleted_at=NULL`,
+		bigIntString(ch.ChannelID), ch.MPEAddress, ch.Sender, ch.Recipient, ch.GroupID, bigIntString(ch.Amount), bigIntString(ch.Expiration), bigIntString(ch.Nonce), bigIntString(ch.SignedAmount))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save payment channel")
+		return errors.New("failed to save payment channel")
+	}
+	return nil
+}
+
+// UpdatePaymentChannelSignedAmount updates the nonce and the last signed amount of a payment channel.
+// A signed amount is never decreased for the same nonce.
+//
+// Parameters:
+//   - mpeAddress: The address of the MPE contract.
+//   - channelID: The ID of the channel in the MPE contract.
+//   - nonce: The current nonce of the channel.
+//   - signedAmount: The amount signed for the nonce.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) UpdatePaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			UPDATE payment_channels SET
+				signed_amount = CASE WHEN nonce = $3::numeric THEN GREATEST(signed_amount, $4::numeric) ELSE $4::numeric END,
+				nonce = $3::numeric,
+				updated_at = NOW()
+			WHERE lower(mpe_address) = lower($1) AND channel_id = $2::numeric`,
+		mpeAddress, bigIntString(channelID), bigIntString(nonce), bigIntString(signedAmount))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to update payment channel signed amount")
+		return errors.New("failed to update payment channel signed amount")
+	}
+	return nil
+}
+
+// RevertPaymentChannelSignedAmount lowers the last signed amount of a payment channel, e.g. after the daemon refused a payment
+// that was recorded before the call. Amounts stored for another nonce are left unchanged.
+//
+// Parameters:
+//   - mpeAddress: The address of the MPE contract.
+//   - channelID: The ID of the channel in the MPE contract.
+//   - nonce: The nonce the amount was signed for.
+//   - signedAmount: The highest amount the daemon may have accepted for the nonce.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) RevertPaymentChannelSignedAmount(mpeAddress string, channelID, nonce, signedAmount *big.Int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			UPDATE payment_channels SET
+				signed_amount = LEAST(signed_amount, $4::numeric),
+				updated_at = NOW()
+			WHERE lower(mpe_address) = lower($1) AND channel_id = $2::numeric AND nonce = $3::numeric`,
+		mpeAddress, bigIntString(channelID), bigIntString(nonce), bigIntString(signedAmount))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to revert payment channel signed amount")
+		return errors.New("failed to revert payment channel signed amount")
+	}
+	return nil
+}
+
+// DeletePaymentChannel marks a payment channel as deleted, e.g. after it was claimed or reclaimed on-chain.
+//
+// Parameters:
+//   - mpeAddress: The address of the MPE contract.
+//   - channelID: The ID of the channel in the MPE contract.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) DeletePaymentChannel(mpeAddress string, channelID *big.Int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`UPDATE payment_channels SET deleted_at = NOW(), updated_at = NOW() WHERE lower(mpe_address) = lower($1) AND channel_id = $2::numeric`,
+		mpeAddress, bigIntString(channelID))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete payment channel")
+		return errors.New("failed to delete payment channel")
+	}
+	return nil
+}
+
+// paymentChannelLockTimeout limits how long a payment channel row stays locked, e.g. while a paid call runs.
+const paymentChannelLockTimeout = 10 * time.Minute
+
+// paymentChannelLock is a transaction holding the row lock of a payment channel.
+type paymentChannelLock struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	tx         pgx.Tx
+	channel    *PaymentChannel
+	mpeAddress string
+	channelID  *big.Int
+}
+
+// LockPaymentChannel locks a payment channel, stored or not yet, until the lock is released.
+// Other processes locking the same channel wait, so they see the amount signed by this one.
+//
+// Parameters:
+//   - mpeAddress: The address of the MPE contract.
+//   - channelID: The ID of the channel in the MPE contract.
+//
+// Returns:
+//   - PaymentChannelLock: The lock holding the channel row.
+//   - error: An error if the operation fails.
+func (p *postgres) LockPaymentChannel(mpeAddress string, channelID *big.Int) (PaymentChannelLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), paymentChannelLockTimeout)
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The row lock alone locks nothing while the channel is not stored yet, the advisory lock covers that case
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(lower($1) || '/' || $2, 0))`, mpeAddress, bigIntString(channelID))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to lock payment channel")
+		_ = tx.Rollback(ctx)
+		cancel()
+		return nil, errors.New("failed to lock payment channel")
+	}
+
+	query := `SELECT ` + paymentChannelColumns + ` FROM payment_channels
+		WHERE lower(mpe_address) = lower($1) AND channel_id = $2::numeric
+		FOR UPDATE`
+	ch, err := scanPaymentChannel(tx.QueryRow(ctx, query, mpeAddress, bigIntString(channelID)))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Error().Err(err).Msg("failed to lock payment channel")
+		_ = tx.Rollback(ctx)
+		cancel()
+		return nil, errors.New("failed to lock payment channel")
+	}
+
+	return &paymentChannelLock{
+		ctx:        ctx,
+		cancel:     cancel,
+		tx:         tx,
+		channel:    ch,
+		mpeAddress: mpeAddress,
+		channelID:  channelID,
+	}, nil
+}
+
+// Channel returns the locked payment channel, nil if the channel is not stored.
+func (l *paymentChannelLock) Channel() *PaymentChannel {
+	return l.channel
+}
+
+// Release stores the nonce and signed amount if commit is true and releases the lock.
+//
+// Parameters:
+//   - nonce: The current nonce of the channel.
+//   - signedAmount: The amount signed for the nonce.
+//   - commit: Whether the amount was accepted and must be stored.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (l *paymentChannelLock) Release(nonce, signedAmount *big.Int, commit bool) error {
+	defer l.cancel()
+	if !commit || l.channel == nil {
+		return l.tx.Rollback(l.ctx)
+	}
+
+	_, err := l.tx.Exec(l.ctx,
+		`
+			UPDATE payment_channels SET
+				signed_amount = CASE WHEN nonce = $3::numeric THEN GREATEST(signed_amount, $4::numeric) ELSE $4::numeric END,
+				nonce = $3::numeric,
+				updated_at = NOW()
+			WHERE lower(mpe_address) = lower($1) AND channel_id = $2::numeric`,
+		l.mpeAddress, bigIntString(l.channelID), bigIntString(nonce), bigIntString(signedAmount))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to update locked payment channel")
+		_ = l.tx.Rollback(l.ctx)
+		return errors.New("failed to update payment channel signed amount")
+	}
+	return l.tx.Commit(l.ctx)
+}
+
+// GetUserWallet retrieves the wallet of a Matrix user.
+//
+// Parameters:
+//   - matrixUserID: The Matrix ID of the wallet owner.
+//
+// Returns:
+//   - w: The retrieved UserWallet instance, or nil if the user has no wallet.
+//   - error: An error if the operation fails.
+func (p *postgres) GetUserWallet(matrixUserID string) (*UserWallet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w := &UserWallet{}
+	err := p.Pool.QueryRow(ctx,
+		`SELECT id, matrix_user_id, address, encrypted_private_key, linked_address, created_at, updated_at FROM user_wallets WHERE matrix_user_id = $1`,
+		matrixUserID).Scan(&w.ID, &w.MatrixUserID, &w.Address, &w.EncryptedPrivateKey, &w.LinkedAddress, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve user wallet")
+		return nil, err
+	}
+	return w, nil
+}
+
+// SaveUserWallet creates or updates the wallet of a Matrix user.
+//
+// Parameters:
+//   - w: An instance of UserWallet containing wallet details.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveUserWallet(w *UserWallet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO user_wallets (matrix_user_id, address, encrypted_private_key, linked_address)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (matrix_user_id)
+			DO UPDATE SET
+				address=EXCLUDED.address,
+				encrypted_private_key=EXCLUDED.encrypted_private_key,
+				linked_address=EXCLUDED.linked_address,
+				updated_at=NOW()`,
+		w.MatrixUserID, w.Address, w.EncryptedPrivateKey, w.LinkedAddress)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save user wallet")
+		return errors.New("failed to save user wallet")
+	}
+	return nil
+}
+
+// CreateSpending records the amount spent on a service call.
+//
+// Parameters:
+//   - spending: An instance of Spending containing the call details.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) CreateSpending(spending *Spending) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`INSERT INTO spendings (matrix_user_id, room_id, service_id, amount) VALUES ($1, $2, $3, $4)`,
+		spending.MatrixUserID, spending.RoomID, spending.ServiceID, spending.Amount)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create spending")
+		return errors.New("failed to create spending")
+	}
+	return nil
+}
+
+// GetSpentAmount sums the amounts spent since a moment, narrowed by a filter.
+//
+// Parameters:
+//   - filter: The user, room and service to sum spendings for; empty fields match everything.
+//   - since: The beginning of the time window.
+//
+// Returns:
+//   - int64: The amount spent, in cogs.
+//   - error: An error if the operation fails.
+func (p *postgres) GetSpentAmount(filter SpendingFilter, since time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	query := `
+		SELECT COALESCE(SUM(amount), 0) FROM spendings
+		WHERE created_at >= $1
+			AND ($2 = '' OR matrix_user_id = $2)
+			AND ($3 = '' OR room_id = $3)
+			AND ($4 = '' OR service_id = $4)`
+	var spent int64
+	err := p.Pool.QueryRow(ctx, query, since, filter.MatrixUserID, filter.RoomID, filter.ServiceID).Scan(&spent)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get spent amount")
+		return 0, errors.New("failed to get spent amount")
+	}
+	return spent, nil
+}
+
+// CreateChannelAction records an action taken on a payment channel by the reclaim worker.
+//
+// Parameters:
+//   - action: An instance of ChannelAction containing the action details.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) CreateChannelAction(action *ChannelAction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var channelID *string
+	if action.ChannelID != nil {
+		id := action.ChannelID.String()
+		channelID = &id
+	}
+	_, err := p.Pool.Exec(ctx,
+		`INSERT INTO channel_actions (mpe_address, channel_id, action, amount, tx_hash, status, error) VALUES ($1, $2::numeric, $3, $4::numeric, $5, $6, $7)`,
+		action.MPEAddress, channelID, action.Action, bigIntString(action.Amount), action.TxHash, action.Status, action.Error)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create channel action")
+		return errors.New("failed to create channel action")
+	}
+	return nil
+}
+
+// GetRoomSettings retrieves the settings of a Matrix room.
+//
+// Parameters:
+//   - roomID: The ID of the Matrix room.
+//
+// Returns:
+//   - settings: The retrieved RoomSettings instance, or nil if the room has no settings.
+//   - error: An error if the operation fails.
+func (p *postgres) GetRoomSettings(roomID string) (*RoomSettings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	settings := &RoomSettings{}
+	err := p.Pool.QueryRow(ctx,
+		`SELECT room_id, confirm_threshold, created_at, updated_at FROM room_settings WHERE room_id = $1`,
+		roomID).Scan(&settings.RoomID, &settings.ConfirmThreshold, &settings.CreatedAt, &settings.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve room settings")
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SaveRoomSettings creates or updates the settings of a Matrix room.
+//
+// Parameters:
+//   - settings: An instance of RoomSettings containing the room settings.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveRoomSettings(settings *RoomSettings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO room_settings (room_id, confirm_threshold)
+			VALUES ($1, $2)
+			ON CONFLICT (room_id)
+			DO UPDATE SET
+				confirm_threshold=EXCLUDED.confirm_threshold,
+				updated_at=NOW()`,
+		settings.RoomID, settings.ConfirmThreshold)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save room settings")
+		return errors.New("failed to save room settings")
+	}
+	return nil
+}
+
+// GetSnetServicePrices retrieves the pricing table of a snet service.
+//
+// Parameters:
+//   - serviceID: The ID of the service.
+//
+// Returns:
+//   - prices: A slice of SnetServicePrice, empty if the service has no pricing table.
+//   - error: An error if the operation fails.
+func (p *postgres) GetSnetServicePrices(serviceID int) ([]SnetServicePrice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := p.Pool.Query(ctx,
+		`SELECT id, service_id, group_id, price_model, is_default, package_name, service_name, method_name, price_in_cogs FROM snet_service_prices WHERE service_id = $1 ORDER BY id`,
+		serviceID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve snet service prices")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []SnetServicePrice
+	for rows.Next() {
+		var price SnetServicePrice
+		err = rows.Scan(&price.ID, &price.ServiceID, &price.GroupID, &price.PriceModel, &price.Default, &price.PackageName, &price.ServiceName, &price.MethodName, &price.PriceInCogs)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to scan snet service price")
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+	return prices, rows.Err()
+}
+
+// SaveSnetServicePrices replaces the pricing table of a snet service.
+//
+// Parameters:
+//   - serviceID: The ID of the service.
+//   - prices: A slice of SnetServicePrice containing the new pricing table.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveSnetServicePrices(serviceID int, prices []SnetServicePrice) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Error().Err(err).Msg("failed to roll back saving snet service prices")
+		}
+	}(tx, ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM snet_service_prices WHERE service_id = $1`, serviceID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete snet service prices")
+		return err
+	}
+
+	stmt := `
+		INSERT INTO snet_service_prices (service_id, group_id, price_model, is_default, package_name, service_name, method_name, price_in_cogs)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for _, price := range prices {
+		_, err = tx.Exec(ctx, stmt, serviceID, price.GroupID, price.PriceModel, price.Default, price.PackageName, price.ServiceName, price.MethodName, price.PriceInCogs)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to save snet service price")
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetSnetServiceGroups retrieves the payment groups of a snet service.
+//
+// Parameters:
+//   - serviceID: The ID of the service.
+//
+// Returns:
+//   - groups: A slice of SnetServiceGroup in metadata order, empty if the service has no stored groups.
+//   - error: An error if the operation fails.
+func (p *postgres) GetSnetServiceGroups(serviceID int) ([]SnetServiceGroup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := p.Pool.Query(ctx,
+		`SELECT id, service_id, org_group_id, group_id, group_name, endpoints, price, free_calls, free_call_signer_address FROM snet_service_groups WHERE service_id = $1 ORDER BY id`,
+		serviceID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve snet service groups")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []SnetServiceGroup
+	for rows.Next() {
+		var g SnetServiceGroup
+		err = rows.Scan(&g.ID, &g.ServiceID, &g.OrgGroupID, &g.GroupID, &g.GroupName, &g.Endpoints, &g.Price, &g.FreeCalls, &g.FreeCallSignerAddress)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to scan snet service group")
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// SaveSnetServiceGroups replaces the payment groups of a snet service.
+// Each group is linked to the organization group with the same group ID.
+//
+// Parameters:
+//   - serviceID: The ID of the service.
+//   - groups: A slice of SnetServiceGroup in metadata order.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveSnetServiceGroups(serviceID int, groups []SnetServiceGroup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Error().Err(err).Msg("failed to roll back saving snet service groups")
+		}
+	}(tx, ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM snet_service_groups WHERE service_id = $1`, serviceID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete snet service groups")
+		return err
+	}
+
+	stmt := `
+		INSERT INTO snet_service_groups (service_id, org_group_id, group_id, group_name, endpoints, price, free_calls, free_call_signer_address)
+		VALUES ($1, (SELECT id FROM snet_org_groups WHERE group_id = $2 AND deleted_at IS NULL), $2, $3, $4, $5, $6, $7)
+	`
+	for _, g := range groups {
+		_, err = tx.Exec(ctx, stmt, serviceID, g.GroupID, g.GroupName, g.Endpoints, g.Price, g.FreeCalls, g.FreeCallSignerAddress)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to save snet service group")
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPreferredGroup retrieves the payment group a Matrix user chose for a service.
+//
+// Parameters:
+//   - matrixUserID: The Matrix ID of the user.
+//   - serviceID: The Snet ID of the service.
+//
+// Returns:
+//   - string: The name of the chosen group, or an empty string if the user made no choice.
+//   - error: An error if the operation fails.
+func (p *postgres) GetPreferredGroup(matrixUserID, serviceID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var groupName string
+	err := p.Pool.QueryRow(ctx,
+		`SELECT group_name FROM service_group_preferences WHERE matrix_user_id = $1 AND service_id = $2`,
+		matrixUserID, serviceID).Scan(&groupName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve preferred group")
+		return "", err
+	}
+	return groupName, nil
+}
+
+// SavePreferredGroup stores the payment group a Matrix user chose for a service.
+//
+// Parameters:
+//   - matrixUserID: The Matrix ID of the user.
+//   - serviceID: The Snet ID of the service.
+//   - groupName: The name of the chosen group; an empty name clears the choice.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SavePreferredGroup(matrixUserID, serviceID, groupName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var err error
+	if groupName == "" {
+		_, err = p.Pool.Exec(ctx,
+			`DELETE FROM service_group_preferences WHERE matrix_user_id = $1 AND service_id = $2`,
+			matrixUserID, serviceID)
+	} else {
+		_, err = p.Pool.Exec(ctx,
+			`
+				INSERT INTO service_group_preferences (matrix_user_id, service_id, group_name)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (matrix_user_id, service_id)
+				DO UPDATE SET
+					group_name=EXCLUDED.group_name,
+					updated_at=NOW()`,
+			matrixUserID, serviceID, groupName)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save preferred group")
+		return errors.New("failed to save preferred group")
+	}
+	return nil
+}
+
+// nullableBigInt returns the decimal representation of a big.Int, or nil for a nil value.
+func nullableBigInt(value *big.Int) *string {
+	if value == nil {
+		return nil
+	}
+	s := value.String()
+	return &s
+}
+
+// parseNullableBigInt converts a nullable decimal string to a big.Int.
+func parseNullableBigInt(value *string) *big.Int {
+	if value == nil {
+		return nil
+	}
+	parsed, _ := new(big.Int).SetString(*value, 10)
+	return parsed
+}
+
+// CreateServiceCall records a service call in the call ledger.
+//
+// Parameters:
+//   - call: An instance of ServiceCall containing the call details.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) CreateServiceCall(call *ServiceCall) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO service_calls
+			(matrix_user_id, room_id, service_id, method, strategy, endpoint, mpe_address, channel_id, nonce, signed_amount, cost, duration_ms, grpc_status, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::numeric, $9::numeric, $10::numeric, $11, $12, $13, $14)`,
+		call.MatrixUserID, call.RoomID, call.ServiceID, call.Method, call.Strategy, call.Endpoint, call.MPEAddress,
+		nullableBigInt(call.ChannelID), nullableBigInt(call.Nonce), nullableBigInt(call.SignedAmount),
+		call.Cost, call.DurationMs, call.GRPCStatus, call.Error)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create service call")
+		return errors.New("failed to create service call")
+	}
+	return nil
+}
+
+// GetServiceCalls retrieves the call ledger narrowed by a filter, oldest first.
+//
+// Parameters:
+//   - filter: The user, room, service and time range to narrow the ledger down to.
+//
+// Returns:
+//   - []ServiceCall: The matching ledger entries.
+//   - error: An error if the operation fails.
+func (p *postgres) GetServiceCalls(filter ServiceCallFilter) ([]ServiceCall, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var since, until *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = &filter.Until
+	}
+
+	rows, err := p.Pool.Query(ctx,
+		`
+			SELECT id, matrix_user_id, room_id, service_id, method, strategy, endpoint, mpe_address,
+				channel_id::text, nonce::text, signed_amount::text, cost, duration_ms, grpc_status, error, created_at
+			FROM service_calls
+			WHERE ($1 = '' OR matrix_user_id = $1)
+				AND ($2 = '' OR room_id = $2)
+				AND ($3 = '' OR service_id = $3)
+				AND ($4::timestamp IS NULL OR created_at >= $4)
+				AND ($5::timestamp IS NULL OR created_at < $5)
+			ORDER BY created_at, id`,
+		filter.MatrixUserID, filter.RoomID, filter.ServiceID, since, until)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve service calls")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []ServiceCall
+	for rows.Next() {
+		var call ServiceCall
+		var channelID, nonce, signedAmount *string
+		err := rows.Scan(&call.ID, &call.MatrixUserID, &call.RoomID, &call.ServiceID, &call.Method, &call.Strategy, &call.Endpoint, &call.MPEAddress,
+			&channelID, &nonce, &signedAmount, &call.Cost, &call.DurationMs, &call.GRPCStatus, &call.Error, &call.CreatedAt)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to scan service call")
+			return nil, err
+		}
+		call.ChannelID = parseNullableBigInt(channelID)
+		call.Nonce = parseNullableBigInt(nonce)
+		call.SignedAmount = parseNullableBigInt(signedAmount)
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+// GetSyncBlock retrieves the last block processed by a sync job.
+//
+// Parameters:
+//   - name: The name of the sync job.
+//
+// Returns:
+//   - block: The last processed block, 0 if the job has not processed any block yet.
+//   - error: An error if the operation fails.
+func (p *postgres) GetSyncBlock(name string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var block int64
+	err := p.Pool.QueryRow(ctx, `SELECT block_number FROM sync_state WHERE name = $1`, name).Scan(&block)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve sync block")
+		return 0, err
+	}
+	return uint64(block), nil
+}
+
+// SaveSyncBlock stores the last block processed by a sync job.
+//
+// Parameters:
+//   - name: The name of the sync job.
+//   - block: The last processed block.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveSyncBlock(name string, block uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO sync_state (name, block_number)
+			VALUES ($1, $2)
+			ON CONFLICT (name)
+			DO UPDATE SET
+				block_number=EXCLUDED.block_number,
+				updated_at=NOW()`,
+		name, int64(block))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save sync block")
+		return errors.New("failed to save sync block")
+	}
+	return nil
+}
+
+// GetServiceProtos retrieves proto sources and the descriptors compiled from them.
+//
+// Parameters:
+//   - contentHash: The content hash of the sources.
+//
+// Returns:
+//   - protos: The stored sources and descriptors, nil if there are none.
+//   - error: An error if the operation fails.
+func (p *postgres) GetServiceProtos(contentHash string) (*ServiceProtos, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	protos := &ServiceProtos{}
+	err := p.Pool.QueryRow(ctx,
+		`SELECT content_hash, sources, descriptor_set, created_at FROM service_protos WHERE content_hash = $1`,
+		contentHash).Scan(&protos.ContentHash, &protos.Sources, &protos.DescriptorSet, &protos.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve service protos")
+		return nil, err
+	}
+	return protos, nil
+}
+
+// SaveServiceProtos stores proto sources and the descriptors compiled from them.
+// Sources are stored once per content hash, so services publishing the same sources share them.
+//
+// Parameters:
+//   - protos: An instance of ServiceProtos containing the sources and descriptors.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveServiceProtos(protos *ServiceProtos) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO service_protos (content_hash, sources, descriptor_set)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (content_hash) DO NOTHING`,
+		protos.ContentHash, protos.Sources, protos.DescriptorSet)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save service protos")
+		return errors.New("failed to save service protos")
+	}
+	return nil
+}
+
+// SetSnetServiceProtoHash points a snet service to the proto sources it is called with.
+//
+// Parameters:
+//   - snetID: The Snet ID of the service.
+//   - contentHash: The content hash of the proto sources.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SetSnetServiceProtoHash(snetID, contentHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`UPDATE snet_services SET proto_hash=$2, updated_at=NOW() WHERE snet_id=$1`,
+		snetID, contentHash)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to set snet service proto hash")
+		return errors.New("failed to set snet service proto hash")
+	}
+	return nil
+}
+
+// GetSetting retrieves a setting changed at runtime, e.g. by an admin.
+//
+// Parameters:
+//   - name: The name of the setting.
+//
+// Returns:
+//   - value: The value of the setting, empty if it was not changed.
+//   - error: An error if the operation fails.
+func (p *postgres) GetSetting(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var value string
+	err := p.Pool.QueryRow(ctx, `SELECT value FROM settings WHERE name = $1`, name).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		log.Error().Err(err).Msg("failed to retrieve setting")
+		return "", err
+	}
+	return value, nil
+}
+
+// SaveSetting stores a setting changed at runtime, so it outlives restarts.
+//
+// Parameters:
+//   - name: The name of the setting.
+//   - value: The value of the setting.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) SaveSetting(name, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx,
+		`
+			INSERT INTO settings (name, value)
+			VALUES ($1, $2)
+			ON CONFLICT (name)
+			DO UPDATE SET
+				value=EXCLUDED.value,
+				updated_at=NOW()`,
+		name, value)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save setting")
+		return errors.New("failed to save setting")
+	}
+	return nil
+}
+
+// DeleteSetting removes a setting changed at runtime, so its configured value applies again.
+//
+// Parameters:
+//   - name: The name of the setting.
+//
+// Returns:
+//   - error: An error if the operation fails.
+func (p *postgres) DeleteSetting(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.Pool.Exec(ctx, `DELETE FROM settings WHERE name = $1`, name)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete setting")
+		return errors.New("failed to delete setting")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// local signs with a private key held in memory.
+type local struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+}
+
+// NewLocal returns a signer holding the private key in memory.
+func NewLocal(privateKey *ecdsa.PrivateKey) Signer {
+	return &local{
+		privateKey: privateKey,
+		address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+	}
+}
+
+// FromHex returns a signer for a hex-encoded private key.
+func FromHex(hexKey string) (Signer, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return NewLocal(privateKey), nil
+}
+
+// FromKeystore decrypts a go-ethereum keystore JSON file with the passphrase stored in another file.
+// Trailing line breaks of the passphrase file are ignored.
+//
+// Parameters:
+//   - keystoreFile: The path of the encrypted keystore JSON file.
+//   - passphraseFile: The path of the file holding the passphrase.
+//
+// Returns:
+//   - Signer: A signer holding the decrypted key in memory.
+//   - error: An error if a file cannot be read or the passphrase is wrong.
+func FromKeystore(keystoreFile, passphraseFile string) (Signer, error) {
+	keyJSON, err := os.ReadFile(keystoreFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %w", err)
+	}
+
+	var passphrase string
+	if passphraseFile != "" {
+		raw, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keystore passphrase file: %w", err)
+		}
+		passphrase = strings.TrimRight(string(raw), "\r\n")
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore: %w", err)
+	}
+	return NewLocal(key.PrivateKey), nil
+}
+
+// Address returns the address of the key.
+func (s *local) Address() common.Address {
+	return s.address
+}
+
+// SignText signs the text with the Ethereum signed message prefix.
+func (s *local) SignText(text []byte) ([]byte, error) {
+	signature, err := crypto.Sign(accounts.TextHash(text), s.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign text: %w", err)
+	}
+	return signature, nil
+}
+
+// SignTx signs the transaction with the signer of the latest fork of the chain.
+func (s *local) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), s.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,73 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// remote signs through an external signer speaking the clef JSON-RPC API
+// (account_list, account_signData, account_signTransaction) over HTTP or IPC.
+// The private key never enters this process.
+type remote struct {
+	client  *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewRemote connects to an external signer and selects the account to sign with.
+//
+// Parameters:
+//   - endpoint: The HTTP URL or IPC path of the signer.
+//   - address: The address of the account to sign with; empty selects the first account the signer lists.
+//
+// Returns:
+//   - Signer: The remote signer.
+//   - error: An error if the signer is unreachable or does not hold the account.
+func NewRemote(endpoint, address string) (Signer, error) {
+	client, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %w", err)
+	}
+
+	accountsList := client.Accounts()
+	if len(accountsList) == 0 {
+		return nil, errors.New("remote signer lists no accounts")
+	}
+	if address == "" {
+		return &remote{client: client, account: accountsList[0]}, nil
+	}
+
+	account := accounts.Account{Address: common.HexToAddress(address)}
+	if !client.Contains(account) {
+		return nil, fmt.Errorf("remote signer does not hold account %s", account.Address.Hex())
+	}
+	return &remote{client: client, account: account}, nil
+}
+
+// Address returns the address of the selected account.
+func (s *remote) Address() common.Address {
+	return s.account.Address
+}
+
+// SignText asks the signer to sign the text with the Ethereum signed message prefix.
+func (s *remote) SignText(text []byte) ([]byte, error) {
+	signature, err := s.client.SignText(s.account, text)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer failed to sign text: %w", err)
+	}
+	return signature, nil
+}
+
+// SignTx asks the signer to sign the transaction.
+func (s *remote) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := s.client.SignTx(s.account, tx, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer failed to sign transaction: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,91 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+	"github.com/tensved/snet-matrix-framework/internal/config"
+)
+
+// Signer signs messages and transactions for one Ethereum account without exposing its private key.
+type Signer interface {
+	Address() common.Address                                                    // Returns the address of the account.
+	SignText(text []byte) ([]byte, error)                                       // Signs the text prefixed with "\x19Ethereum Signed Message:\n" and its length; V is 0 or 1.
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) // Signs a transaction for the chain.
+}
+
+var (
+	admin   Signer     // The signer of the admin account, nil until it is loaded.
+	adminMu sync.Mutex // A mutex to ensure the admin signer is loaded once.
+)
+
+// Admin returns the signer of the admin account.
+// A remote signer is used if REMOTE_SIGNER_URL is set, an encrypted keystore if ADMIN_KEYSTORE_FILE is set,
+// and the plain ADMIN_PRIVATE_KEY otherwise. The signer is loaded on first use and shared afterwards.
+//
+// Returns:
+//   - Signer: The signer of the admin account.
+//   - error: An error if the configured signer cannot be loaded.
+func Admin() (Signer, error) {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	if admin != nil {
+		return admin, nil
+	}
+
+	var (
+		loaded Signer
+		err    error
+	)
+	switch {
+	case config.Blockchain.RemoteSignerURL != "":
+		loaded, err = NewRemote(config.Blockchain.RemoteSignerURL, config.Blockchain.AdminPublicAddress)
+	case config.Blockchain.AdminKeystoreFile != "":
+		loaded, err = FromKeystore(config.Blockchain.AdminKeystoreFile, config.Blockchain.AdminKeystorePassphraseFile)
+	case config.Blockchain.AdminPrivateKey != "":
+		log.Warn().Msg("admin private key is read from ADMIN_PRIVATE_KEY, use an encrypted keystore or a remote signer in production")
+		loaded, err = FromHex(config.Blockchain.AdminPrivateKey)
+	default:
+		err = errors.New("no admin signer is configured")
+	}
+	if err != nil {
+		// Nothing is kept, so the next call retries, e.g. once the remote signer is up
+		return nil, fmt.Errorf("failed to load admin signer: %w", err)
+	}
+
+	admin = loaded
+	log.Info().
+		Str("address", admin.Address().Hex()).
+		Msg("admin signer loaded")
+	return admin, nil
+}
+
+// TransactOpts creates transaction options signing with the signer.
+//
+// Parameters:
+//   - s: The signer of the sending account.
+//   - chainID: The ID of the chain the transactions are sent to.
+//
+// Returns:
+//   - *bind.TransactOpts: The transaction options.
+func TransactOpts(s Signer, chainID *big.Int) *bind.TransactOpts {
+	from := s.Address()
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.SignTx(tx, chainID)
+		},
+		Context: context.Background(),
+	}
+}